@@ -0,0 +1,119 @@
+package calendar
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ContentType is the media type of iCalendar files.
+const ContentType = "text/calendar; charset=utf-8"
+
+const (
+	// MethodPublish marks a calendar as published information, not as an invitation to answer.
+	MethodPublish = "PUBLISH"
+
+	productID = "-//Cyberix//FRCC//FR"
+	// lineLength is the maximum length of a content line in octets, excluding the line break.
+	lineLength = 75
+)
+
+// Event is a VEVENT component.
+type Event struct {
+	// UID identifies the event across updates, so that calendars replace it instead of adding a copy.
+	UID         string
+	Summary     string
+	Description string
+	Location    string
+	URL         string
+	StartsAt    time.Time
+	EndsAt      time.Time
+	// Sequence is increased each time the event is rescheduled.
+	Sequence int
+}
+
+// Calendar is a VCALENDAR object, encoded as defined by RFC 5545.
+type Calendar struct {
+	Name   string
+	Method string
+	Events []Event
+}
+
+// Bytes encodes the calendar, events being stamped with now.
+func (c Calendar) Bytes(now time.Time) []byte {
+	var buf bytes.Buffer
+	line := func(name, value string) {
+		writeLine(&buf, name+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", productID)
+	line("CALSCALE", "GREGORIAN")
+	if c.Method != "" {
+		line("METHOD", c.Method)
+	}
+	if c.Name != "" {
+		line("X-WR-CALNAME", escapeText(c.Name))
+	}
+
+	for _, e := range c.Events {
+		line("BEGIN", "VEVENT")
+		line("UID", e.UID)
+		line("DTSTAMP", formatTime(now))
+		line("DTSTART", formatTime(e.StartsAt))
+		line("DTEND", formatTime(e.EndsAt))
+		line("SEQUENCE", fmt.Sprint(e.Sequence))
+		line("SUMMARY", escapeText(e.Summary))
+		if e.Description != "" {
+			line("DESCRIPTION", escapeText(e.Description))
+		}
+		if e.Location != "" {
+			line("LOCATION", escapeText(e.Location))
+		}
+		if e.URL != "" {
+			line("URL", e.URL)
+		}
+		line("END", "VEVENT")
+	}
+
+	line("END", "VCALENDAR")
+
+	return buf.Bytes()
+}
+
+// formatTime formats t as a UTC date-time.
+func formatTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+var textEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	";", `\;`,
+	",", `\,`,
+	"\r\n", `\n`,
+	"\n", `\n`,
+)
+
+// escapeText escapes a TEXT value.
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+// writeLine writes a content line, folded every 75 octets without splitting a UTF-8 character.
+func writeLine(buf *bytes.Buffer, line string) {
+	length := 0
+	for _, r := range line {
+		size := utf8.RuneLen(r)
+		if length+size > lineLength {
+			// continuation lines start with a space, which counts towards their length
+			buf.WriteString("\r\n ")
+			length = 1
+		}
+		buf.WriteRune(r)
+		length += size
+	}
+	buf.WriteString("\r\n")
+}
@@ -0,0 +1,101 @@
+package calendar
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestBytes(t *testing.T) {
+	now := time.Date(2026, 5, 1, 8, 0, 0, 0, time.UTC)
+	paris := time.FixedZone("CEST", 2*60*60)
+
+	c := Calendar{
+		Name:   "FRCC",
+		Method: MethodPublish,
+		Events: []Event{{
+			UID:      "event@frcc.example.com",
+			Summary:  "FRCC 2026",
+			Location: "Palais des congrès, Yaoundé",
+			URL:      "https://frcc.example.com",
+			StartsAt: time.Date(2026, 6, 1, 9, 0, 0, 0, paris),
+			EndsAt:   time.Date(2026, 6, 3, 18, 0, 0, 0, paris),
+			Sequence: 2,
+		}},
+	}
+
+	expected := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:" + productID,
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"X-WR-CALNAME:FRCC",
+		"BEGIN:VEVENT",
+		"UID:event@frcc.example.com",
+		"DTSTAMP:20260501T080000Z",
+		"DTSTART:20260601T070000Z",
+		"DTEND:20260603T160000Z",
+		"SEQUENCE:2",
+		"SUMMARY:FRCC 2026",
+		`LOCATION:Palais des congrès\, Yaoundé`,
+		"URL:https://frcc.example.com",
+		"END:VEVENT",
+		"END:VCALENDAR",
+		"",
+	}, "\r\n")
+
+	if got := string(c.Bytes(now)); got != expected {
+		t.Fatalf("expected\n%q\ngot\n%q", expected, got)
+	}
+}
+
+func TestEscapeText(t *testing.T) {
+	tests := map[string]string{
+		`a\b`:     `a\\b`,
+		"a;b,c":   `a\;b\,c`,
+		"a\nb":    `a\nb`,
+		"a\r\nb":  `a\nb`,
+		"nothing": "nothing",
+	}
+
+	for value, expected := range tests {
+		if got := escapeText(value); got != expected {
+			t.Errorf("expected %q to be escaped as %q, got %q", value, expected, got)
+		}
+	}
+}
+
+func TestWriteLineFolds(t *testing.T) {
+	var buf bytes.Buffer
+	writeLine(&buf, "DESCRIPTION:"+strings.Repeat("é", 100))
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n")
+	if len(lines) < 2 {
+		t.Fatalf("expected the line to be folded, got %q", buf.String())
+	}
+
+	var unfolded strings.Builder
+	for i, line := range lines {
+		if len(line) > lineLength {
+			t.Errorf("line %v is %v octets long", i, len(line))
+		}
+		if !utf8.ValidString(line) {
+			t.Errorf("line %v splits a character: %q", i, line)
+		}
+
+		if i > 0 {
+			if !strings.HasPrefix(line, " ") {
+				t.Fatalf("expected continuation line %v to start with a space, got %q", i, line)
+			}
+			line = line[1:]
+		}
+		unfolded.WriteString(line)
+	}
+
+	if unfolded.String() != "DESCRIPTION:"+strings.Repeat("é", 100) {
+		t.Fatalf("expected unfolding to restore the line, got %q", unfolded.String())
+	}
+}
@@ -10,18 +10,22 @@ import (
 	"syscall"
 	"time"
 
+	"cyberix.fr/frcc/config"
+	"cyberix.fr/frcc/handlers"
 	"cyberix.fr/frcc/jobs"
+	"cyberix.fr/frcc/logging"
 	"cyberix.fr/frcc/messaging"
+	"cyberix.fr/frcc/metrics"
 	"cyberix.fr/frcc/server"
 	"cyberix.fr/frcc/storage"
+	"cyberix.fr/frcc/tracing"
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
-	"github.com/aws/smithy-go/logging"
+	smithylogging "github.com/aws/smithy-go/logging"
 	"github.com/joho/godotenv"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
-	"maragu.dev/env"
 )
 
 var release string
@@ -45,6 +49,8 @@ func loadEnvFile(filename string) error {
 
 func main() {
 	envFile := flag.String("env", ".env.local", "Path to the .env file")
+	configFile := flag.String("config", "", "Path to the optional YAML config file, overridden by the environment")
+	demo := flag.Bool("demo", false, "Keep the data and the queue in memory, without Postgres nor SQS")
 	flag.Parse()
 
 	filename := *envFile
@@ -54,50 +60,200 @@ func main() {
 		}
 	}
 
-	os.Exit(start())
+	// migrations run before the rest of the configuration may be deployed, so only the database
+	// settings are required for them
+	if flag.Arg(0) == "migrate" {
+		cfg, err := config.LoadDatabase(*configFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		os.Exit(migrate(cfg, flag.Args()[1:]))
+	}
+
+	cfg, err := config.Load(*configFile, *demo)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	os.Exit(start(cfg))
 }
 
-func start() int {
-	logEnv := env.GetStringOrDefault("LOG_ENV", "development")
-	log, err := createLogger(logEnv)
+func start(cfg *config.Config) int {
+	log, err := createLogger(cfg.LogEnv)
 	if err != nil {
 		fmt.Println("Error setting up the logger: ", err)
 		return 1
 	}
 
-	log = log.With(zap.String("release", release))
+	log = logging.Redact(log).With(zap.String("release", release))
 
 	defer func() {
 		_ = log.Sync()
 	}()
 
-	host := env.GetStringOrDefault("HOST", "0.0.0.0")
-	port := env.GetIntOrDefault("PORT", 8080)
+	// the otlp exporter reads its endpoint from the standard OTEL_EXPORTER_OTLP_* variables
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.SetupOptions{
+		Exporter: cfg.Tracing.Exporter,
+		Release:  release,
+		Service:  cfg.Tracing.ServiceName,
+	})
+	if err != nil {
+		log.Info("Error setting up tracing", zap.Error(err))
+		return 1
+	}
 
-	awsConfig, err := config.LoadDefaultConfig(
-		context.Background(),
-		config.WithLogger(createAWSLogAdapter(log)),
-		config.WithEndpointResolver(createAWSEndpointResolver()),
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			log.Info("Error flushing traces", zap.Error(err))
+		}
+	}()
+
+	var (
+		database *storage.Database
+		store    storage.Storage
 	)
+	if cfg.Demo {
+		log.Info("Running in demo mode, the data is kept in memory and lost on restart")
+		store = storage.NewMemoryStorage()
+	} else {
+		database = createDatabase(log, cfg.DB)
+		if err := database.Connect(); err != nil {
+			log.Info("Error connecting to database", zap.Error(err))
+			return 1
+		}
+
+		// a schema behind or ahead of the code is reported, and refused when DB_REQUIRE_SCHEMA_VERSION is set
+		if err := database.CheckSchemaVersion(context.Background()); err != nil {
+			log.Info("Error checking schema version", zap.Error(err))
+			if cfg.DB.RequireSchemaVersion {
+				return 1
+			}
+		}
+
+		metrics.RegisterDB(database.DB(), cfg.DB.Name)
+		store = database.Storage
+	}
+
+	queue, err := createQueue(log, database, cfg.Queue)
+	if err != nil {
+		log.Info("Error creating queue", zap.Error(err))
+		return 1
+	}
+
+	// sensitive values such as otps are encrypted in the queue when a key is set
+	payloadKey, err := cfg.PayloadKey()
+	if err != nil {
+		log.Info("Error decoding payload encryption key", zap.Error(err))
+		return 1
+	}
+
+	payloadCipher, err := messaging.NewPayloadCipher(payloadKey)
+	if err != nil {
+		log.Info("Error creating payload cipher", zap.Error(err))
+		return 1
+	}
+
+	queue = messaging.NewEncryptedQueue(queue, payloadCipher)
+	queue = messaging.NewInstrumentedQueue(queue, cfg.Queue.Name)
+
+	providers, err := createEmailProviders(log, cfg.Email)
+	if err != nil {
+		log.Info("Error creating email providers", zap.Error(err))
+		return 1
+	}
+
+	// the development mailbox is served by the api itself, and never outside local or demo mode
+	// since it shows every email without authentication
+	var mailbox *messaging.MailboxTransport
+	if cfg.Environment == config.EnvironmentLocal || cfg.Demo {
+		for _, p := range providers {
+			if m, ok := p.Transport.(*messaging.MailboxTransport); ok {
+				mailbox = m
+			}
+		}
+	}
+
+	event := messaging.EventInfo{
+		Name:     cfg.Event.Name,
+		Location: cfg.Event.Location,
+		StartsAt: cfg.Event.Start,
+		EndsAt:   cfg.Event.End,
+		Website:  cfg.Website,
+	}
+
+	// templates are parsed and checked at boot so that a broken email never reaches a user
+	templates, err := messaging.ParseTemplates(messaging.EmailTemplatesFS())
 	if err != nil {
-		log.Info("Error creating AWS config", zap.Error(err))
+		log.Info("Error parsing email templates", zap.Error(err))
 		return 1
 	}
 
-	queue := createQueue(log, awsConfig)
+	emailer := createEmailer(log, cfg, providers, event, templates, store)
 
 	s := server.New(server.Options{
-		Database: createDatabase(log),
-		Host:     host,
-		Port:     port,
-		Log:      log,
-		Queue:    queue,
+		AdminToken:    cfg.AdminToken,
+		CalendarKey:   cfg.CalendarKey(),
+		Database:      database,
+		Emailer:       emailer,
+		Event:         event,
+		Host:          cfg.Host,
+		JWTKey:        []byte(cfg.JWTSecret),
+		Port:          cfg.Port,
+		Log:           log,
+		Mailbox:       mailbox,
+		PayloadCipher: payloadCipher,
+		Queue:         queue,
+		Release:       release,
+		Security: server.SecurityOptions{
+			AllowedOrigins: cfg.CORS.AllowedOrigins,
+			Cookie: handlers.SessionCookie{
+				Domain:   cfg.Cookie.Domain,
+				Lifetime: cfg.Cookie.Lifetime,
+				SameSite: cfg.Cookie.SameSiteMode(),
+				Secure:   cfg.Cookie.Secure,
+			},
+		},
+		Storage:        store,
+		UnsubscribeKey: cfg.UnsubscribeKey(),
+		Webhooks: server.WebhookOptions{
+			Username: cfg.Webhooks.Username,
+			Password: cfg.Webhooks.Password,
+			Secret:   cfg.Webhooks.Secret,
+		},
 	})
 
 	runner := jobs.NewRunner(jobs.NewRunnerOptions{
-		Emailer: createEmailer(log, host, port),
-		Log:     log,
-		Queue:   queue,
+		CampaignBatchInterval: cfg.Jobs.CampaignBatchInterval,
+		CampaignBatchSize:     int32(cfg.Jobs.CampaignBatchSize),
+		Emailer:               emailer,
+		EventStart:            event.StartsAt,
+		Log:                   log,
+		MaxAttempts:           int32(cfg.Jobs.MaxAttempts),
+		PayloadCipher:         payloadCipher,
+		Queue:                 queue,
+		Storage:               store,
+	})
+
+	schedulerOptions := jobs.NewSchedulerOptions{
+		DB:       store,
+		Interval: cfg.Jobs.SchedulerInterval,
+		Log:      log,
+	}
+	// in demo mode the instance runs alone, and needs no lock to lead
+	if database != nil {
+		schedulerOptions.Locker = database
+	}
+	scheduler := jobs.NewScheduler(schedulerOptions)
+
+	relay := messaging.NewOutboxRelay(messaging.NewOutboxRelayOptions{
+		BatchSize: int32(cfg.Jobs.OutboxBatchSize),
+		DB:        store,
+		Interval:  cfg.Jobs.OutboxInterval,
+		Log:       log,
+		Queue:     queue,
 	})
 
 	var eg errgroup.Group
@@ -121,6 +277,16 @@ func start() int {
 		return nil
 	})
 
+	eg.Go(func() error {
+		relay.Start(ctx)
+		return nil
+	})
+
+	eg.Go(func() error {
+		scheduler.Start(ctx)
+		return nil
+	})
+
 	<-ctx.Done()
 
 	eg.Go(func() error {
@@ -150,13 +316,14 @@ func createLogger(env string) (*zap.Logger, error) {
 	}
 }
 
-func createDatabase(log *zap.Logger) *storage.Database {
+func createDatabase(log *zap.Logger, cfg config.DBConfig) *storage.Database {
 	return storage.NewDatabase(storage.NewDatabaseOptions{
-		Host:                  env.GetStringOrDefault("DB_HOST", "localhost"),
-		Port:                  env.GetIntOrDefault("DB_PORT", 5432),
-		User:                  env.GetStringOrDefault("DB_USER", "frcc"),
-		Password:              env.GetStringOrDefault("DB_PASSWORD", "123"),
-		Name:                  env.GetStringOrDefault("DB_NAME", "frcc"),
+		Host:                  cfg.Host,
+		Port:                  cfg.Port,
+		User:                  cfg.User,
+		Password:              cfg.Password,
+		Name:                  cfg.Name,
+		SSLMode:               cfg.SSLMode,
 		MaxOpenConnections:    10,
 		MaxIdleConnections:    10,
 		ConnectionMaxLifetime: time.Hour,
@@ -164,20 +331,18 @@ func createDatabase(log *zap.Logger) *storage.Database {
 	})
 }
 
-func createAWSLogAdapter(log *zap.Logger) logging.LoggerFunc {
-	return func(classification logging.Classification, format string, v ...interface{}) {
+func createAWSLogAdapter(log *zap.Logger) smithylogging.LoggerFunc {
+	return func(classification smithylogging.Classification, format string, v ...interface{}) {
 		switch classification {
-		case logging.Debug:
+		case smithylogging.Debug:
 			log.Sugar().Debugf(format, v...)
-		case logging.Warn:
+		case smithylogging.Warn:
 			log.Sugar().Warnf(format, v...)
 		}
 	}
 }
 
-func createAWSEndpointResolver() aws.EndpointResolverFunc {
-	sqsEndpointURL := env.GetStringOrDefault("SQS_ENDPOINT_URL", "")
-
+func createAWSEndpointResolver(sqsEndpointURL string) aws.EndpointResolverFunc {
 	return func(service, region string) (aws.Endpoint, error) {
 		if sqsEndpointURL != "" && service == sqs.ServiceID {
 			return aws.Endpoint{
@@ -189,23 +354,113 @@ func createAWSEndpointResolver() aws.EndpointResolverFunc {
 	}
 }
 
-func createQueue(log *zap.Logger, awsConfig aws.Config) *messaging.Queue {
-	return messaging.NewQueue(messaging.NewQueueOptions{
-		Config:   awsConfig,
-		Log:      log,
-		Name:     env.GetStringOrDefault("QUEUE_NAME", "jobs"),
-		WaitTime: env.GetDurationOrDefault("QUEUE_WAIT_TIME", 20*time.Second),
-	})
+// createQueue creates the queue of the configured backend, always the in-process one in demo mode.
+func createQueue(log *zap.Logger, database *storage.Database, cfg config.QueueConfig) (messaging.Queue, error) {
+	switch cfg.Backend {
+	case "sqs":
+		awsConfig, err := awsconfig.LoadDefaultConfig(
+			context.Background(),
+			awsconfig.WithLogger(createAWSLogAdapter(log)),
+			awsconfig.WithEndpointResolver(createAWSEndpointResolver(cfg.SQSEndpointURL)),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error creating AWS config: %w", err)
+		}
+
+		return messaging.NewSQSQueue(messaging.NewSQSQueueOptions{
+			Config:   awsConfig,
+			Log:      log,
+			Name:     cfg.Name,
+			WaitTime: cfg.WaitTime,
+		}), nil
+	case "memory":
+		return messaging.NewMemoryQueue(messaging.NewMemoryQueueOptions{
+			Log:               log,
+			Size:              cfg.Size,
+			VisibilityTimeout: cfg.VisibilityTimeout,
+			WaitTime:          cfg.WaitTime,
+		}), nil
+	case "postgres":
+		return messaging.NewPostgresQueue(messaging.NewPostgresQueueOptions{
+			DB:                database.DB(),
+			Log:               log,
+			Name:              cfg.Name,
+			PollInterval:      cfg.PollInterval,
+			VisibilityTimeout: cfg.VisibilityTimeout,
+			WaitTime:          cfg.WaitTime,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown queue backend %q", cfg.Backend)
+	}
+}
+
+// createEmailProviders creates the configured providers, in failover order.
+func createEmailProviders(log *zap.Logger, cfg config.EmailConfig) ([]messaging.Provider, error) {
+	var providers []messaging.Provider
+
+	for _, name := range cfg.Providers {
+		transport, err := createEmailTransport(log, name, cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		limits := cfg.Limits[name]
+		providers = append(providers, messaging.Provider{
+			Name:             name,
+			Transport:        transport,
+			RateLimit:        limits.RateLimit,
+			Burst:            limits.Burst,
+			DailyQuota:       limits.DailyQuota,
+			BreakerThreshold: cfg.BreakerThreshold,
+			BreakerCooldown:  cfg.BreakerCooldown,
+		})
+	}
+
+	return providers, nil
+}
+
+func createEmailTransport(log *zap.Logger, name string, cfg config.EmailConfig) (messaging.Transport, error) {
+	switch name {
+	case "postmark":
+		return messaging.NewPostmarkTransport(messaging.NewPostmarkTransportOptions{
+			BaseURL: cfg.Postmark.BaseURL,
+			Log:     log,
+			Timeout: cfg.Postmark.Timeout,
+			Token:   cfg.Postmark.Token,
+		}), nil
+	case "smtp":
+		return messaging.NewSMTPTransport(messaging.NewSMTPTransportOptions{
+			Host:          cfg.SMTP.Host,
+			InsecureNoTLS: cfg.SMTP.InsecureNoTLS,
+			Log:           log,
+			Password:      cfg.SMTP.Password,
+			Port:          cfg.SMTP.Port,
+			Timeout:       cfg.SMTP.Timeout,
+			Username:      cfg.SMTP.Username,
+		}), nil
+	case "mailbox":
+		return messaging.NewMailboxTransport(messaging.NewMailboxTransportOptions{
+			Dir: cfg.MailboxDir,
+			Log: log,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown email transport %q", name)
+	}
 }
 
-func createEmailer(log *zap.Logger, host string, port int) *messaging.Emailer {
+func createEmailer(log *zap.Logger, cfg *config.Config, providers []messaging.Provider, event messaging.EventInfo, templates *messaging.Templates, deliveries storage.Storage) *messaging.Emailer {
 	return messaging.NewEmailer(messaging.NewEmailerOptions{
-		BaseURL:                   env.GetStringOrDefault("BASE_URL", fmt.Sprintf("http://%v:%v", host, port)),
+		APIURL:                    cfg.APIURL,
+		BaseURL:                   cfg.BaseURL,
+		Deliveries:                deliveries,
+		Event:                     event,
 		Log:                       log,
-		MarketingEmailName:        env.GetStringOrDefault("MARKETING_EMAIL_NAME", "Forum Regional de Cybersecurité de la CEMAC"),
-		MarketingEmailAddress:     env.GetStringOrDefault("MARKETING_EMAIL_ADDRESS", "bot@frcc.example.com"),
-		Token:                     env.GetStringOrDefault("POSTMARK_TOKEN", ""),
-		TransactionalEmailName:    env.GetStringOrDefault("TRANSACTIONAL_EMAIL_NAME", "Forum Regional de Cybersecurité de la CEMAC"),
-		TransactionalEmailAddress: env.GetStringOrDefault("TRANSACTIONAL_EMAIL_ADDRESS", "bot@frcc.example.com"),
+		MarketingEmailName:        cfg.Email.MarketingName,
+		MarketingEmailAddress:     cfg.Email.MarketingAddress,
+		TransactionalEmailName:    cfg.Email.TransactionalName,
+		TransactionalEmailAddress: cfg.Email.TransactionalAddress,
+		Providers:                 providers,
+		Templates:                 templates,
+		UnsubscribeKey:            cfg.UnsubscribeKey(),
 	})
 }
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"cyberix.fr/frcc/config"
+	"cyberix.fr/frcc/logging"
+	"cyberix.fr/frcc/storage"
+	"go.uber.org/zap"
+)
+
+const migrateUsage = "usage: server migrate up | down [steps] | status"
+
+// migrate applies, reverts or lists the migrations embedded in the binary, with the database
+// configured as for the server.
+func migrate(cfg *config.Config, args []string) int {
+	log, err := createLogger(cfg.LogEnv)
+	if err != nil {
+		fmt.Println("Error setting up the logger: ", err)
+		return 1
+	}
+	log = logging.Redact(log)
+
+	defer func() {
+		_ = log.Sync()
+	}()
+
+	if len(args) == 0 {
+		fmt.Println(migrateUsage)
+		return 2
+	}
+
+	database := createDatabase(log, cfg.DB)
+	if err := database.Connect(); err != nil {
+		log.Info("Error connecting to database", zap.Error(err))
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	switch args[0] {
+	case "up":
+		applied, err := database.MigrateUp(ctx)
+		if err != nil {
+			log.Info("Error migrating up", zap.Error(err))
+			return 1
+		}
+		fmt.Printf("Applied %v migrations\n", len(applied))
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps <= 0 {
+				fmt.Println(migrateUsage)
+				return 2
+			}
+		}
+
+		reverted, err := database.MigrateDown(ctx, steps)
+		if err != nil {
+			log.Info("Error migrating down", zap.Error(err))
+			return 1
+		}
+		fmt.Printf("Reverted %v migrations\n", len(reverted))
+
+	case "status":
+		if err := printMigrationStatus(ctx, database); err != nil {
+			log.Info("Error getting migration status", zap.Error(err))
+			return 1
+		}
+
+	default:
+		fmt.Println(migrateUsage)
+		return 2
+	}
+
+	return 0
+}
+
+func printMigrationStatus(ctx context.Context, database *storage.Database) error {
+	migrations, err := storage.Migrations()
+	if err != nil {
+		return err
+	}
+
+	version, dirty, err := database.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	latest, err := storage.LatestMigrationVersion()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Schema version %v, code expects %v", version, latest)
+	if dirty {
+		fmt.Print(" (dirty)")
+	}
+	fmt.Println()
+
+	for _, m := range migrations {
+		state := "pending"
+		if m.Version <= version {
+			state = "applied"
+		}
+		fmt.Printf("%06d %-50s %v\n", m.Version, m.Name, state)
+	}
+
+	return nil
+}
@@ -0,0 +1,517 @@
+package config
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	EnvironmentLocal      = "local"
+	EnvironmentStaging    = "staging"
+	EnvironmentProduction = "production"
+)
+
+// Config is the configuration of the api, read from an optional YAML file and from the
+// environment variables, which take precedence over the file.
+type Config struct {
+	// Environment is local, staging or production, and selects the defaults and the checks. It is
+	// production when not set, local being opt-in.
+	Environment string `yaml:"environment"`
+	// Demo keeps the data and the queue in memory, and is only set by the -demo flag.
+	Demo   bool   `yaml:"-"`
+	LogEnv string `yaml:"log_env"`
+	Host   string `yaml:"host"`
+	Port   int    `yaml:"port"`
+	// APIURL and BaseURL are the public URLs of the api and of the links in emails, the api itself by default.
+	APIURL  string `yaml:"api_url"`
+	BaseURL string `yaml:"base_url"`
+	Website string `yaml:"website"`
+	// AdminToken is the bearer token of the admin routes and of /metrics, both disabled without it.
+	AdminToken string `yaml:"admin_token"`
+	// JWTSecret signs the sessions and the calendar tokens, and the unsubscribe tokens with a key
+	// derived from it. A random one is generated in local when none is set, so that sessions do
+	// not survive a restart.
+	JWTSecret string `yaml:"jwt_secret"`
+	// PayloadEncryptionKey is a base64 encoded 32 bytes key, which encrypts the sensitive values
+	// of the outbox and queue payloads. It is required outside local.
+	PayloadEncryptionKey string `yaml:"payload_encryption_key"`
+
+	Tracing  TracingConfig  `yaml:"tracing"`
+	DB       DBConfig       `yaml:"db"`
+	Queue    QueueConfig    `yaml:"queue"`
+	Email    EmailConfig    `yaml:"email"`
+	Event    EventConfig    `yaml:"event"`
+	Jobs     JobsConfig     `yaml:"jobs"`
+	Webhooks WebhooksConfig `yaml:"webhooks"`
+	CORS     CORSConfig     `yaml:"cors"`
+	Cookie   CookieConfig   `yaml:"cookie"`
+}
+
+type TracingConfig struct {
+	// Exporter is otlp or stdout, tracing being disabled when empty. The otlp exporter reads its
+	// endpoint from the standard OTEL_EXPORTER_OTLP_* variables.
+	Exporter    string `yaml:"exporter"`
+	ServiceName string `yaml:"service_name"`
+}
+
+type DBConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Name     string `yaml:"name"`
+	SSLMode  string `yaml:"ssl_mode"`
+	// RequireSchemaVersion refuses to start on a schema behind or ahead of the code.
+	RequireSchemaVersion bool `yaml:"require_schema_version"`
+}
+
+type QueueConfig struct {
+	// Backend is sqs, memory or postgres, always memory in demo mode.
+	Backend           string        `yaml:"backend"`
+	Name              string        `yaml:"name"`
+	WaitTime          time.Duration `yaml:"wait_time"`
+	VisibilityTimeout time.Duration `yaml:"visibility_timeout"`
+	Size              int           `yaml:"size"`
+	PollInterval      time.Duration `yaml:"poll_interval"`
+	SQSEndpointURL    string        `yaml:"sqs_endpoint_url"`
+}
+
+type EmailConfig struct {
+	// Providers are postmark, smtp or mailbox, in failover order.
+	Providers []string `yaml:"providers"`
+	// Limits are the limits of each provider, by name.
+	Limits               map[string]EmailLimitsConfig `yaml:"limits"`
+	BreakerThreshold     int                          `yaml:"breaker_threshold"`
+	BreakerCooldown      time.Duration                `yaml:"breaker_cooldown"`
+	MarketingName        string                       `yaml:"marketing_name"`
+	MarketingAddress     string                       `yaml:"marketing_address"`
+	TransactionalName    string                       `yaml:"transactional_name"`
+	TransactionalAddress string                       `yaml:"transactional_address"`
+	Postmark             PostmarkConfig               `yaml:"postmark"`
+	SMTP                 SMTPConfig                   `yaml:"smtp"`
+	MailboxDir           string                       `yaml:"mailbox_dir"`
+}
+
+type EmailLimitsConfig struct {
+	// RateLimit is in emails per second, unlimited when 0.
+	RateLimit float64 `yaml:"rate_limit"`
+	Burst     int     `yaml:"burst"`
+	// DailyQuota is unlimited when 0.
+	DailyQuota int `yaml:"daily_quota"`
+}
+
+type PostmarkConfig struct {
+	BaseURL string        `yaml:"base_url"`
+	Timeout time.Duration `yaml:"timeout"`
+	Token   string        `yaml:"token"`
+}
+
+type SMTPConfig struct {
+	Host          string        `yaml:"host"`
+	InsecureNoTLS bool          `yaml:"insecure_no_tls"`
+	Password      string        `yaml:"password"`
+	Port          int           `yaml:"port"`
+	Timeout       time.Duration `yaml:"timeout"`
+	Username      string        `yaml:"username"`
+}
+
+type EventConfig struct {
+	Name     string    `yaml:"name"`
+	Location string    `yaml:"location"`
+	Start    time.Time `yaml:"start"`
+	End      time.Time `yaml:"end"`
+}
+
+type JobsConfig struct {
+	MaxAttempts           int           `yaml:"max_attempts"`
+	CampaignBatchInterval time.Duration `yaml:"campaign_batch_interval"`
+	CampaignBatchSize     int           `yaml:"campaign_batch_size"`
+	SchedulerInterval     time.Duration `yaml:"scheduler_interval"`
+	OutboxBatchSize       int           `yaml:"outbox_batch_size"`
+	OutboxInterval        time.Duration `yaml:"outbox_interval"`
+}
+
+// WebhooksConfig are the credentials expected from email provider webhooks, which are disabled
+// when neither a username nor a secret is set.
+type WebhooksConfig struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	Secret   string `yaml:"secret"`
+}
+
+type CORSConfig struct {
+	// AllowedOrigins are the website, and the usual dev servers in local, when empty.
+	AllowedOrigins []string `yaml:"allowed_origins"`
+}
+
+type CookieConfig struct {
+	Domain string `yaml:"domain"`
+	// SameSite is lax, strict or none.
+	SameSite string        `yaml:"same_site"`
+	Secure   bool          `yaml:"secure"`
+	Lifetime time.Duration `yaml:"lifetime"`
+}
+
+// Load reads the YAML file at filename when given, then the environment variables, and validates
+// the result, reporting every invalid value at once.
+func Load(filename string, demo bool) (*Config, error) {
+	return load(filename, demo, nil, (*Config).Validate)
+}
+
+// LoadDatabase reads the configuration as Load does but only validates the values the migrate
+// subcommand uses, so that migrations can run before the rest of the configuration is deployed.
+func LoadDatabase(filename string) (*Config, error) {
+	return load(filename, false, isDatabaseVariable, (*Config).ValidateDatabase)
+}
+
+// load reads the configuration and validates it with validate, reporting the environment
+// variables which do not parse only when checked is nil or returns true for their name.
+func load(filename string, demo bool, checked func(name string) bool, validate func(*Config) error) (*Config, error) {
+	var content []byte
+	if filename != "" {
+		var err error
+		if content, err = os.ReadFile(filename); err != nil {
+			return nil, fmt.Errorf("error reading config file: %w", err)
+		}
+	}
+
+	// the environment selects the defaults, so it is known before reading the rest
+	var file struct {
+		Environment string `yaml:"environment"`
+	}
+	if err := yaml.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("error parsing config file %v: %w", filename, err)
+	}
+
+	environment := file.Environment
+	if v, ok := os.LookupEnv("APP_ENV"); ok {
+		environment = v
+	}
+
+	c := defaults(normalizeEnvironment(environment, demo), demo)
+
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("error parsing config file %v: %w", filename, err)
+	}
+
+	// the values which do not parse keep their default, so that the other checks still run
+	envErr := c.loadEnv(checked)
+
+	if err := c.complete(); err != nil {
+		return nil, err
+	}
+
+	if err := errors.Join(envErr, validate(c)); err != nil {
+		return nil, fmt.Errorf("error invalid config:\n%w", err)
+	}
+
+	return c, nil
+}
+
+func defaults(environment string, demo bool) *Config {
+	c := &Config{
+		Environment: environment,
+		Demo:        demo,
+		LogEnv:      "development",
+		Host:        "0.0.0.0",
+		Port:        8080,
+		Tracing: TracingConfig{
+			ServiceName: "frcc-api",
+		},
+		DB: DBConfig{
+			Host:    "localhost",
+			Port:    5432,
+			User:    "frcc",
+			Name:    "frcc",
+			SSLMode: "require",
+		},
+		Queue: QueueConfig{
+			Backend:           "sqs",
+			Name:              "jobs",
+			WaitTime:          20 * time.Second,
+			VisibilityTimeout: 30 * time.Second,
+			Size:              1024,
+			PollInterval:      time.Second,
+		},
+		Email: EmailConfig{
+			Providers:            []string{"postmark"},
+			BreakerThreshold:     5,
+			BreakerCooldown:      30 * time.Second,
+			MarketingName:        "Forum Regional de Cybersecurité de la CEMAC",
+			MarketingAddress:     "bot@frcc.example.com",
+			TransactionalName:    "Forum Regional de Cybersecurité de la CEMAC",
+			TransactionalAddress: "bot@frcc.example.com",
+			Postmark: PostmarkConfig{
+				BaseURL: "https://api.postmarkapp.com",
+				Timeout: 3 * time.Second,
+			},
+			SMTP: SMTPConfig{
+				Host:    "localhost",
+				Port:    587,
+				Timeout: 10 * time.Second,
+			},
+			MailboxDir: "mailbox",
+		},
+		Event: EventConfig{
+			Name:  "Forum Régional sur la Sécurité des Systèmes et Moyens de Paiement",
+			Start: time.Date(2025, 3, 5, 8, 0, 0, 0, time.UTC),
+			End:   time.Date(2025, 3, 7, 18, 0, 0, 0, time.UTC),
+		},
+		Jobs: JobsConfig{
+			MaxAttempts:           5,
+			CampaignBatchInterval: time.Minute,
+			CampaignBatchSize:     100,
+			SchedulerInterval:     10 * time.Second,
+			OutboxBatchSize:       50,
+			OutboxInterval:        time.Second,
+		},
+		Cookie: CookieConfig{
+			SameSite: "lax",
+			Secure:   true,
+			Lifetime: 24 * time.Hour,
+		},
+	}
+
+	if environment == EnvironmentLocal {
+		c.DB.Password = "123"
+		c.DB.SSLMode = "disable"
+		c.Cookie.Secure = false
+	}
+
+	if demo {
+		c.Email.Providers = []string{"mailbox"}
+	}
+
+	return c
+}
+
+// complete fills the values derived from others.
+func (c *Config) complete() error {
+	c.Environment = normalizeEnvironment(c.Environment, c.Demo)
+
+	if c.Demo {
+		c.Queue.Backend = "memory"
+	}
+
+	if c.APIURL == "" {
+		c.APIURL = fmt.Sprintf("http://%v:%v", c.Host, c.Port)
+	}
+	if c.BaseURL == "" {
+		c.BaseURL = fmt.Sprintf("http://%v:%v", c.Host, c.Port)
+	}
+
+	if len(c.CORS.AllowedOrigins) == 0 {
+		if c.Website != "" {
+			c.CORS.AllowedOrigins = append(c.CORS.AllowedOrigins, strings.TrimSuffix(c.Website, "/"))
+		}
+		if c.Environment == EnvironmentLocal {
+			c.CORS.AllowedOrigins = append(c.CORS.AllowedOrigins, "http://localhost:3000", "http://localhost:5173")
+		}
+	}
+
+	if c.JWTSecret == "" && c.Environment == EnvironmentLocal {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return fmt.Errorf("error generating a jwt secret: %w", err)
+		}
+		c.JWTSecret = hex.EncodeToString(secret)
+	}
+
+	return nil
+}
+
+// Validate checks every value, and the secrets required outside local.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, a ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, a...))
+		}
+	}
+
+	c.validateDatabase(check)
+	check(c.Port > 0 && c.Port < 65536, "PORT: %v is not a valid port", c.Port)
+	check(c.Tracing.Exporter == "" || c.Tracing.Exporter == "otlp" || c.Tracing.Exporter == "stdout",
+		"TRACING_EXPORTER: unknown exporter %q, expected otlp or stdout", c.Tracing.Exporter)
+
+	// secrets
+	check(c.JWTSecret != "", "JWT_SECRET: required outside local")
+	check(c.JWTSecret == "" || c.Environment == EnvironmentLocal || len(c.JWTSecret) >= 32, "JWT_SECRET: must be at least 32 characters outside local")
+	if key, err := c.PayloadKey(); err != nil {
+		errs = append(errs, fmt.Errorf("PAYLOAD_ENCRYPTION_KEY: %w", err))
+	} else {
+		check(len(key) > 0 || c.Environment == EnvironmentLocal, "PAYLOAD_ENCRYPTION_KEY: required outside local, otps would be stored in clear text")
+	}
+
+	check(slices.Contains([]string{"sqs", "memory", "postgres"}, c.Queue.Backend),
+		"QUEUE_BACKEND: unknown backend %q, expected sqs, memory or postgres", c.Queue.Backend)
+	check(c.Queue.Name != "", "QUEUE_NAME: required")
+	check(c.Queue.WaitTime > 0, "QUEUE_WAIT_TIME: must be positive")
+	check(c.Queue.Backend != "sqs" || c.Queue.WaitTime <= 20*time.Second, "QUEUE_WAIT_TIME: must be at most 20s with sqs")
+	check(c.Queue.VisibilityTimeout > 0, "QUEUE_VISIBILITY_TIMEOUT: must be positive")
+	check(c.Queue.Backend != "memory" || c.Queue.Size > 0, "QUEUE_SIZE: must be positive")
+	check(c.Queue.Backend != "postgres" || c.Queue.PollInterval > 0, "QUEUE_POLL_INTERVAL: must be positive")
+
+	check(len(c.Email.Providers) > 0, "EMAIL_PROVIDERS: at least one provider is required")
+	for i, name := range c.Email.Providers {
+		check(slices.Contains([]string{"postmark", "smtp", "mailbox"}, name),
+			"EMAIL_PROVIDERS: unknown provider %q, expected postmark, smtp or mailbox", name)
+		check(!slices.Contains(c.Email.Providers[:i], name), "EMAIL_PROVIDERS: %q is listed twice", name)
+
+		limits := c.Email.Limits[name]
+		prefix := strings.ToUpper(name)
+		check(limits.RateLimit >= 0, "%v_RATE_LIMIT: must not be negative", prefix)
+		check(limits.RateLimit == 0 || limits.Burst > 0, "%v_BURST: must be positive with a rate limit", prefix)
+		check(limits.DailyQuota >= 0, "%v_DAILY_QUOTA: must not be negative", prefix)
+	}
+	check(!slices.Contains(c.Email.Providers, "postmark") || c.Email.Postmark.Token != "" || c.Environment == EnvironmentLocal,
+		"POSTMARK_TOKEN: required outside local when postmark is a provider")
+	// the mailbox publishes every email, otps included, at /dev/mailbox without authentication
+	check(!slices.Contains(c.Email.Providers, "mailbox") || c.Environment == EnvironmentLocal || c.Demo,
+		"EMAIL_PROVIDERS: the mailbox provider is only allowed in local or in demo mode")
+	check(c.Email.BreakerThreshold > 0, "EMAIL_BREAKER_THRESHOLD: must be positive")
+
+	check(c.Event.End.After(c.Event.Start), "EVENT_END: must be after EVENT_START")
+
+	check(c.Jobs.MaxAttempts > 0, "JOB_MAX_ATTEMPTS: must be positive")
+	check(c.Jobs.CampaignBatchSize > 0 && c.Jobs.CampaignBatchInterval > 0, "CAMPAIGN_BATCH_SIZE and CAMPAIGN_BATCH_INTERVAL: must be positive")
+	check(c.Jobs.SchedulerInterval > 0, "SCHEDULER_INTERVAL: must be positive")
+	check(c.Jobs.OutboxBatchSize > 0 && c.Jobs.OutboxInterval > 0, "OUTBOX_BATCH_SIZE and OUTBOX_INTERVAL: must be positive")
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		if origin == "*" {
+			errs = append(errs, fmt.Errorf("CORS_ALLOWED_ORIGINS: the wildcard origin cannot be allowed with credentials"))
+			continue
+		}
+
+		u, err := url.Parse(origin)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && u.Path == "",
+			"CORS_ALLOWED_ORIGINS: invalid origin %q, expected scheme://host[:port]", origin)
+	}
+
+	sameSite, err := parseSameSite(c.Cookie.SameSite)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("COOKIE_SAME_SITE: %w", err))
+	}
+	check(sameSite != http.SameSiteNoneMode || c.Cookie.Secure, "COOKIE_SECURE: required by COOKIE_SAME_SITE=none")
+	check(c.Cookie.Secure || c.Environment == EnvironmentLocal, "COOKIE_SECURE: required outside local")
+	check(c.Cookie.Lifetime > 0, "COOKIE_LIFETIME: must be positive")
+
+	return errors.Join(errs...)
+}
+
+// ValidateDatabase checks the environment and the database values only, which is all the migrate
+// subcommand uses.
+func (c *Config) ValidateDatabase() error {
+	var errs []error
+	c.validateDatabase(func(ok bool, format string, a ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, a...))
+		}
+	})
+
+	return errors.Join(errs...)
+}
+
+func (c *Config) validateDatabase(check func(ok bool, format string, a ...any)) {
+	check(slices.Contains([]string{EnvironmentLocal, EnvironmentStaging, EnvironmentProduction}, c.Environment),
+		"APP_ENV: unknown environment %q, expected local, staging or production", c.Environment)
+
+	if !c.Demo {
+		check(c.DB.Host != "" && c.DB.Name != "" && c.DB.User != "", "DB_HOST, DB_NAME and DB_USER: required")
+		check(c.DB.Port > 0 && c.DB.Port < 65536, "DB_PORT: %v is not a valid port", c.DB.Port)
+		check(c.DB.Password != "" || c.Environment == EnvironmentLocal, "DB_PASSWORD: required outside local")
+		check(slices.Contains([]string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}, c.DB.SSLMode),
+			"DB_SSL_MODE: unknown mode %q", c.DB.SSLMode)
+	}
+}
+
+// isDatabaseVariable tells whether the environment variable is one ValidateDatabase depends on.
+func isDatabaseVariable(name string) bool {
+	return name == "APP_ENV" || name == "LOG_ENV" || strings.HasPrefix(name, "DB_")
+}
+
+// PayloadKey returns the decoded PayloadEncryptionKey, nil when not set.
+func (c *Config) PayloadKey() ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(c.PayloadEncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding base64: %w", err)
+	}
+
+	if len(key) != 0 && len(key) != 32 {
+		return nil, fmt.Errorf("error the key is %v bytes long, expected 32", len(key))
+	}
+
+	return key, nil
+}
+
+// UnsubscribeKey returns the key signing the unsubscribe tokens.
+func (c *Config) UnsubscribeKey() []byte {
+	return c.deriveKey("unsubscribe")
+}
+
+// CalendarKey returns the key signing the calendar feed tokens.
+func (c *Config) CalendarKey() []byte {
+	return c.deriveKey("calendar")
+}
+
+// deriveKey derives the key of purpose from JWTSecret as HKDF-Expand would for a single block,
+// so that a key is never the key of another token.
+func (c *Config) deriveKey(purpose string) []byte {
+	mac := hmac.New(sha256.New, []byte(c.JWTSecret))
+	mac.Write([]byte(purpose))
+	mac.Write([]byte{1})
+	return mac.Sum(nil)
+}
+
+// SameSiteMode returns the SameSite attribute of the session cookie.
+func (c CookieConfig) SameSiteMode() http.SameSite {
+	sameSite, _ := parseSameSite(c.SameSite)
+	return sameSite
+}
+
+func parseSameSite(value string) (http.SameSite, error) {
+	switch strings.ToLower(value) {
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	default:
+		return http.SameSiteDefaultMode, fmt.Errorf("unknown SameSite %q, expected lax, strict or none", value)
+	}
+}
+
+// normalizeEnvironment maps the development name used so far to local. An unset environment is
+// production, so that a missing APP_ENV never relaxes the checks, except in demo mode which is
+// local unless told otherwise.
+func normalizeEnvironment(environment string, demo bool) string {
+	switch {
+	case environment == "development":
+		return EnvironmentLocal
+	case environment == "" && demo:
+		return EnvironmentLocal
+	case environment == "":
+		return EnvironmentProduction
+	default:
+		return environment
+	}
+}
@@ -0,0 +1,165 @@
+package config
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"strings"
+	"testing"
+)
+
+// validProduction returns a production config with every required secret.
+func validProduction(t *testing.T) *Config {
+	t.Helper()
+
+	c := defaults(EnvironmentProduction, false)
+	c.Website = "https://frcc.example.com"
+	c.JWTSecret = strings.Repeat("s", 32)
+	c.PayloadEncryptionKey = base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	c.DB.Password = "password"
+	c.Email.Postmark.Token = "token"
+	if err := c.complete(); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestValidate(t *testing.T) {
+	if err := validProduction(t).Validate(); err != nil {
+		t.Fatalf("expected a valid production config, got %v", err)
+	}
+
+	tests := map[string]struct {
+		change   func(c *Config)
+		expected string
+	}{
+		"unknown environment": {func(c *Config) { c.Environment = "prod" }, "APP_ENV"},
+		"missing jwt secret":  {func(c *Config) { c.JWTSecret = "" }, "JWT_SECRET: required"},
+		"short jwt secret":    {func(c *Config) { c.JWTSecret = "short" }, "JWT_SECRET: must be at least 32"},
+		"missing payload key": {func(c *Config) { c.PayloadEncryptionKey = "" }, "PAYLOAD_ENCRYPTION_KEY: required"},
+		"short payload key": {func(c *Config) {
+			c.PayloadEncryptionKey = base64.StdEncoding.EncodeToString([]byte("short"))
+		}, "PAYLOAD_ENCRYPTION_KEY: error the key is 5 bytes long"},
+		"missing db password":    {func(c *Config) { c.DB.Password = "" }, "DB_PASSWORD"},
+		"unknown queue backend":  {func(c *Config) { c.Queue.Backend = "kafka" }, "QUEUE_BACKEND"},
+		"no queue wait time":     {func(c *Config) { c.Queue.WaitTime = 0 }, "QUEUE_WAIT_TIME: must be positive"},
+		"missing postmark token": {func(c *Config) { c.Email.Postmark.Token = "" }, "POSTMARK_TOKEN"},
+		"unknown provider":       {func(c *Config) { c.Email.Providers = []string{"sendgrid"} }, "unknown provider"},
+		"provider listed twice":  {func(c *Config) { c.Email.Providers = []string{"smtp", "smtp"} }, "listed twice"},
+		"mailbox provider":       {func(c *Config) { c.Email.Providers = []string{"mailbox"} }, "mailbox provider is only allowed"},
+		"rate limit without burst": {func(c *Config) {
+			c.Email.Limits = map[string]EmailLimitsConfig{"postmark": {RateLimit: 10}}
+		}, "POSTMARK_BURST"},
+		"event end before start": {func(c *Config) { c.Event.End = c.Event.Start }, "EVENT_END"},
+		"wildcard origin":        {func(c *Config) { c.CORS.AllowedOrigins = []string{"*"} }, "wildcard origin"},
+		"origin with path":       {func(c *Config) { c.CORS.AllowedOrigins = []string{"https://frcc.example.com/app"} }, "invalid origin"},
+		"unknown same site":      {func(c *Config) { c.Cookie.SameSite = "loose" }, "COOKIE_SAME_SITE"},
+		"insecure cookie":        {func(c *Config) { c.Cookie.Secure = false }, "COOKIE_SECURE: required outside local"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := validProduction(t)
+			test.change(c)
+
+			err := c.Validate()
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Fatalf("expected an error containing %q, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestValidateReportsEveryError(t *testing.T) {
+	c := validProduction(t)
+	c.JWTSecret = ""
+	c.DB.Password = ""
+
+	err := c.Validate()
+	if err == nil || !strings.Contains(err.Error(), "JWT_SECRET") || !strings.Contains(err.Error(), "DB_PASSWORD") {
+		t.Fatalf("expected both errors, got %v", err)
+	}
+}
+
+func TestValidateLocalAndDemo(t *testing.T) {
+	local := defaults(EnvironmentLocal, false)
+	if err := local.complete(); err != nil {
+		t.Fatal(err)
+	}
+	if err := local.Validate(); err != nil {
+		t.Fatalf("expected the local defaults to be valid, got %v", err)
+	}
+
+	demo := defaults(normalizeEnvironment("", true), true)
+	if err := demo.complete(); err != nil {
+		t.Fatal(err)
+	}
+	if err := demo.Validate(); err != nil {
+		t.Fatalf("expected the demo defaults to be valid, got %v", err)
+	}
+	if demo.Environment != EnvironmentLocal || demo.Queue.Backend != "memory" {
+		t.Fatalf("expected the demo to run locally on the memory queue, got %v and %v", demo.Environment, demo.Queue.Backend)
+	}
+}
+
+func TestLoadDefaultsToProduction(t *testing.T) {
+	t.Setenv("APP_ENV", "")
+	if err := os.Unsetenv("APP_ENV"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"JWT_SECRET", "DB_PASSWORD", "PAYLOAD_ENCRYPTION_KEY", "POSTMARK_TOKEN"} {
+		t.Setenv(name, "")
+	}
+
+	_, err := Load("", false)
+	if err == nil || !strings.Contains(err.Error(), "JWT_SECRET: required outside local") {
+		t.Fatalf("expected the production secrets to be required without APP_ENV, got %v", err)
+	}
+}
+
+func TestLoadDatabaseOnlyChecksTheDatabase(t *testing.T) {
+	t.Setenv("APP_ENV", "production")
+	t.Setenv("DB_PASSWORD", "password")
+	for _, name := range []string{"JWT_SECRET", "PAYLOAD_ENCRYPTION_KEY", "POSTMARK_TOKEN"} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("QUEUE_WAIT_TIME", "soon")
+
+	c, err := LoadDatabase("")
+	if err != nil {
+		t.Fatalf("expected the migrate config to load without the other settings, got %v", err)
+	}
+	if c.DB.Password != "password" {
+		t.Fatalf("expected the database config from the environment, got %+v", c.DB)
+	}
+
+	if _, err := Load("", false); err == nil {
+		t.Fatal("expected the server config to be invalid")
+	}
+
+	t.Setenv("DB_PORT", "postgres")
+	if _, err := LoadDatabase(""); err == nil || !strings.Contains(err.Error(), "DB_PORT") {
+		t.Fatalf("expected the invalid database port to be reported, got %v", err)
+	}
+}
+
+func TestCalendarKey(t *testing.T) {
+	c := &Config{JWTSecret: strings.Repeat("s", 32)}
+
+	key := c.CalendarKey()
+	if len(key) != 32 || bytes.Equal(key, []byte(c.JWTSecret)) || bytes.Equal(key, c.UnsubscribeKey()) {
+		t.Fatalf("expected a 32 bytes key distinct from the other keys, got %x", key)
+	}
+}
+
+func TestUnsubscribeKey(t *testing.T) {
+	c := &Config{JWTSecret: strings.Repeat("s", 32)}
+
+	key := c.UnsubscribeKey()
+	if len(key) != 32 || bytes.Equal(key, []byte(c.JWTSecret)) {
+		t.Fatalf("expected a 32 bytes key distinct from the jwt secret, got %x", key)
+	}
+	if !bytes.Equal(key, c.UnsubscribeKey()) {
+		t.Fatal("expected the key to be derived deterministically")
+	}
+}
@@ -0,0 +1,211 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// loadEnv overrides the configuration with the environment variables which are set, reporting
+// those which do not parse when checked is nil or returns true for their name.
+func (c *Config) loadEnv(checked func(name string) bool) error {
+	l := envLoader{checked: checked}
+
+	l.string("APP_ENV", &c.Environment)
+	l.string("LOG_ENV", &c.LogEnv)
+	l.string("HOST", &c.Host)
+	l.int("PORT", &c.Port)
+	l.string("API_URL", &c.APIURL)
+	l.string("BASE_URL", &c.BaseURL)
+	l.string("WEBSITE", &c.Website)
+	l.string("ADMIN_TOKEN", &c.AdminToken)
+	l.string("JWT_SECRET", &c.JWTSecret)
+	l.string("PAYLOAD_ENCRYPTION_KEY", &c.PayloadEncryptionKey)
+
+	l.string("TRACING_EXPORTER", &c.Tracing.Exporter)
+	l.string("TRACING_SERVICE_NAME", &c.Tracing.ServiceName)
+
+	l.string("DB_HOST", &c.DB.Host)
+	l.int("DB_PORT", &c.DB.Port)
+	l.string("DB_USER", &c.DB.User)
+	l.string("DB_PASSWORD", &c.DB.Password)
+	l.string("DB_NAME", &c.DB.Name)
+	l.string("DB_SSL_MODE", &c.DB.SSLMode)
+	l.bool("DB_REQUIRE_SCHEMA_VERSION", &c.DB.RequireSchemaVersion)
+
+	l.string("QUEUE_BACKEND", &c.Queue.Backend)
+	l.string("QUEUE_NAME", &c.Queue.Name)
+	l.duration("QUEUE_WAIT_TIME", &c.Queue.WaitTime)
+	l.duration("QUEUE_VISIBILITY_TIMEOUT", &c.Queue.VisibilityTimeout)
+	l.int("QUEUE_SIZE", &c.Queue.Size)
+	l.duration("QUEUE_POLL_INTERVAL", &c.Queue.PollInterval)
+	l.string("SQS_ENDPOINT_URL", &c.Queue.SQSEndpointURL)
+
+	l.list("EMAIL_PROVIDERS", &c.Email.Providers)
+	l.int("EMAIL_BREAKER_THRESHOLD", &c.Email.BreakerThreshold)
+	l.duration("EMAIL_BREAKER_COOLDOWN", &c.Email.BreakerCooldown)
+	l.string("MARKETING_EMAIL_NAME", &c.Email.MarketingName)
+	l.string("MARKETING_EMAIL_ADDRESS", &c.Email.MarketingAddress)
+	l.string("TRANSACTIONAL_EMAIL_NAME", &c.Email.TransactionalName)
+	l.string("TRANSACTIONAL_EMAIL_ADDRESS", &c.Email.TransactionalAddress)
+	l.string("POSTMARK_BASE_URL", &c.Email.Postmark.BaseURL)
+	l.duration("POSTMARK_TIMEOUT", &c.Email.Postmark.Timeout)
+	l.string("POSTMARK_TOKEN", &c.Email.Postmark.Token)
+	l.string("SMTP_HOST", &c.Email.SMTP.Host)
+	l.bool("SMTP_INSECURE_NO_TLS", &c.Email.SMTP.InsecureNoTLS)
+	l.string("SMTP_PASSWORD", &c.Email.SMTP.Password)
+	l.int("SMTP_PORT", &c.Email.SMTP.Port)
+	l.duration("SMTP_TIMEOUT", &c.Email.SMTP.Timeout)
+	l.string("SMTP_USERNAME", &c.Email.SMTP.Username)
+	l.string("MAILBOX_DIR", &c.Email.MailboxDir)
+
+	// each provider is limited by <NAME>_RATE_LIMIT (emails per second), <NAME>_BURST and <NAME>_DAILY_QUOTA
+	for _, name := range c.Email.Providers {
+		limits, ok := c.Email.Limits[name]
+		if !ok {
+			limits.Burst = 1
+		}
+
+		prefix := strings.ToUpper(name)
+		l.float(prefix+"_RATE_LIMIT", &limits.RateLimit)
+		l.int(prefix+"_BURST", &limits.Burst)
+		l.int(prefix+"_DAILY_QUOTA", &limits.DailyQuota)
+
+		if c.Email.Limits == nil {
+			c.Email.Limits = map[string]EmailLimitsConfig{}
+		}
+		c.Email.Limits[name] = limits
+	}
+
+	l.string("EVENT_NAME", &c.Event.Name)
+	l.string("EVENT_LOCATION", &c.Event.Location)
+	l.time("EVENT_START", &c.Event.Start)
+	l.time("EVENT_END", &c.Event.End)
+
+	l.int("JOB_MAX_ATTEMPTS", &c.Jobs.MaxAttempts)
+	l.duration("CAMPAIGN_BATCH_INTERVAL", &c.Jobs.CampaignBatchInterval)
+	l.int("CAMPAIGN_BATCH_SIZE", &c.Jobs.CampaignBatchSize)
+	l.duration("SCHEDULER_INTERVAL", &c.Jobs.SchedulerInterval)
+	l.int("OUTBOX_BATCH_SIZE", &c.Jobs.OutboxBatchSize)
+	l.duration("OUTBOX_INTERVAL", &c.Jobs.OutboxInterval)
+
+	l.string("WEBHOOK_USERNAME", &c.Webhooks.Username)
+	l.string("WEBHOOK_PASSWORD", &c.Webhooks.Password)
+	l.string("WEBHOOK_SECRET", &c.Webhooks.Secret)
+
+	l.list("CORS_ALLOWED_ORIGINS", &c.CORS.AllowedOrigins)
+	l.string("COOKIE_DOMAIN", &c.Cookie.Domain)
+	l.string("COOKIE_SAME_SITE", &c.Cookie.SameSite)
+	l.bool("COOKIE_SECURE", &c.Cookie.Secure)
+	l.duration("COOKIE_LIFETIME", &c.Cookie.Lifetime)
+
+	return errors.Join(l.errs...)
+}
+
+// envLoader reads environment variables into typed values, keeping the parsing errors to report
+// them all at once instead of falling back to the defaults. Values other than strings are ignored
+// when empty.
+type envLoader struct {
+	checked func(name string) bool
+	errs    []error
+}
+
+func (l *envLoader) fail(name, v string, err error) {
+	if l.checked != nil && !l.checked(name) {
+		return
+	}
+	l.errs = append(l.errs, fmt.Errorf("%v: invalid value %q: %w", name, v, err))
+}
+
+func (l *envLoader) string(name string, out *string) {
+	if v, ok := os.LookupEnv(name); ok {
+		*out = v
+	}
+}
+
+// list reads a comma separated list.
+func (l *envLoader) list(name string, out *[]string) {
+	v, ok := os.LookupEnv(name)
+	if !ok || v == "" {
+		return
+	}
+
+	*out = nil
+	for _, item := range strings.Split(v, ",") {
+		*out = append(*out, strings.TrimSpace(item))
+	}
+}
+
+func (l *envLoader) int(name string, out *int) {
+	v, ok := os.LookupEnv(name)
+	if !ok || v == "" {
+		return
+	}
+
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		l.fail(name, v, err)
+		return
+	}
+	*out = i
+}
+
+func (l *envLoader) float(name string, out *float64) {
+	v, ok := os.LookupEnv(name)
+	if !ok || v == "" {
+		return
+	}
+
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		l.fail(name, v, err)
+		return
+	}
+	*out = f
+}
+
+func (l *envLoader) bool(name string, out *bool) {
+	v, ok := os.LookupEnv(name)
+	if !ok || v == "" {
+		return
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		l.fail(name, v, err)
+		return
+	}
+	*out = b
+}
+
+func (l *envLoader) duration(name string, out *time.Duration) {
+	v, ok := os.LookupEnv(name)
+	if !ok || v == "" {
+		return
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		l.fail(name, v, err)
+		return
+	}
+	*out = d
+}
+
+// time reads an RFC 3339 time.
+func (l *envLoader) time(name string, out *time.Time) {
+	v, ok := os.LookupEnv(name)
+	if !ok || v == "" {
+		return
+	}
+
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		l.fail(name, v, err)
+		return
+	}
+	*out = t
+}
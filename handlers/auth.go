@@ -2,30 +2,30 @@ package handlers
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
-	"log"
+	"errors"
 	"math/rand"
 	"net/http"
-	"os"
+	"strconv"
 	"time"
 
 	"fmt"
 
+	"cyberix.fr/frcc/logging"
+	"cyberix.fr/frcc/metrics"
 	"cyberix.fr/frcc/models"
 	"cyberix.fr/frcc/storage"
 	"github.com/go-chi/chi/v5"
 	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
 )
 
 type iRegister interface {
-	GetUserByEmailOrPhone(ctx context.Context, arg storage.GetUserByEmailOrPhoneParams) (*models.User, error)
-	CreateUser(ctx context.Context, arg storage.CreateUserParams) (*models.User, error)
-	SetCurrentOtp(ctx context.Context, arg storage.SetCurrentOtpParams) error
+	ExecTxWithOptions(ctx context.Context, opts storage.TxOptions, fn func(storage.Querier) error) error
 }
 
-type iQueue interface {
-	Send(ctx context.Context, arg models.Message) error
-}
+var errUserAlreadyExists = errors.New("user already exists")
 
 type RegisterRequest struct {
 	FirstName    string `json:"first_name,omitempty"`
@@ -34,12 +34,18 @@ type RegisterRequest struct {
 	Quality      string `json:"quality,omitempty"`
 	Phone        string `json:"phone,omitempty"`
 	Organization string `json:"organization,omitempty"`
+	// Locale is the language of the emails, taken from the Accept-Language header when empty.
+	Locale string `json:"locale,omitempty"`
+	// MarketingConsent is the opt-in to campaign emails, ConsentVersion identifying the consent
+	// text shown next to it.
+	MarketingConsent bool   `json:"marketing_consent,omitempty"`
+	ConsentVersion   string `json:"consent_version,omitempty"`
 }
 
 type RegisterResponse struct {
 }
 
-func (appHandler *AppHandler) Register(mux chi.Router, db iRegister, q iQueue) {
+func (appHandler *AppHandler) Register(mux chi.Router, db iRegister) {
 	mux.Post("/register", func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 
@@ -50,42 +56,20 @@ func (appHandler *AppHandler) Register(mux chi.Router, db iRegister, q iQueue) {
 			return
 		}
 
-		// check if user already exists
-		user, err := db.GetUserByEmailOrPhone(ctx, storage.GetUserByEmailOrPhoneParams{
-			Email: input.Email,
-			Phone: input.Phone,
-		})
-		if err != nil {
-			http.Error(w, fmt.Errorf("error checking if user already exists: %v", err).Error(), http.StatusBadRequest)
-			return
-		}
-
-		// if user exists, stop and return error
-		if user != nil {
-			http.Error(w, fmt.Errorf("error user with email/phone already exists").Error(), http.StatusBadRequest)
+		if input.MarketingConsent && input.ConsentVersion == "" {
+			localizedError(w, r, http.StatusBadRequest, msgConsentVersionRequired)
 			return
 		}
 
 		token, err := createSecret()
 		if err != nil {
-			http.Error(w, fmt.Errorf("error creating token: %v", err).Error(), http.StatusBadRequest)
+			localizedError(w, r, http.StatusBadRequest, msgCreatingToken, err)
 			return
 		}
 
-		// continue the registration
-		user, err = db.CreateUser(ctx, storage.CreateUserParams{
-			FirstName:    input.FirstName,
-			LastName:     input.LastName,
-			Email:        input.Email,
-			Quality:      input.Quality,
-			Phone:        input.Phone,
-			Organization: input.Organization,
-
-			ConfirmationToken: token,
-		})
-		if err != nil {
-			http.Error(w, fmt.Errorf("error creating the new users: %w", err).Error(), http.StatusBadRequest)
-			return
+		locale := requestLocale(r)
+		if input.Locale != "" {
+			locale = models.ParseLocale(input.Locale)
 		}
 
 		otp := createOtp()
@@ -93,44 +77,119 @@ func (appHandler *AppHandler) Register(mux chi.Router, db iRegister, q iQueue) {
 		duration := 2*time.Minute + 30*time.Second
 		otpValidity := time.Now().UTC().Add(duration)
 
-		err = db.SetCurrentOtp(ctx, storage.SetCurrentOtpParams{
-			CurrentOtp:             otp,
-			CurrentOtpValidityTime: otpValidity,
-			Email:                  input.Email,
+		// remind the user to confirm the registration if still pending after a day
+		reminderKey := fmt.Sprintf("registration_reminder:%s", input.Email)
+
+		// the otp is sealed before being written to the outbox, so that it is not stored in clear text
+		otpMessage, err := appHandler.payloadCipher.Seal(models.Message{
+			"job":    "otp_email",
+			"email":  input.Email,
+			"locale": locale.String(),
+			"name":   fmt.Sprintf("%s %s", input.FirstName, input.LastName),
+			"otp":    otp,
 		})
 		if err != nil {
-			http.Error(w, fmt.Errorf("error updating current otp: %v", err).Error(), http.StatusBadRequest)
+			localizedError(w, r, http.StatusInternalServerError, msgCreatingUser, err)
 			return
 		}
 
-		// send email
-		err = q.Send(ctx, models.Message{
-			"job":   "otp_email",
-			"email": input.Email,
-			"name":  fmt.Sprintf("%s %s", user.FirstName, user.LastName),
-			"otp":   otp,
+		// the user is checked and created in a serializable transaction, so that two concurrent
+		// registrations with the same email or phone conflict, the second one finding the first user
+		// when retried. The otp email is enqueued through the outbox.
+		var user *models.User
+		err = db.ExecTxWithOptions(ctx, storage.TxOptions{
+			Isolation:  sql.LevelSerializable,
+			MaxRetries: 3,
+		}, func(q storage.Querier) error {
+			existing, err := q.GetUserByEmailOrPhone(ctx, storage.GetUserByEmailOrPhoneParams{
+				Email: input.Email,
+				Phone: input.Phone,
+			})
+			if err != nil {
+				return fmt.Errorf("error checking if user already exists: %w", err)
+			}
+
+			if existing != nil {
+				return errUserAlreadyExists
+			}
+
+			user, err = q.CreateUser(ctx, storage.CreateUserParams{
+				FirstName:    input.FirstName,
+				LastName:     input.LastName,
+				Email:        input.Email,
+				Quality:      input.Quality,
+				Phone:        input.Phone,
+				Organization: input.Organization,
+
+				ConfirmationToken: token,
+				Locale:            locale,
+			})
+			if err != nil {
+				return err
+			}
+
+			err = q.SetCurrentOtp(ctx, storage.SetCurrentOtpParams{
+				CurrentOtp:             otp,
+				CurrentOtpValidityTime: otpValidity,
+				Email:                  input.Email,
+			})
+			if err != nil {
+				return err
+			}
+
+			_, err = q.CreateOutboxMessage(ctx, otpMessage)
+			if err != nil {
+				return err
+			}
+
+			err = q.CreateScheduledJob(ctx, storage.CreateScheduledJobParams{
+				Key: &reminderKey,
+				Payload: models.Message{
+					"job":   "registration_reminder_email",
+					"email": input.Email,
+				},
+				RunAt: time.Now().UTC().Add(24 * time.Hour),
+			})
+			if err != nil {
+				return err
+			}
+
+			// a refusal is recorded too, as proof the user was asked
+			_, err = q.CreateMarketingConsent(ctx, storage.CreateMarketingConsentParams{
+				UserID:      user.ID,
+				Granted:     input.MarketingConsent,
+				Source:      models.MarketingConsentSourceRegistration,
+				TextVersion: input.ConsentVersion,
+			})
+			return err
 		})
+		if errors.Is(err, errUserAlreadyExists) {
+			localizedError(w, r, http.StatusBadRequest, msgUserAlreadyExists)
+			return
+		}
 		if err != nil {
-			http.Error(w, fmt.Errorf("error adding mail into queue: %v", err).Error(), http.StatusBadRequest)
+			localizedError(w, r, http.StatusBadRequest, msgCreatingUser, err)
 			return
 		}
+		logging.SetUserID(ctx, strconv.Itoa(int(user.ID)))
+		metrics.RegistrationFunnel.WithLabelValues(metrics.FunnelRegistered).Inc()
 
 		// return ok
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
 		if err := json.NewEncoder(w).Encode(true); err != nil {
-			http.Error(w, "error encoding the result", http.StatusBadRequest)
+			localizedError(w, r, http.StatusBadRequest, msgEncodingResult)
 			return
 		}
 	})
 }
 
 type iRegisterConfirm interface {
-	ConfirmRegister(ctx context.Context, token string) (*models.User, error)
+	ConfirmRegisterTx(ctx context.Context, arg storage.ConfirmRegisterTxParams) (*models.User, error)
 	GetUserByEmailOrPhone(ctx context.Context, arg storage.GetUserByEmailOrPhoneParams) (*models.User, error)
 }
 
-func (appHandler *AppHandler) RegisterConfirm(mux chi.Router, db iRegisterConfirm, q iQueue) {
+func (appHandler *AppHandler) RegisterConfirm(mux chi.Router, db iRegisterConfirm) {
 	mux.Post("/register/confirm", func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 
@@ -147,56 +206,47 @@ func (appHandler *AppHandler) RegisterConfirm(mux chi.Router, db iRegisterConfir
 			Phone: input.Email,
 		})
 		if err != nil {
-			http.Error(w, fmt.Errorf("error checking if user already exists: %v", err).Error(), http.StatusBadRequest)
+			localizedError(w, r, http.StatusBadRequest, msgCheckingUser, err)
 			return
 		}
 
 		// if user exists, stop and return error
 		if user == nil {
-			http.Error(w, fmt.Errorf("error user with email/phone does not exists").Error(), http.StatusBadRequest)
+			localizedError(w, r, http.StatusBadRequest, msgUserDoesNotExist)
 			return
 		}
+		logging.SetUserID(ctx, strconv.Itoa(int(user.ID)))
 
 		if !time.Now().UTC().Before(*user.CurrentOtpValidityTime) {
-			http.Error(w, fmt.Errorf("error otp has expired").Error(), http.StatusBadRequest)
+			localizedError(w, r, http.StatusBadRequest, msgOtpExpired)
 			return
 		}
 
 		if input.Otp != *user.CurrentOtp {
-			http.Error(w, fmt.Errorf("error wrong otp").Error(), http.StatusBadRequest)
+			localizedError(w, r, http.StatusBadRequest, msgWrongOtp)
 			return
 		}
 
-		// token := r.FormValue("token")
-
-		_, err = db.ConfirmRegister(ctx, user.Email)
-		if err != nil {
-			log.Println("confirm-register-error", err)
-			http.Error(w, "error saving email address confirmation", http.StatusBadRequest)
-			return
-		}
-		// if user == nil {
-		// 	http.Error(w, "error not user associated to this token", http.StatusBadRequest)
-		// 	return
-		// }
-
-		err = q.Send(
-			ctx,
-			models.Message{
-				"job":   "welcome_email",
-				"email": user.Email,
-				"name":  fmt.Sprintf("%s %s", user.FirstName, user.LastName),
+		_, err = db.ConfirmRegisterTx(ctx, storage.ConfirmRegisterTxParams{
+			ConfirmationToken: user.ConfirmationToken,
+			Message: models.Message{
+				"job":    "welcome_email",
+				"email":  user.Email,
+				"locale": user.Locale.String(),
+				"name":   fmt.Sprintf("%s %s", user.FirstName, user.LastName),
 			},
-		)
+		})
 		if err != nil {
-			http.Error(w, "error saving email address confirmation", http.StatusBadRequest)
+			logging.FromContext(ctx).Info("Error confirming registration", zap.Error(err), logging.Email("email", user.Email))
+			localizedError(w, r, http.StatusBadRequest, msgConfirmingRegistration)
 			return
 		}
+		metrics.RegistrationFunnel.WithLabelValues(metrics.FunnelConfirmed).Inc()
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
 		if err := json.NewEncoder(w).Encode(true); err != nil {
-			http.Error(w, "error encoding the result", http.StatusBadRequest)
+			localizedError(w, r, http.StatusBadRequest, msgEncodingResult)
 			return
 		}
 	})
@@ -204,14 +254,15 @@ func (appHandler *AppHandler) RegisterConfirm(mux chi.Router, db iRegisterConfir
 
 type iLoginer interface {
 	GetUserByEmailOrPhone(ctx context.Context, arg storage.GetUserByEmailOrPhoneParams) (*models.User, error)
-	SetCurrentOtp(ctx context.Context, arg storage.SetCurrentOtpParams) error
+	GetEmailSuppression(ctx context.Context, email string) (*models.EmailSuppression, error)
+	SetCurrentOtpTx(ctx context.Context, arg storage.SetCurrentOtpTxParams) error
 }
 
 type LoginRequest struct {
 	Email string `json:"email,omitempty"`
 }
 
-func (appHandler *AppHandler) Login(mux chi.Router, db iLoginer, q iQueue) {
+func (appHandler *AppHandler) Login(mux chi.Router, db iLoginer) {
 	mux.Post("/login", func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 
@@ -228,18 +279,35 @@ func (appHandler *AppHandler) Login(mux chi.Router, db iLoginer, q iQueue) {
 			Phone: input.Email,
 		})
 		if err != nil {
-			http.Error(w, fmt.Errorf("error checking if user already exists: %v", err).Error(), http.StatusBadRequest)
+			localizedError(w, r, http.StatusBadRequest, msgCheckingUser, err)
 			return
 		}
 
 		// if user exists, stop and return error
 		if user == nil {
-			http.Error(w, fmt.Errorf("error user with email/phone does not exists").Error(), http.StatusBadRequest)
+			localizedError(w, r, http.StatusBadRequest, msgUserDoesNotExist)
 			return
 		}
+		logging.SetUserID(ctx, strconv.Itoa(int(user.ID)))
 
 		if !user.ConfirmedAccount {
-			http.Error(w, fmt.Errorf("sorry kindly confirmed your account").Error(), http.StatusBadRequest)
+			localizedError(w, r, http.StatusBadRequest, msgAccountNotConfirmed)
+			return
+		}
+
+		// the otp would never arrive, tell the user instead of letting them retry forever
+		suppression, err := db.GetEmailSuppression(ctx, user.Email)
+		if err != nil {
+			localizedError(w, r, http.StatusInternalServerError, msgCheckingSuppression, err)
+			return
+		}
+
+		if suppression != nil {
+			key := msgEmailSuppressed
+			if suppression.Reason == models.EmailSuppressionReasonHardBounce {
+				key = msgEmailBouncing
+			}
+			localizedError(w, r, http.StatusUnprocessableEntity, key)
 			return
 		}
 
@@ -248,31 +316,36 @@ func (appHandler *AppHandler) Login(mux chi.Router, db iLoginer, q iQueue) {
 		duration := 2*time.Minute + 30*time.Second
 		otpValidity := time.Now().UTC().Add(duration)
 
-		err = db.SetCurrentOtp(ctx, storage.SetCurrentOtpParams{
-			CurrentOtp:             otp,
-			CurrentOtpValidityTime: otpValidity,
-			Email:                  input.Email,
+		// the otp email is enqueued through the outbox, with the otp sealed
+		otpMessage, err := appHandler.payloadCipher.Seal(models.Message{
+			"job":    "otp_email",
+			"email":  input.Email,
+			"locale": user.Locale.String(),
+			"name":   fmt.Sprintf("%s %s", user.FirstName, user.LastName),
+			"otp":    otp,
 		})
 		if err != nil {
-			http.Error(w, fmt.Errorf("error updating current otp: %v", err).Error(), http.StatusBadRequest)
+			localizedError(w, r, http.StatusInternalServerError, msgUpdatingOtp, err)
 			return
 		}
 
-		// send email
-		err = q.Send(ctx, models.Message{
-			"job":   "otp_email",
-			"email": input.Email,
-			"otp":   otp,
+		err = db.SetCurrentOtpTx(ctx, storage.SetCurrentOtpTxParams{
+			SetCurrentOtpParams: storage.SetCurrentOtpParams{
+				CurrentOtp:             otp,
+				CurrentOtpValidityTime: otpValidity,
+				Email:                  input.Email,
+			},
+			Message: otpMessage,
 		})
 		if err != nil {
-			http.Error(w, fmt.Errorf("error adding mail into queue: %v", err).Error(), http.StatusBadRequest)
+			localizedError(w, r, http.StatusBadRequest, msgUpdatingOtp, err)
 			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
 		if err := json.NewEncoder(w).Encode(true); err != nil {
-			http.Error(w, "error encoding the result", http.StatusBadRequest)
+			localizedError(w, r, http.StatusBadRequest, msgEncodingResult)
 			return
 		}
 	})
@@ -282,12 +355,25 @@ type iOtper interface {
 	GetUserByEmailOrPhone(ctx context.Context, arg storage.GetUserByEmailOrPhoneParams) (*models.User, error)
 }
 
+// SessionCookieName is the cookie holding the session set by /auth/otp.
+const SessionCookieName = "jwt"
+
+// SessionCookie is the policy of the session cookie, which differs between local, staging and production.
+type SessionCookie struct {
+	// Domain shares the cookie with the subdomains of the website when set, else it is host-only.
+	Domain   string
+	Lifetime time.Duration
+	SameSite http.SameSite
+	// Secure must be set whenever the api is served over https, and is required by SameSite=None.
+	Secure bool
+}
+
 type OtpRequest struct {
 	Email string `json:"email,omitempty"`
 	Otp   string `json:"otp,omitempty"`
 }
 
-func (appHandler *AppHandler) Otp(mux chi.Router, db iOtper) {
+func (appHandler *AppHandler) Otp(mux chi.Router, db iOtper, cookie SessionCookie) {
 	mux.Post("/otp", func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 
@@ -304,52 +390,54 @@ func (appHandler *AppHandler) Otp(mux chi.Router, db iOtper) {
 			Phone: input.Email,
 		})
 		if err != nil {
-			http.Error(w, fmt.Errorf("error checking if user already exists: %v", err).Error(), http.StatusBadRequest)
+			localizedError(w, r, http.StatusBadRequest, msgCheckingUser, err)
 			return
 		}
 
 		// if user exists, stop and return error
 		if user == nil {
-			http.Error(w, fmt.Errorf("error user with email/phone does not exists").Error(), http.StatusBadRequest)
+			localizedError(w, r, http.StatusBadRequest, msgUserDoesNotExist)
 			return
 		}
+		logging.SetUserID(ctx, strconv.Itoa(int(user.ID)))
 
-		log.Println("Now vs Validity: ", time.Now().Before(*user.CurrentOtpValidityTime), time.Now().UTC(), user.CurrentOtpValidityTime)
 		if !time.Now().UTC().Before(*user.CurrentOtpValidityTime) {
-			http.Error(w, fmt.Errorf("error otp has expired").Error(), http.StatusBadRequest)
+			localizedError(w, r, http.StatusBadRequest, msgOtpExpired)
 			return
 		}
 
 		if input.Otp != *user.CurrentOtp {
-			http.Error(w, fmt.Errorf("error wrong otp").Error(), http.StatusBadRequest)
+			localizedError(w, r, http.StatusBadRequest, msgWrongOtp)
 			return
 		}
 
-		jwtToken, err := generateJWT(input.Email, fmt.Sprintf("%s %s", user.FirstName, user.LastName)) // Replace with actual user data
+		jwtToken, err := appHandler.generateJWT(input.Email, fmt.Sprintf("%s %s", user.FirstName, user.LastName), cookie.Lifetime) // Replace with actual user data
 		if err != nil {
-			http.Error(w, fmt.Errorf("error generating token").Error(), http.StatusInternalServerError)
+			localizedError(w, r, http.StatusInternalServerError, msgGeneratingToken)
 			return
 		}
 
 		http.SetCookie(
 			w,
 			&http.Cookie{
-				Name:     "jwt",
+				Name:     SessionCookieName,
 				Value:    jwtToken,
 				Path:     "/",
-				Expires:  time.Now().Add(24 * time.Hour),
-				MaxAge:   3600 * 24,
+				Domain:   cookie.Domain,
+				Expires:  time.Now().Add(cookie.Lifetime),
+				MaxAge:   int(cookie.Lifetime.Seconds()),
 				HttpOnly: true,
-				Secure:   true,
-				SameSite: http.SameSiteLaxMode,
+				Secure:   cookie.Secure,
+				SameSite: cookie.SameSite,
 			},
 		)
+		metrics.RegistrationFunnel.WithLabelValues(metrics.FunnelLoggedIn).Inc()
 
 		// return ok
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
 		if err := json.NewEncoder(w).Encode(true); err != nil {
-			http.Error(w, "error encoding the result", http.StatusBadRequest)
+			localizedError(w, r, http.StatusBadRequest, msgEncodingResult)
 			return
 		}
 	})
@@ -379,14 +467,12 @@ type Claims struct {
 	jwt.RegisteredClaims
 }
 
-var jwtKey = []byte(os.Getenv("JWT_SECRET"))
-
-func generateJWT(email, name string) (string, error) {
+func (appHandler *AppHandler) generateJWT(email, name string, lifetime time.Duration) (string, error) {
 	claims := &Claims{
 		Name:  name,
 		Email: email,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(lifetime)),
 			Issuer:    "cyberix-frcc-api", // Replace with your service name
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
@@ -396,10 +482,28 @@ func generateJWT(email, name string) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	// Sign and get the complete encoded token as a string using the secret.
-	tokenString, err := token.SignedString(jwtKey)
+	tokenString, err := token.SignedString(appHandler.jwtKey)
 	if err != nil {
 		return "", err
 	}
 
 	return tokenString, nil
 }
+
+// claimsFromCookie returns the claims of the session set by /auth/otp.
+func (appHandler *AppHandler) claimsFromCookie(r *http.Request) (*Claims, error) {
+	cookie, err := r.Cookie(SessionCookieName)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &Claims{}
+	_, err = jwt.ParseWithClaims(cookie.Value, claims, func(token *jwt.Token) (interface{}, error) {
+		return appHandler.jwtKey, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
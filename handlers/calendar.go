@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"cyberix.fr/frcc/calendar"
+	"cyberix.fr/frcc/logging"
+	"cyberix.fr/frcc/messaging"
+	"cyberix.fr/frcc/models"
+	"cyberix.fr/frcc/storage"
+	"github.com/go-chi/chi/v5"
+)
+
+type iCalendarStore interface {
+	GetUserByEmailOrPhone(ctx context.Context, arg storage.GetUserByEmailOrPhoneParams) (*models.User, error)
+	CreateCalendarSecret(ctx context.Context, arg storage.CreateCalendarSecretParams) error
+	GetCalendarSecret(ctx context.Context, userID int32) (*models.CalendarSecret, error)
+	RotateCalendarSecret(ctx context.Context, arg storage.RotateCalendarSecretParams) (*models.CalendarSecret, error)
+}
+
+type CalendarResponse struct {
+	// URL is the path of the calendar feed of the user, to subscribe to from a calendar app.
+	URL string `json:"url"`
+}
+
+// Calendar serves the event calendar of the logged in user as an iCalendar feed, generated on
+// each request so that subscribed calendars follow the changes of the agenda. Calendar apps
+// cannot send the session cookie, so the feed also accepts the token given by /me/calendar,
+// which /me/calendar/rotate revokes by replacing the calendar secret of the user.
+func (appHandler *AppHandler) Calendar(mux chi.Router, db iCalendarStore, event messaging.EventInfo) {
+	mux.Get("/me/calendar", func(w http.ResponseWriter, r *http.Request) {
+		user, status, err := appHandler.calendarUser(r, db)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		secret, err := db.GetCalendarSecret(r.Context(), user.ID)
+		if err != nil {
+			http.Error(w, fmt.Errorf("error getting calendar secret: %v", err).Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// the secret is created on the first request, and kept by concurrent ones
+		if secret == nil {
+			value, err := createCalendarSecret()
+			if err != nil {
+				http.Error(w, fmt.Errorf("error creating calendar secret: %v", err).Error(), http.StatusInternalServerError)
+				return
+			}
+
+			err = db.CreateCalendarSecret(r.Context(), storage.CreateCalendarSecretParams{UserID: user.ID, Secret: value})
+			if err != nil {
+				http.Error(w, fmt.Errorf("error creating calendar secret: %v", err).Error(), http.StatusInternalServerError)
+				return
+			}
+
+			secret, err = db.GetCalendarSecret(r.Context(), user.ID)
+			if err != nil || secret == nil {
+				http.Error(w, fmt.Errorf("error getting calendar secret: %v", err).Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		appHandler.writeCalendarResponse(w, user.Email, secret.Secret)
+	})
+
+	mux.Post("/me/calendar/rotate", func(w http.ResponseWriter, r *http.Request) {
+		user, status, err := appHandler.calendarUser(r, db)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		value, err := createCalendarSecret()
+		if err != nil {
+			http.Error(w, fmt.Errorf("error creating calendar secret: %v", err).Error(), http.StatusInternalServerError)
+			return
+		}
+
+		secret, err := db.RotateCalendarSecret(r.Context(), storage.RotateCalendarSecretParams{UserID: user.ID, Secret: value})
+		if err != nil {
+			http.Error(w, fmt.Errorf("error rotating calendar secret: %v", err).Error(), http.StatusInternalServerError)
+			return
+		}
+
+		appHandler.writeCalendarResponse(w, user.Email, secret.Secret)
+	})
+
+	mux.Get("/me/calendar.ics", func(w http.ResponseWriter, r *http.Request) {
+		var (
+			user   *models.User
+			status int
+			err    error
+		)
+		if token := r.URL.Query().Get("token"); token != "" {
+			user, status, err = appHandler.calendarTokenUser(r.Context(), db, token)
+		} else {
+			user, status, err = appHandler.calendarUser(r, db)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		logging.SetUserID(r.Context(), strconv.Itoa(int(user.ID)))
+
+		w.Header().Set("Content-Type", calendar.ContentType)
+		w.Header().Set("Content-Disposition", `inline; filename="calendar.ics"`)
+		w.Header().Set("Cache-Control", "no-cache")
+		_, _ = w.Write(messaging.EventCalendar(event).Bytes(time.Now()))
+	})
+}
+
+func (appHandler *AppHandler) writeCalendarResponse(w http.ResponseWriter, email, secret string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(CalendarResponse{
+		URL: "/me/calendar.ics?token=" + url.QueryEscape(appHandler.createCalendarToken(email, secret)),
+	}); err != nil {
+		http.Error(w, "error encoding the result", http.StatusBadRequest)
+		return
+	}
+}
+
+// calendarUser returns the registered user of the session.
+func (appHandler *AppHandler) calendarUser(r *http.Request, db iCalendarStore) (*models.User, int, error) {
+	claims, err := appHandler.claimsFromCookie(r)
+	if err != nil {
+		return nil, http.StatusUnauthorized, fmt.Errorf("error not logged in")
+	}
+
+	return registeredCalendarUser(r.Context(), db, claims.Email)
+}
+
+// calendarTokenUser returns the registered user of the calendar token, which must be signed
+// with the current calendar secret of the user.
+func (appHandler *AppHandler) calendarTokenUser(ctx context.Context, db iCalendarStore, token string) (*models.User, int, error) {
+	encodedEmail, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, http.StatusUnauthorized, fmt.Errorf("error invalid calendar token")
+	}
+
+	email, err := base64.RawURLEncoding.DecodeString(encodedEmail)
+	if err != nil {
+		return nil, http.StatusUnauthorized, fmt.Errorf("error invalid calendar token")
+	}
+
+	user, status, err := registeredCalendarUser(ctx, db, string(email))
+	if err != nil {
+		// an unknown email is reported as an invalid token, so tokens cannot probe for accounts
+		if status == http.StatusForbidden {
+			status, err = http.StatusUnauthorized, fmt.Errorf("error invalid calendar token")
+		}
+		return nil, status, err
+	}
+
+	secret, err := db.GetCalendarSecret(ctx, user.ID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("error getting calendar secret: %v", err)
+	}
+
+	if secret == nil || !hmac.Equal([]byte(signature), []byte(appHandler.calendarTokenSignature(user.Email, secret.Secret))) {
+		return nil, http.StatusUnauthorized, fmt.Errorf("error invalid calendar token")
+	}
+
+	return user, http.StatusOK, nil
+}
+
+func registeredCalendarUser(ctx context.Context, db iCalendarStore, email string) (*models.User, int, error) {
+	user, err := db.GetUserByEmailOrPhone(ctx, storage.GetUserByEmailOrPhoneParams{
+		Email: email,
+		Phone: email,
+	})
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("error getting user: %v", err)
+	}
+
+	if user == nil || !user.ConfirmedAccount {
+		return nil, http.StatusForbidden, fmt.Errorf("error user is not registered")
+	}
+
+	return user, http.StatusOK, nil
+}
+
+// createCalendarToken creates a token identifying the user in calendar feed URLs, which,
+// unlike the session, does not expire since calendar apps keep polling the feed, but is revoked
+// with the calendar secret of the user.
+func (appHandler *AppHandler) createCalendarToken(email, secret string) string {
+	encodedEmail := base64.RawURLEncoding.EncodeToString([]byte(email))
+	return encodedEmail + "." + appHandler.calendarTokenSignature(email, secret)
+}
+
+func (appHandler *AppHandler) calendarTokenSignature(email, secret string) string {
+	mac := hmac.New(sha256.New, appHandler.calendarKey)
+	mac.Write([]byte(email))
+	mac.Write([]byte{0})
+	mac.Write([]byte(secret))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func createCalendarSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"cyberix.fr/frcc/messaging"
+	"cyberix.fr/frcc/storage"
+	"github.com/go-chi/chi/v5"
+)
+
+const calendarTestEmail = "jane@example.com"
+
+// newCalendarMux serves the calendar of a confirmed user, returning the session cookie of the user.
+func newCalendarMux(t *testing.T) (http.Handler, *http.Cookie) {
+	t.Helper()
+	ctx := context.Background()
+
+	s := storage.NewMemoryStorage()
+	_, err := s.CreateUser(ctx, storage.CreateUserParams{
+		FirstName:         "Jane",
+		LastName:          "Doe",
+		Email:             calendarTestEmail,
+		Phone:             "+237600000000",
+		ConfirmationToken: "confirmation",
+		Locale:            "fr",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ConfirmRegister(ctx, "confirmation"); err != nil {
+		t.Fatal(err)
+	}
+
+	appHandler := NewAppHandler(NewAppHandlerOptions{
+		CalendarKey: []byte("calendar key"),
+		JWTKey:      []byte("jwt key"),
+	})
+
+	session, err := appHandler.generateJWT(calendarTestEmail, "Jane Doe", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := chi.NewMux()
+	appHandler.Calendar(mux, s, messaging.EventInfo{
+		Name:     "FRCC",
+		StartsAt: time.Date(2026, 6, 1, 9, 0, 0, 0, time.UTC),
+		EndsAt:   time.Date(2026, 6, 3, 18, 0, 0, 0, time.UTC),
+	})
+
+	return mux, &http.Cookie{Name: SessionCookieName, Value: session}
+}
+
+func serveCalendar(mux http.Handler, method, target string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, nil)
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	return w
+}
+
+// calendarURL requests the feed URL with the session.
+func calendarURL(t *testing.T, mux http.Handler, method, target string, cookie *http.Cookie) string {
+	t.Helper()
+
+	w := serveCalendar(mux, method, target, cookie)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected the calendar url, got %v %q", w.Code, w.Body.String())
+	}
+
+	var response CalendarResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	return response.URL
+}
+
+func TestCalendarFeedWithToken(t *testing.T) {
+	mux, cookie := newCalendarMux(t)
+
+	feedURL := calendarURL(t, mux, http.MethodGet, "/me/calendar", cookie)
+	if again := calendarURL(t, mux, http.MethodGet, "/me/calendar", cookie); again != feedURL {
+		t.Fatalf("expected the same url until rotated, got %v and %v", feedURL, again)
+	}
+
+	w := serveCalendar(mux, http.MethodGet, feedURL, nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "SUMMARY:FRCC") {
+		t.Fatalf("expected the calendar, got %v %q", w.Code, w.Body.String())
+	}
+}
+
+func TestCalendarRotationRevokesToken(t *testing.T) {
+	mux, cookie := newCalendarMux(t)
+
+	oldURL := calendarURL(t, mux, http.MethodGet, "/me/calendar", cookie)
+	newURL := calendarURL(t, mux, http.MethodPost, "/me/calendar/rotate", cookie)
+	if newURL == oldURL {
+		t.Fatal("expected rotating to change the url")
+	}
+
+	if w := serveCalendar(mux, http.MethodGet, oldURL, nil); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the old url to be revoked, got %v", w.Code)
+	}
+	if w := serveCalendar(mux, http.MethodGet, newURL, nil); w.Code != http.StatusOK {
+		t.Fatalf("expected the new url to serve the calendar, got %v", w.Code)
+	}
+}
+
+func TestCalendarRejectsInvalidTokens(t *testing.T) {
+	mux, cookie := newCalendarMux(t)
+
+	feedURL := calendarURL(t, mux, http.MethodGet, "/me/calendar", cookie)
+	u, err := url.Parse(feedURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encodedEmail, signature, _ := strings.Cut(u.Query().Get("token"), ".")
+
+	tests := map[string]string{
+		"no signature":     encodedEmail,
+		"other signature":  encodedEmail + "." + strings.Repeat("0", len(signature)),
+		"other user":       "b3RoZXJAZXhhbXBsZS5jb20." + signature,
+		"invalid encoding": "!." + signature,
+	}
+
+	for name, token := range tests {
+		t.Run(name, func(t *testing.T) {
+			w := serveCalendar(mux, http.MethodGet, "/me/calendar.ics?token="+url.QueryEscape(token), nil)
+			if w.Code != http.StatusUnauthorized {
+				t.Fatalf("expected the token to be rejected, got %v", w.Code)
+			}
+		})
+	}
+
+	if w := serveCalendar(mux, http.MethodGet, "/me/calendar.ics", nil); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the feed to require a session or a token, got %v", w.Code)
+	}
+	if w := serveCalendar(mux, http.MethodGet, "/me/calendar.ics", cookie); w.Code != http.StatusOK {
+		t.Fatalf("expected the feed to accept the session, got %v", w.Code)
+	}
+}
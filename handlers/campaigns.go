@@ -0,0 +1,323 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cyberix.fr/frcc/messaging"
+	"cyberix.fr/frcc/models"
+	"cyberix.fr/frcc/storage"
+	"github.com/go-chi/chi/v5"
+)
+
+type iCampaignStore interface {
+	CreateCampaign(ctx context.Context, arg storage.CreateCampaignParams) (*models.Campaign, error)
+	GetCampaign(ctx context.Context, id int64) (*models.Campaign, error)
+	ListCampaigns(ctx context.Context, arg storage.ListCampaignsParams) ([]*models.Campaign, error)
+	CountCampaignAudience(ctx context.Context, audience models.CampaignAudience) (int64, error)
+	CountCampaignRecipients(ctx context.Context, campaignID int64) (map[models.CampaignRecipientStatus]int64, error)
+}
+
+type CreateCampaignRequest struct {
+	Name string `json:"name"`
+	// Template defaults to campaign_email.
+	Template string                  `json:"template"`
+	Subject  string                  `json:"subject"`
+	Body     string                  `json:"body"`
+	Audience models.CampaignAudience `json:"audience"`
+}
+
+type CampaignResponse struct {
+	*models.Campaign
+	// AudienceSize is the number of users the campaign would be sent to now, until it starts.
+	AudienceSize *int64 `json:"audience_size,omitempty"`
+	// Recipients counts the recipients by status, once the campaign started.
+	Recipients map[models.CampaignRecipientStatus]int64 `json:"recipients"`
+}
+
+// Campaigns creates marketing campaigns and reports how many recipients they were sent to.
+func (appHandler *AppHandler) Campaigns(mux chi.Router, db iCampaignStore) {
+	mux.Post("/campaigns", func(w http.ResponseWriter, r *http.Request) {
+		var input CreateCampaignRequest
+		httpStatus, err := appHandler.ParsingRequestBody(w, r, &input)
+		if err != nil {
+			http.Error(w, err.Error(), httpStatus)
+			return
+		}
+
+		if input.Template == "" {
+			input.Template = "campaign_email"
+		}
+
+		if err := validateCampaign(input); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		campaign, err := db.CreateCampaign(r.Context(), storage.CreateCampaignParams{
+			Name:     strings.TrimSpace(input.Name),
+			Template: input.Template,
+			Subject:  strings.TrimSpace(input.Subject),
+			Body:     input.Body,
+			Audience: input.Audience,
+		})
+		if err != nil {
+			http.Error(w, fmt.Errorf("error creating campaign: %v", err).Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(w).Encode(campaign); err != nil {
+			http.Error(w, "error encoding the result", http.StatusBadRequest)
+			return
+		}
+	})
+
+	mux.Get("/campaigns", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		limit, offset, err := parsePagination(query.Get("limit"), query.Get("offset"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		campaigns, err := db.ListCampaigns(r.Context(), storage.ListCampaignsParams{
+			Limit:  limit,
+			Offset: offset,
+		})
+		if err != nil {
+			http.Error(w, fmt.Errorf("error listing campaigns: %v", err).Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(campaigns); err != nil {
+			http.Error(w, "error encoding the result", http.StatusBadRequest)
+			return
+		}
+	})
+
+	mux.Get("/campaigns/{id}", func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			http.Error(w, "error invalid campaign id", http.StatusBadRequest)
+			return
+		}
+
+		campaign, err := db.GetCampaign(ctx, id)
+		if err != nil {
+			http.Error(w, fmt.Errorf("error getting campaign: %v", err).Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if campaign == nil {
+			http.Error(w, "error campaign does not exist", http.StatusNotFound)
+			return
+		}
+
+		response := CampaignResponse{Campaign: campaign}
+
+		if campaign.Status == models.CampaignStatusDraft || campaign.Status == models.CampaignStatusScheduled {
+			size, err := db.CountCampaignAudience(ctx, campaign.Audience)
+			if err != nil {
+				http.Error(w, fmt.Errorf("error counting campaign audience: %v", err).Error(), http.StatusInternalServerError)
+				return
+			}
+			response.AudienceSize = &size
+		}
+
+		response.Recipients, err = db.CountCampaignRecipients(ctx, id)
+		if err != nil {
+			http.Error(w, fmt.Errorf("error counting campaign recipients: %v", err).Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			http.Error(w, "error encoding the result", http.StatusBadRequest)
+			return
+		}
+	})
+}
+
+func validateCampaign(input CreateCampaignRequest) error {
+	if strings.TrimSpace(input.Name) == "" {
+		return fmt.Errorf("error name is required")
+	}
+
+	if !messaging.IsCampaignTemplate(input.Template) {
+		return fmt.Errorf("error template %v cannot be used for campaigns", input.Template)
+	}
+
+	if strings.TrimSpace(input.Subject) == "" {
+		return fmt.Errorf("error subject is required")
+	}
+
+	if strings.TrimSpace(input.Body) == "" {
+		return fmt.Errorf("error body is required")
+	}
+
+	if input.Audience.Locale != "" && !input.Audience.Locale.IsValid() {
+		return fmt.Errorf("error audience locale %v is not supported", input.Audience.Locale)
+	}
+
+	return nil
+}
+
+type iCampaignScheduler interface {
+	GetCampaign(ctx context.Context, id int64) (*models.Campaign, error)
+	ScheduleCampaignTx(ctx context.Context, arg storage.ScheduleCampaignTxParams) (*models.Campaign, error)
+	CancelCampaign(ctx context.Context, id int64) (*models.Campaign, error)
+}
+
+type ScheduleCampaignRequest struct {
+	// SendAt defaults to now.
+	SendAt *time.Time `json:"send_at"`
+}
+
+// ScheduleCampaign schedules a draft campaign, or reschedules it until it starts, and cancels it.
+func (appHandler *AppHandler) ScheduleCampaign(mux chi.Router, db iCampaignScheduler) {
+	mux.Post("/campaigns/{id}/schedule", func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			http.Error(w, "error invalid campaign id", http.StatusBadRequest)
+			return
+		}
+
+		var input ScheduleCampaignRequest
+		httpStatus, err := appHandler.ParsingRequestBody(w, r, &input)
+		if err != nil {
+			http.Error(w, err.Error(), httpStatus)
+			return
+		}
+
+		sendAt := time.Now()
+		if input.SendAt != nil {
+			sendAt = *input.SendAt
+		}
+
+		campaign, err := db.ScheduleCampaignTx(ctx, storage.ScheduleCampaignTxParams{
+			ScheduleCampaignParams: storage.ScheduleCampaignParams{
+				ID:     id,
+				SendAt: sendAt,
+			},
+			Message: models.Message{
+				"job":         "campaign_batch",
+				"campaign_id": strconv.FormatInt(id, 10),
+			},
+		})
+		if err != nil {
+			http.Error(w, fmt.Errorf("error scheduling campaign: %v", err).Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if campaign == nil {
+			campaignNotChangeable(w, r, db, id)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(campaign); err != nil {
+			http.Error(w, "error encoding the result", http.StatusBadRequest)
+			return
+		}
+	})
+
+	mux.Post("/campaigns/{id}/cancel", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			http.Error(w, "error invalid campaign id", http.StatusBadRequest)
+			return
+		}
+
+		campaign, err := db.CancelCampaign(r.Context(), id)
+		if err != nil {
+			http.Error(w, fmt.Errorf("error cancelling campaign: %v", err).Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if campaign == nil {
+			campaignNotChangeable(w, r, db, id)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(campaign); err != nil {
+			http.Error(w, "error encoding the result", http.StatusBadRequest)
+			return
+		}
+	})
+}
+
+// campaignNotChangeable replies whether the campaign does not exist or is past the requested change.
+func campaignNotChangeable(w http.ResponseWriter, r *http.Request, db iCampaignScheduler, id int64) {
+	campaign, err := db.GetCampaign(r.Context(), id)
+	if err != nil {
+		http.Error(w, fmt.Errorf("error getting campaign: %v", err).Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if campaign == nil {
+		http.Error(w, "error campaign does not exist", http.StatusNotFound)
+		return
+	}
+
+	http.Error(w, fmt.Sprintf("error campaign is %v", campaign.Status), http.StatusConflict)
+}
+
+type iMarketingOptOutManager interface {
+	CreateMarketingOptOut(ctx context.Context, arg storage.CreateMarketingOptOutParams) error
+	DeleteMarketingOptOut(ctx context.Context, email string) error
+}
+
+type MarketingOptOutRequest struct {
+	Email string `json:"email"`
+}
+
+// MarketingOptOuts lets organizers stop sending campaigns to an address, or resume it.
+func (appHandler *AppHandler) MarketingOptOuts(mux chi.Router, db iMarketingOptOutManager) {
+	mux.Post("/campaigns/opt-outs", func(w http.ResponseWriter, r *http.Request) {
+		var input MarketingOptOutRequest
+		httpStatus, err := appHandler.ParsingRequestBody(w, r, &input)
+		if err != nil {
+			http.Error(w, err.Error(), httpStatus)
+			return
+		}
+
+		if !models.Email(input.Email).IsValid() {
+			http.Error(w, "error invalid email address", http.StatusBadRequest)
+			return
+		}
+
+		if err := db.CreateMarketingOptOut(r.Context(), storage.CreateMarketingOptOutParams{Email: input.Email}); err != nil {
+			http.Error(w, fmt.Errorf("error creating marketing opt-out: %v", err).Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.Delete("/campaigns/opt-outs/{email}", func(w http.ResponseWriter, r *http.Request) {
+		if err := db.DeleteMarketingOptOut(r.Context(), chi.URLParam(r, "email")); err != nil {
+			http.Error(w, fmt.Errorf("error deleting marketing opt-out: %v", err).Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
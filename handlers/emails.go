@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"cyberix.fr/frcc/messaging"
+	"cyberix.fr/frcc/models"
+	"cyberix.fr/frcc/storage"
+	"github.com/go-chi/chi/v5"
+)
+
+type iProviderStatser interface {
+	ProviderStats() []messaging.ProviderStats
+}
+
+// EmailProviders reports which providers delivered emails, and the state of their circuit breakers.
+func (appHandler *AppHandler) EmailProviders(mux chi.Router, es iProviderStatser) {
+	mux.Get("/emails/providers", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(es.ProviderStats()); err != nil {
+			http.Error(w, "error encoding the result", http.StatusBadRequest)
+			return
+		}
+	})
+}
+
+type iEmailPreviewer interface {
+	TemplateNames() []string
+	Preview(locale models.Locale, template string, to models.Email, name string) (*messaging.RenderedEmail, error)
+}
+
+type EmailTemplatesResponse struct {
+	Templates []string        `json:"templates"`
+	Locales   []models.Locale `json:"locales"`
+}
+
+// EmailTemplates lists the email templates which can be previewed, and their locales.
+func (appHandler *AppHandler) EmailTemplates(mux chi.Router, es iEmailPreviewer) {
+	mux.Get("/emails/templates", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(EmailTemplatesResponse{
+			Templates: es.TemplateNames(),
+			Locales:   models.Locales,
+		}); err != nil {
+			http.Error(w, "error encoding the result", http.StatusBadRequest)
+			return
+		}
+	})
+}
+
+// PreviewEmail renders an email template as attendees get it, with sample data or the data
+// of the user given by the user query parameter, as html, text or json.
+func (appHandler *AppHandler) PreviewEmail(mux chi.Router, db iUserGetter, es iEmailPreviewer) {
+	mux.Get("/emails/templates/{name}/preview", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		email, status, err := previewEmail(r, db, es, chi.URLParam(r, "name"), query.Get("user"), query.Get("locale"))
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		switch query.Get("format") {
+		case "", "html":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = w.Write([]byte(email.HtmlBody))
+		case "text":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			_, _ = w.Write([]byte(email.TextBody))
+		case "json":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			if err := json.NewEncoder(w).Encode(email); err != nil {
+				http.Error(w, "error encoding the result", http.StatusBadRequest)
+				return
+			}
+		default:
+			http.Error(w, "error format must be html, text or json", http.StatusBadRequest)
+		}
+	})
+}
+
+type iTestEmailSender interface {
+	iEmailPreviewer
+	SendTestEmail(ctx context.Context, to models.Email, email *messaging.RenderedEmail) error
+}
+
+type TestEmailRequest struct {
+	// To is the address receiving the test copy.
+	To string `json:"to,omitempty"`
+	// User is the email of the user whose data is rendered, sample data being used when empty.
+	User   string `json:"user,omitempty"`
+	Locale string `json:"locale,omitempty"`
+}
+
+// SendTestEmail sends a test copy of an email template to the given address.
+func (appHandler *AppHandler) SendTestEmail(mux chi.Router, db iUserGetter, es iTestEmailSender) {
+	mux.Post("/emails/templates/{name}/test", func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		var input TestEmailRequest
+		httpStatus, err := appHandler.ParsingRequestBody(w, r, &input)
+		if err != nil {
+			http.Error(w, err.Error(), httpStatus)
+			return
+		}
+
+		to := models.Email(input.To)
+		if !to.IsValid() {
+			http.Error(w, "error invalid to email address", http.StatusBadRequest)
+			return
+		}
+
+		email, status, err := previewEmail(r, db, es, chi.URLParam(r, "name"), input.User, input.Locale)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		if err := es.SendTestEmail(ctx, to, email); err != nil {
+			http.Error(w, fmt.Errorf("error sending test email: %v", err).Error(), http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		if err := json.NewEncoder(w).Encode(true); err != nil {
+			http.Error(w, "error encoding the result", http.StatusBadRequest)
+			return
+		}
+	})
+}
+
+type iUserGetter interface {
+	GetUserByEmailOrPhone(ctx context.Context, arg storage.GetUserByEmailOrPhoneParams) (*models.User, error)
+}
+
+// previewEmail renders the template for the user with the email user, or for a sample recipient
+// when empty. The locale defaults to the one of the user, then to the default locale.
+func previewEmail(r *http.Request, db iUserGetter, es iEmailPreviewer, template, user, locale string) (*messaging.RenderedEmail, int, error) {
+	to, name, userLocale := models.Email("jane.doe@example.com"), "Jane Doe", models.DefaultLocale
+
+	if user != "" {
+		u, err := db.GetUserByEmailOrPhone(r.Context(), storage.GetUserByEmailOrPhoneParams{
+			Email: user,
+			Phone: user,
+		})
+		if err != nil {
+			return nil, http.StatusInternalServerError, fmt.Errorf("error getting user: %v", err)
+		}
+
+		if u == nil {
+			return nil, http.StatusNotFound, errors.New("error user does not exist")
+		}
+
+		to, name, userLocale = models.Email(u.Email), fmt.Sprintf("%s %s", u.FirstName, u.LastName), u.Locale
+	}
+
+	if locale != "" {
+		userLocale = models.ParseLocale(locale)
+	}
+
+	email, err := es.Preview(userLocale, template, to, name)
+	if err != nil {
+		if errors.Is(err, messaging.ErrTemplateNotFound) {
+			return nil, http.StatusNotFound, errors.New("error email template does not exist")
+		}
+		return nil, http.StatusInternalServerError, fmt.Errorf("error rendering email: %v", err)
+	}
+
+	return email, http.StatusOK, nil
+}
+
+type iEmailDeliveryLister interface {
+	ListEmailDeliveries(ctx context.Context, arg storage.ListEmailDeliveriesParams) ([]*models.EmailDelivery, error)
+}
+
+// EmailDeliveries lists the sent emails with their last delivery status, filtered by recipient or status.
+func (appHandler *AppHandler) EmailDeliveries(mux chi.Router, db iEmailDeliveryLister) {
+	mux.Get("/emails/deliveries", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		limit, offset, err := parsePagination(query.Get("limit"), query.Get("offset"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		deliveries, err := db.ListEmailDeliveries(r.Context(), storage.ListEmailDeliveriesParams{
+			Recipient: query.Get("recipient"),
+			Status:    query.Get("status"),
+			Limit:     limit,
+			Offset:    offset,
+		})
+		if err != nil {
+			http.Error(w, fmt.Errorf("error listing email deliveries: %v", err).Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(deliveries); err != nil {
+			http.Error(w, "error encoding the result", http.StatusBadRequest)
+			return
+		}
+	})
+}
+
+type iEmailSuppressionManager interface {
+	ListEmailSuppressions(ctx context.Context, arg storage.ListEmailSuppressionsParams) ([]*models.EmailSuppression, error)
+	DeleteEmailSuppression(ctx context.Context, email string) error
+}
+
+// EmailSuppressions lists the suppressed addresses, and lets organizers remove one once it is fixed.
+func (appHandler *AppHandler) EmailSuppressions(mux chi.Router, db iEmailSuppressionManager) {
+	mux.Get("/emails/suppressions", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		limit, offset, err := parsePagination(query.Get("limit"), query.Get("offset"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		suppressions, err := db.ListEmailSuppressions(r.Context(), storage.ListEmailSuppressionsParams{
+			Limit:  limit,
+			Offset: offset,
+		})
+		if err != nil {
+			http.Error(w, fmt.Errorf("error listing email suppressions: %v", err).Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(suppressions); err != nil {
+			http.Error(w, "error encoding the result", http.StatusBadRequest)
+			return
+		}
+	})
+
+	mux.Delete("/emails/suppressions/{email}", func(w http.ResponseWriter, r *http.Request) {
+		if err := db.DeleteEmailSuppression(r.Context(), chi.URLParam(r, "email")); err != nil {
+			http.Error(w, fmt.Errorf("error deleting email suppression: %v", err).Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
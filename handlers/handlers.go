@@ -3,20 +3,42 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
-	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"strings"
+
+	"cyberix.fr/frcc/logging"
+	"cyberix.fr/frcc/messaging"
+	"go.uber.org/zap"
 )
 
 type AppHandler struct {
 	// GetAuthenticatedUser func(r *http.Request) *models.User
 	ParsingRequestBody func(w http.ResponseWriter, r *http.Request, inputs interface{}) (int, error)
+	calendarKey        []byte
+	jwtKey             []byte
+	payloadCipher      *messaging.PayloadCipher
+	unsubscribeKey     []byte
+}
+
+type NewAppHandlerOptions struct {
+	// CalendarKey signs the calendar feed tokens, with the calendar secret of the user.
+	CalendarKey []byte
+	// JWTKey signs the sessions.
+	JWTKey []byte
+	// PayloadCipher seals the sensitive values of the messages written to the outbox, so that
+	// otps are not stored in clear text. A nil cipher leaves them in clear text.
+	PayloadCipher *messaging.PayloadCipher
+	// UnsubscribeKey verifies the unsubscribe tokens, see messaging.CreateUnsubscribeToken.
+	UnsubscribeKey []byte
 }
 
-func NewAppHandler() *AppHandler {
+func NewAppHandler(opts NewAppHandlerOptions) *AppHandler {
 	return &AppHandler{
+		calendarKey:    opts.CalendarKey,
+		jwtKey:         opts.JWTKey,
+		payloadCipher:  opts.PayloadCipher,
+		unsubscribeKey: opts.UnsubscribeKey,
 		// GetAuthenticatedUser: func(r *http.Request) *models.User {
 		// 	user := r.Context().Value(services.JwtUserKey)
 		// 	if user == nil {
@@ -80,19 +102,17 @@ func NewAppHandler() *AppHandler {
 				// Catch any type errors, like trying to assign a string in the JSON request body
 				// to a int field in our data struct
 				case errors.As(err, &unmarshalTypeError):
-					msg := fmt.Sprintf(
-						"Request body contains an invalid value for the %+v field (at position): %+v",
-						unmarshalTypeError.Offset, err,
+					logging.FromContext(r.Context()).Info("Error parsing request body: invalid value",
+						zap.String("field", unmarshalTypeError.Field),
+						zap.Int64("offset", unmarshalTypeError.Offset),
 					)
-					log.Println("PRB error :", msg)
 					return http.StatusBadRequest, errors.New("ERR_HDL_PRB_04")
 
 				// Catch error caused by extra unexpected fields in the request body.
 				// We extract the field name from the errror message and interpolate it in our custom error message
 				case strings.HasPrefix(err.Error(), "json: unknown field "):
 					fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
-					msg := fmt.Sprintf("Request body contains unknown field %s", fieldName)
-					log.Printf("\n\nError PRB: %s", msg)
+					logging.FromContext(r.Context()).Info("Error parsing request body: unknown field", zap.String("field", fieldName))
 					return http.StatusBadRequest, errors.New("ERR_HDL_PRB_05")
 
 				// An io.EOF error is returned by Decode() if the request body is empty
@@ -1,34 +1,123 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 )
 
+const (
+	healthStatusPass = "pass"
+	healthStatusFail = "fail"
+)
+
 type HealthResponse struct {
-	Status      string
-	Version     string
-	Description string
-	Time        string
+	Status      string                         `json:"status"`
+	ReleaseID   string                         `json:"releaseId,omitempty"`
+	Description string                         `json:"description,omitempty"`
+	Checks      map[string][]HealthCheckResult `json:"checks,omitempty"`
+}
+
+// HealthCheckResult is the result of a check, keyed by "{componentName}:{measurementName}".
+type HealthCheckResult struct {
+	ComponentType string  `json:"componentType,omitempty"`
+	ObservedValue float64 `json:"observedValue"`
+	ObservedUnit  string  `json:"observedUnit"`
+	Status        string  `json:"status"`
+	Time          string  `json:"time"`
+	Output        string  `json:"output,omitempty"`
+}
+
+// HealthCheck is a dependency the API cannot serve requests without.
+type HealthCheck struct {
+	// Name is the component name, such as postgres, and ComponentType its kind, such as datastore.
+	Name          string
+	ComponentType string
+	Check         func(ctx context.Context) error
 }
 
+// Health serves the liveness of the API, and its readiness which checks every dependency.
 // https://datatracker.ietf.org/doc/html/draft-inadarei-api-health-check-06#name-api-health-response
-func (appHandler *AppHandler) Health(mux chi.Router) {
-	mux.Get("/health", func(w http.ResponseWriter, r *http.Request) {
+func (appHandler *AppHandler) Health(mux chi.Router, release string, checks []HealthCheck) {
+	live := func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, HealthResponse{
+			Status:      healthStatusPass,
+			ReleaseID:   release,
+			Description: "API Build for `Forum Regional de Cybesecurite de la CEMAC`",
+		})
+	}
+
+	mux.Get("/health", live)
+	mux.Get("/health/live", live)
+
+	mux.Get("/health/ready", func(w http.ResponseWriter, r *http.Request) {
 		response := HealthResponse{
-			Status:      "pass",
-			Version:     "0.0.1",
+			Status:      healthStatusPass,
+			ReleaseID:   release,
 			Description: "API Build for `Forum Regional de Cybesecurite de la CEMAC`",
-			Time:        time.Now().Format(time.RFC3339),
+			Checks:      make(map[string][]HealthCheckResult, len(checks)),
+		}
+
+		results := make([]HealthCheckResult, len(checks))
+		var wg sync.WaitGroup
+		for i, check := range checks {
+			wg.Add(1)
+			go func(i int, check HealthCheck) {
+				defer wg.Done()
+				results[i] = runHealthCheck(r.Context(), check)
+			}(i, check)
 		}
+		wg.Wait()
 
-		w.WriteHeader(http.StatusOK)
-		if err := json.NewEncoder(w).Encode(response); err != nil {
-			http.Error(w, "error encoding the result", http.StatusBadRequest)
-			return
+		for i, check := range checks {
+			response.Checks[check.Name+":responseTime"] = []HealthCheckResult{results[i]}
+			if results[i].Status == healthStatusFail {
+				response.Status = healthStatusFail
+			}
 		}
+
+		writeHealth(w, response)
 	})
 }
+
+func runHealthCheck(ctx context.Context, check HealthCheck) HealthCheckResult {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	before := time.Now()
+	err := check.Check(ctx)
+	duration := time.Since(before)
+
+	result := HealthCheckResult{
+		ComponentType: check.ComponentType,
+		ObservedValue: float64(duration.Microseconds()) / 1000,
+		ObservedUnit:  "ms",
+		Status:        healthStatusPass,
+		Time:          before.UTC().Format(time.RFC3339),
+	}
+	if err != nil {
+		result.Status = healthStatusFail
+		result.Output = err.Error()
+	}
+
+	return result
+}
+
+func writeHealth(w http.ResponseWriter, response HealthResponse) {
+	status := http.StatusOK
+	if response.Status == healthStatusFail {
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/health+json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "error encoding the result", http.StatusBadRequest)
+		return
+	}
+}
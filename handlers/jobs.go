@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"cyberix.fr/frcc/jobs"
+	"cyberix.fr/frcc/messaging"
+	"cyberix.fr/frcc/models"
+	"cyberix.fr/frcc/storage"
+	"github.com/go-chi/chi/v5"
+)
+
+type iJobRunLister interface {
+	ListJobRuns(ctx context.Context, arg storage.ListJobRunsParams) ([]*models.JobRun, error)
+}
+
+func (appHandler *AppHandler) ListJobRuns(mux chi.Router, db iJobRunLister) {
+	mux.Get("/jobs", func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		query := r.URL.Query()
+
+		limit, offset, err := parsePagination(query.Get("limit"), query.Get("offset"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		runs, err := db.ListJobRuns(ctx, storage.ListJobRunsParams{
+			Status: query.Get("status"),
+			Name:   query.Get("name"),
+			Limit:  limit,
+			Offset: offset,
+		})
+		if err != nil {
+			http.Error(w, fmt.Errorf("error listing job runs: %v", err).Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(runs); err != nil {
+			http.Error(w, "error encoding the result", http.StatusBadRequest)
+			return
+		}
+	})
+}
+
+type iJobRunRetrier interface {
+	GetJobRun(ctx context.Context, id int64) (*models.JobRun, error)
+	RequeueJobRun(ctx context.Context, id int64) error
+}
+
+type iJobSender interface {
+	Send(ctx context.Context, msg models.Message) error
+}
+
+func (appHandler *AppHandler) RetryJobRun(mux chi.Router, db iJobRunRetrier, q iJobSender) {
+	mux.Post("/jobs/{id}/retry", func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			http.Error(w, "error invalid job run id", http.StatusBadRequest)
+			return
+		}
+
+		run, err := db.GetJobRun(ctx, id)
+		if err != nil {
+			http.Error(w, fmt.Errorf("error getting job run: %v", err).Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if run == nil {
+			http.Error(w, "error job run does not exist", http.StatusNotFound)
+			return
+		}
+
+		if run.Status != models.JobRunStatusFailed {
+			http.Error(w, "error only failed job runs can be retried", http.StatusConflict)
+			return
+		}
+
+		if err := db.RequeueJobRun(ctx, id); err != nil {
+			http.Error(w, fmt.Errorf("error requeuing job run: %v", err).Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// The original deduplication ID would get the retry dropped by the queue, and the message
+		// ID is given anew by the queue.
+		msg := make(models.Message, len(run.Payload))
+		for k, v := range run.Payload {
+			if k != messaging.DeduplicationIDKey && k != messaging.MessageIDKey {
+				msg[k] = v
+			}
+		}
+		msg[jobs.JobIDKey] = run.JobID
+
+		if err := q.Send(ctx, msg); err != nil {
+			http.Error(w, fmt.Errorf("error adding job into queue: %v", err).Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		if err := json.NewEncoder(w).Encode(true); err != nil {
+			http.Error(w, "error encoding the result", http.StatusBadRequest)
+			return
+		}
+	})
+}
+
+func parsePagination(limitAsString, offsetAsString string) (int32, int32, error) {
+	limit, offset := int64(50), int64(0)
+
+	var err error
+	if limitAsString != "" {
+		limit, err = strconv.ParseInt(limitAsString, 10, 32)
+		if err != nil || limit < 1 || limit > 500 {
+			return 0, 0, fmt.Errorf("error limit must be between 1 and 500")
+		}
+	}
+
+	if offsetAsString != "" {
+		offset, err = strconv.ParseInt(offsetAsString, 10, 32)
+		if err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("error offset must be a positive number")
+		}
+	}
+
+	return int32(limit), int32(offset), nil
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"cyberix.fr/frcc/models"
+)
+
+type messageKey string
+
+const (
+	msgAccountNotConfirmed    messageKey = "account_not_confirmed"
+	msgCheckingSuppression    messageKey = "checking_suppression"
+	msgCheckingUser           messageKey = "checking_user"
+	msgConfirmingRegistration messageKey = "confirming_registration"
+	msgConsentVersionRequired messageKey = "consent_version_required"
+	msgCreatingToken          messageKey = "creating_token"
+	msgCreatingUser           messageKey = "creating_user"
+	msgEmailBouncing          messageKey = "email_bouncing"
+	msgEmailSuppressed        messageKey = "email_suppressed"
+	msgEncodingResult         messageKey = "encoding_result"
+	msgGeneratingToken        messageKey = "generating_token"
+	msgOtpExpired             messageKey = "otp_expired"
+	msgUpdatingOtp            messageKey = "updating_otp"
+	msgUserAlreadyExists      messageKey = "user_already_exists"
+	msgUserDoesNotExist       messageKey = "user_does_not_exist"
+	msgWrongOtp               messageKey = "wrong_otp"
+)
+
+// messages are the API messages of each locale, formatted with fmt.
+var messages = map[models.Locale]map[messageKey]string{
+	models.LocaleEnglish: {
+		msgAccountNotConfirmed:    "error your account is not confirmed yet",
+		msgCheckingSuppression:    "error checking if emails can be sent to this address: %v",
+		msgCheckingUser:           "error checking if user already exists: %v",
+		msgConfirmingRegistration: "error saving email address confirmation",
+		msgConsentVersionRequired: "error the version of the accepted consent text is required",
+		msgCreatingToken:          "error creating token: %v",
+		msgCreatingUser:           "error creating the new user: %v",
+		msgEmailBouncing:          "error emails sent to this address bounce, please contact the organizers to update it",
+		msgEmailSuppressed:        "error emails are no longer sent to this address, please contact the organizers",
+		msgEncodingResult:         "error encoding the result",
+		msgGeneratingToken:        "error generating token",
+		msgOtpExpired:             "error otp has expired",
+		msgUpdatingOtp:            "error updating current otp: %v",
+		msgUserAlreadyExists:      "error user with email/phone already exists",
+		msgUserDoesNotExist:       "error user with email/phone does not exist",
+		msgWrongOtp:               "error wrong otp",
+	},
+	models.LocaleFrench: {
+		msgAccountNotConfirmed:    "erreur votre compte n'est pas encore confirmé",
+		msgCheckingSuppression:    "erreur lors de la vérification de l'envoi d'emails à cette adresse : %v",
+		msgCheckingUser:           "erreur lors de la vérification de l'existence de l'utilisateur : %v",
+		msgConfirmingRegistration: "erreur lors de l'enregistrement de la confirmation de l'adresse email",
+		msgConsentVersionRequired: "erreur la version du texte de consentement accepté est requise",
+		msgCreatingToken:          "erreur lors de la création du jeton : %v",
+		msgCreatingUser:           "erreur lors de la création de l'utilisateur : %v",
+		msgEmailBouncing:          "erreur les emails envoyés à cette adresse sont rejetés, veuillez contacter les organisateurs pour la mettre à jour",
+		msgEmailSuppressed:        "erreur les emails ne sont plus envoyés à cette adresse, veuillez contacter les organisateurs",
+		msgEncodingResult:         "erreur lors de l'encodage du résultat",
+		msgGeneratingToken:        "erreur lors de la génération du jeton",
+		msgOtpExpired:             "erreur le code otp a expiré",
+		msgUpdatingOtp:            "erreur lors de la mise à jour du code otp : %v",
+		msgUserAlreadyExists:      "erreur un utilisateur avec cet email/téléphone existe déjà",
+		msgUserDoesNotExist:       "erreur aucun utilisateur avec cet email/téléphone",
+		msgWrongOtp:               "erreur code otp incorrect",
+	},
+}
+
+// requestLocale returns the locale preferred by the Accept-Language header of r.
+func requestLocale(r *http.Request) models.Locale {
+	return models.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+}
+
+// translate formats the message of key in locale, falling back to the default locale.
+func translate(locale models.Locale, key messageKey, args ...interface{}) string {
+	message, ok := messages[locale][key]
+	if !ok {
+		message = messages[models.DefaultLocale][key]
+	}
+	return fmt.Sprintf(message, args...)
+}
+
+// localizedError replies with the message of key in the locale of the request.
+func localizedError(w http.ResponseWriter, r *http.Request, status int, key messageKey, args ...interface{}) {
+	locale := requestLocale(r)
+	w.Header().Set("Content-Language", locale.String())
+	http.Error(w, translate(locale, key, args...), status)
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+
+	"cyberix.fr/frcc/messaging"
+	"github.com/go-chi/chi/v5"
+)
+
+type iMailbox interface {
+	List() ([]messaging.MailboxEntry, error)
+	Get(id string) (*messaging.MailboxMessage, error)
+}
+
+var mailboxTemplate = template.Must(template.New("mailbox").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="UTF-8" />
+  <title>Mailbox</title>
+  <style>
+    body { font-family: "Helvetica Neue", Helvetica, Arial, sans-serif; color: #333; margin: 2em; }
+    table { border-collapse: collapse; width: 100%; }
+    th, td { text-align: left; padding: 6px 10px; border-bottom: 1px solid #eee; }
+    a { color: #00bc69; }
+  </style>
+</head>
+<body>
+  <h1>Mailbox</h1>
+  <table>
+    <tr><th>Date</th><th>To</th><th>Subject</th><th></th></tr>
+    {{range .}}
+    <tr>
+      <td>{{.Date.Format "2006-01-02 15:04:05"}}</td>
+      <td>{{.To}}</td>
+      <td><a href="/dev/mailbox/{{.ID}}">{{.Subject}}</a></td>
+      <td><a href="/dev/mailbox/{{.ID}}?format=text">text</a></td>
+    </tr>
+    {{else}}
+    <tr><td colspan="4">No email yet.</td></tr>
+    {{end}}
+  </table>
+</body>
+</html>`))
+
+// Mailbox serves the emails caught by the development mailbox transport.
+func (appHandler *AppHandler) Mailbox(mux chi.Router, mailbox iMailbox) {
+	mux.Get("/dev/mailbox", func(w http.ResponseWriter, r *http.Request) {
+		entries, err := mailbox.List()
+		if err != nil {
+			http.Error(w, "error listing mailbox", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := mailboxTemplate.Execute(w, entries); err != nil {
+			http.Error(w, "error rendering mailbox", http.StatusInternalServerError)
+			return
+		}
+	})
+
+	mux.Get("/dev/mailbox/{id}", func(w http.ResponseWriter, r *http.Request) {
+		message, err := mailbox.Get(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "error email not found", http.StatusNotFound)
+			return
+		}
+
+		if r.URL.Query().Get("format") == "text" || message.HtmlBody == "" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			_, _ = w.Write([]byte(message.TextBody))
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(message.HtmlBody))
+	})
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cyberix.fr/frcc/logging"
+	"cyberix.fr/frcc/messaging"
+	"cyberix.fr/frcc/models"
+	"cyberix.fr/frcc/storage"
+	"github.com/go-chi/chi/v5"
+)
+
+type iPreferencesStore interface {
+	GetUserByEmailOrPhone(ctx context.Context, arg storage.GetUserByEmailOrPhoneParams) (*models.User, error)
+	GetMarketingConsent(ctx context.Context, userID int32) (*models.MarketingConsent, error)
+	UpdateMarketingConsentTx(ctx context.Context, arg storage.UpdateMarketingConsentTxParams) (*models.MarketingConsent, error)
+}
+
+type PreferencesResponse struct {
+	Email            string `json:"email"`
+	MarketingConsent bool   `json:"marketing_consent"`
+	// ConsentSource, ConsentVersion and ConsentedAt describe the consent decision in effect, if any.
+	ConsentSource  string     `json:"consent_source,omitempty"`
+	ConsentVersion string     `json:"consent_version,omitempty"`
+	ConsentedAt    *time.Time `json:"consented_at,omitempty"`
+}
+
+type UpdatePreferencesRequest struct {
+	MarketingConsent bool `json:"marketing_consent"`
+	// ConsentVersion identifies the consent text shown, required when consenting.
+	ConsentVersion string `json:"consent_version,omitempty"`
+}
+
+// Preferences serves the email preferences of the logged in user, or of the recipient of the
+// preferences link of a campaign email, given by its token.
+func (appHandler *AppHandler) Preferences(mux chi.Router, db iPreferencesStore) {
+	mux.Get("/me/preferences", func(w http.ResponseWriter, r *http.Request) {
+		user, status, err := appHandler.preferencesUser(r, db)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		consent, err := db.GetMarketingConsent(r.Context(), user.ID)
+		if err != nil {
+			http.Error(w, fmt.Errorf("error getting marketing consent: %v", err).Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(preferencesResponse(user, consent)); err != nil {
+			http.Error(w, "error encoding the result", http.StatusBadRequest)
+			return
+		}
+	})
+
+	mux.Put("/me/preferences", func(w http.ResponseWriter, r *http.Request) {
+		user, status, err := appHandler.preferencesUser(r, db)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		var input UpdatePreferencesRequest
+		httpStatus, err := appHandler.ParsingRequestBody(w, r, &input)
+		if err != nil {
+			http.Error(w, err.Error(), httpStatus)
+			return
+		}
+
+		if input.MarketingConsent && input.ConsentVersion == "" {
+			localizedError(w, r, http.StatusBadRequest, msgConsentVersionRequired)
+			return
+		}
+
+		consent, err := db.UpdateMarketingConsentTx(r.Context(), storage.UpdateMarketingConsentTxParams{
+			CreateMarketingConsentParams: storage.CreateMarketingConsentParams{
+				UserID:      user.ID,
+				Granted:     input.MarketingConsent,
+				Source:      models.MarketingConsentSourcePreferences,
+				TextVersion: input.ConsentVersion,
+			},
+			Email: user.Email,
+		})
+		if err != nil {
+			http.Error(w, fmt.Errorf("error updating marketing consent: %v", err).Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(preferencesResponse(user, consent)); err != nil {
+			http.Error(w, "error encoding the result", http.StatusBadRequest)
+			return
+		}
+	})
+}
+
+// Unsubscribe withdraws the marketing consent of the recipient of a campaign email in one click,
+// as mail clients do with the List-Unsubscribe-Post header (RFC 8058). It takes effect for the
+// campaigns already sending, whose remaining emails are skipped.
+func (appHandler *AppHandler) Unsubscribe(mux chi.Router, db iPreferencesStore) {
+	mux.Post("/unsubscribe", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		email, ok := messaging.ParseUnsubscribeToken(appHandler.unsubscribeKey, query.Get("token"))
+		if !ok {
+			http.Error(w, "error invalid unsubscribe token", http.StatusUnauthorized)
+			return
+		}
+
+		var campaignID *int64
+		if id, err := strconv.ParseInt(query.Get("campaign"), 10, 64); err == nil {
+			campaignID = &id
+		}
+
+		user, err := db.GetUserByEmailOrPhone(r.Context(), storage.GetUserByEmailOrPhoneParams{
+			Email: email,
+			Phone: email,
+		})
+		if err != nil {
+			http.Error(w, fmt.Errorf("error getting user: %v", err).Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if user == nil {
+			http.Error(w, "error user does not exist", http.StatusNotFound)
+			return
+		}
+
+		_, err = db.UpdateMarketingConsentTx(r.Context(), storage.UpdateMarketingConsentTxParams{
+			CreateMarketingConsentParams: storage.CreateMarketingConsentParams{
+				UserID:  user.ID,
+				Granted: false,
+				Source:  models.MarketingConsentSourceUnsubscribe,
+			},
+			Email:      user.Email,
+			CampaignID: campaignID,
+		})
+		if err != nil {
+			http.Error(w, fmt.Errorf("error unsubscribing: %v", err).Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(true); err != nil {
+			http.Error(w, "error encoding the result", http.StatusBadRequest)
+			return
+		}
+	})
+}
+
+// preferencesUser returns the user of the unsubscribe token of the request, or of its session.
+func (appHandler *AppHandler) preferencesUser(r *http.Request, db iPreferencesStore) (*models.User, int, error) {
+	var email string
+	if token := r.URL.Query().Get("token"); token != "" {
+		var ok bool
+		if email, ok = messaging.ParseUnsubscribeToken(appHandler.unsubscribeKey, token); !ok {
+			return nil, http.StatusUnauthorized, fmt.Errorf("error invalid unsubscribe token")
+		}
+	} else {
+		claims, err := appHandler.claimsFromCookie(r)
+		if err != nil {
+			return nil, http.StatusUnauthorized, fmt.Errorf("error not logged in")
+		}
+		email = claims.Email
+	}
+
+	user, err := db.GetUserByEmailOrPhone(r.Context(), storage.GetUserByEmailOrPhoneParams{
+		Email: email,
+		Phone: email,
+	})
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("error getting user: %v", err)
+	}
+
+	if user == nil {
+		return nil, http.StatusNotFound, fmt.Errorf("error user does not exist")
+	}
+	logging.SetUserID(r.Context(), strconv.Itoa(int(user.ID)))
+
+	return user, http.StatusOK, nil
+}
+
+func preferencesResponse(user *models.User, consent *models.MarketingConsent) PreferencesResponse {
+	response := PreferencesResponse{Email: user.Email}
+	if consent != nil {
+		response.MarketingConsent = consent.Granted
+		response.ConsentSource = consent.Source
+		response.ConsentVersion = consent.TextVersion
+		response.ConsentedAt = &consent.CreatedAt
+	}
+	return response
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"cyberix.fr/frcc/messaging"
+	"cyberix.fr/frcc/models"
+	"cyberix.fr/frcc/storage"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+type iDeliveryRecorder interface {
+	UpdateEmailDeliveryStatus(ctx context.Context, arg storage.UpdateEmailDeliveryStatusParams) (*models.EmailDelivery, error)
+	CreateEmailSuppression(ctx context.Context, arg storage.CreateEmailSuppressionParams) error
+}
+
+// DeliveryWebhookRequest is a delivery, bounce or spam complaint event as sent by Postmark.
+// See https://postmarkapp.com/developer/webhooks/webhooks-overview for the payloads.
+type DeliveryWebhookRequest struct {
+	RecordType  string            `json:"RecordType"`
+	Type        string            `json:"Type"`
+	MessageID   string            `json:"MessageID"`
+	Recipient   string            `json:"Recipient"`
+	Email       string            `json:"Email"`
+	Description string            `json:"Description"`
+	Details     string            `json:"Details"`
+	Inactive    bool              `json:"Inactive"`
+	Metadata    map[string]string `json:"Metadata"`
+}
+
+// hardBounceTypes are the Postmark bounce types after which the address is never written to again.
+var hardBounceTypes = map[string]bool{
+	"HardBounce":          true,
+	"BadEmailAddress":     true,
+	"ManuallyDeactivated": true,
+}
+
+// DeliveryWebhook records the delivery events of the email provider, and adds hard-bouncing
+// and complaining addresses to the suppression list.
+func (appHandler *AppHandler) DeliveryWebhook(mux chi.Router, db iDeliveryRecorder, log *zap.Logger) {
+	mux.Post("/webhooks/email", func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		// providers add fields over time, unknown ones are ignored
+		var input DeliveryWebhookRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1048576)).Decode(&input); err != nil {
+			http.Error(w, "error decoding webhook payload", http.StatusBadRequest)
+			return
+		}
+
+		recipient := input.Email
+		if recipient == "" {
+			recipient = input.Recipient
+		}
+
+		var (
+			status     models.EmailDeliveryStatus
+			suppressAs models.EmailSuppressionReason
+			detail     = input.Details
+		)
+		switch input.RecordType {
+		case "Delivery":
+			status = models.EmailDeliveryStatusDelivered
+		case "Bounce":
+			status = models.EmailDeliveryStatusSoftBounce
+			detail = fmt.Sprintf("%v: %v", input.Type, input.Description)
+			if input.Inactive || hardBounceTypes[input.Type] {
+				status = models.EmailDeliveryStatusBounced
+				suppressAs = models.EmailSuppressionReasonHardBounce
+			}
+		case "SpamComplaint":
+			status = models.EmailDeliveryStatusComplained
+			suppressAs = models.EmailSuppressionReasonSpamComplaint
+		default:
+			// opens, clicks and subscription changes are not tracked
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		if suppressAs != "" && recipient != "" {
+			err := db.CreateEmailSuppression(ctx, storage.CreateEmailSuppressionParams{
+				Email:  recipient,
+				Reason: suppressAs,
+				Detail: detail,
+			})
+			if err != nil {
+				http.Error(w, fmt.Errorf("error adding email to the suppression list: %v", err).Error(), http.StatusInternalServerError)
+				return
+			}
+
+			log.Info("Email address suppressed", zap.String("reason", suppressAs), zap.String("message_id", input.MessageID))
+		}
+
+		if messageID := input.Metadata[messaging.PostmarkMessageIDMetadata]; messageID != "" {
+			delivery, err := db.UpdateEmailDeliveryStatus(ctx, storage.UpdateEmailDeliveryStatusParams{
+				MessageID: messageID,
+				Status:    status,
+				Detail:    detail,
+			})
+			if err != nil {
+				http.Error(w, fmt.Errorf("error updating email delivery: %v", err).Error(), http.StatusInternalServerError)
+				return
+			}
+
+			if delivery == nil {
+				log.Info("No email delivery for webhook event", zap.String("message_id", messageID))
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(true); err != nil {
+			http.Error(w, "error encoding the result", http.StatusBadRequest)
+			return
+		}
+	})
+}
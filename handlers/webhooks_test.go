@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"cyberix.fr/frcc/messaging"
+	"cyberix.fr/frcc/models"
+	"cyberix.fr/frcc/storage"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// newWebhookMux serves the delivery webhook, with a sent email recorded under message ID "1".
+func newWebhookMux(t *testing.T) (http.Handler, *storage.MemoryStorage) {
+	t.Helper()
+
+	s := storage.NewMemoryStorage()
+	err := s.CreateEmailDelivery(context.Background(), storage.CreateEmailDeliveryParams{
+		MessageID: "1",
+		Provider:  "postmark",
+		Recipient: "jane@example.com",
+		Tag:       "otp_email",
+		Status:    models.EmailDeliveryStatusSent,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := chi.NewMux()
+	NewAppHandler(NewAppHandlerOptions{}).DeliveryWebhook(mux, s, zap.NewNop())
+	return mux, s
+}
+
+func postWebhook(t *testing.T, mux http.Handler, event DeliveryWebhookRequest) {
+	t.Helper()
+
+	event.Metadata = map[string]string{messaging.PostmarkMessageIDMetadata: "1"}
+	body, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/webhooks/email", strings.NewReader(string(body))))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected the webhook to be accepted, got %v %q", w.Code, w.Body.String())
+	}
+}
+
+func TestDeliveryWebhook(t *testing.T) {
+	tests := map[string]struct {
+		event      DeliveryWebhookRequest
+		status     models.EmailDeliveryStatus
+		suppressed models.EmailSuppressionReason
+	}{
+		"delivery": {
+			event:  DeliveryWebhookRequest{RecordType: "Delivery", Recipient: "jane@example.com"},
+			status: models.EmailDeliveryStatusDelivered,
+		},
+		"soft bounce": {
+			event:  DeliveryWebhookRequest{RecordType: "Bounce", Type: "SoftBounce", Email: "jane@example.com"},
+			status: models.EmailDeliveryStatusSoftBounce,
+		},
+		"hard bounce": {
+			event:      DeliveryWebhookRequest{RecordType: "Bounce", Type: "HardBounce", Email: "Jane@Example.com"},
+			status:     models.EmailDeliveryStatusBounced,
+			suppressed: models.EmailSuppressionReasonHardBounce,
+		},
+		"inactive address": {
+			event:      DeliveryWebhookRequest{RecordType: "Bounce", Type: "Transient", Email: "jane@example.com", Inactive: true},
+			status:     models.EmailDeliveryStatusBounced,
+			suppressed: models.EmailSuppressionReasonHardBounce,
+		},
+		"spam complaint": {
+			event:      DeliveryWebhookRequest{RecordType: "SpamComplaint", Email: "jane@example.com"},
+			status:     models.EmailDeliveryStatusComplained,
+			suppressed: models.EmailSuppressionReasonSpamComplaint,
+		},
+		"untracked event": {
+			event:  DeliveryWebhookRequest{RecordType: "Open", Recipient: "jane@example.com"},
+			status: models.EmailDeliveryStatusSent,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			mux, s := newWebhookMux(t)
+			postWebhook(t, mux, test.event)
+
+			deliveries, err := s.ListEmailDeliveries(context.Background(), storage.ListEmailDeliveriesParams{Limit: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(deliveries) != 1 || deliveries[0].Status != test.status {
+				t.Fatalf("expected the delivery to be %v, got %+v", test.status, deliveries)
+			}
+
+			suppression, err := s.GetEmailSuppression(context.Background(), "jane@example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch {
+			case test.suppressed == "" && suppression != nil:
+				t.Fatalf("expected the address not to be suppressed, got %+v", suppression)
+			case test.suppressed != "" && (suppression == nil || suppression.Reason != test.suppressed):
+				t.Fatalf("expected the address to be suppressed for %v, got %+v", test.suppressed, suppression)
+			}
+		})
+	}
+}
+
+func TestDeliveryWebhookRejectsInvalidPayload(t *testing.T) {
+	mux, _ := newWebhookMux(t)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/webhooks/email", strings.NewReader("{")))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected the payload to be rejected, got %v", w.Code)
+	}
+}
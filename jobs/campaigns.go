@@ -0,0 +1,218 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"cyberix.fr/frcc/messaging"
+	"cyberix.fr/frcc/models"
+	"cyberix.fr/frcc/storage"
+)
+
+type iCampaignBatcher interface {
+	GetCampaign(ctx context.Context, id int64) (*models.Campaign, error)
+	StartCampaignTx(ctx context.Context, id int64) (*models.Campaign, int64, error)
+	QueueCampaignBatchTx(ctx context.Context, arg storage.QueueCampaignBatchTxParams) (int, error)
+	ExpireCampaignRecipientClaims(ctx context.Context, arg storage.ExpireCampaignRecipientClaimsParams) (int64, error)
+	CountCampaignRecipients(ctx context.Context, campaignID int64) (map[models.CampaignRecipientStatus]int64, error)
+	CreateScheduledJob(ctx context.Context, arg storage.CreateScheduledJobParams) error
+	FinishCampaign(ctx context.Context, id int64) error
+}
+
+// campaignClaimTimeout is how long a campaign_email job may take from claiming a recipient to
+// recording the outcome, after which the job is deemed to have stopped.
+const campaignClaimTimeout = 10 * time.Minute
+
+// SendCampaignBatch starts a scheduled campaign and queues a campaign_email job for up to
+// batchSize of its pending recipients, scheduling the next batch interval later until no
+// recipient is left pending, queued or sending, when the campaign is finished.
+// Recipients claimed longer than campaignClaimTimeout ago are failed rather than sent again,
+// since the email may have gone out before their job stopped.
+func SendCampaignBatch(r registry, db iCampaignBatcher, batchSize int32, interval time.Duration) {
+	r.Register("campaign_batch", func(ctx context.Context, m models.Message) error {
+		ctx, cancel := context.WithTimeout(ctx, time.Minute)
+		defer cancel()
+
+		id, err := strconv.ParseInt(m["campaign_id"], 10, 64)
+		if err != nil {
+			return fmt.Errorf("error parsing campaign id in message: %w", err)
+		}
+
+		campaign, err := db.GetCampaign(ctx, id)
+		if err != nil {
+			return fmt.Errorf("error getting campaign: %w", err)
+		}
+
+		if campaign == nil {
+			return nil
+		}
+
+		switch campaign.Status {
+		case models.CampaignStatusScheduled:
+			// the job of a date the campaign was since rescheduled from
+			if campaign.SendAt == nil || campaign.SendAt.After(time.Now()) {
+				return nil
+			}
+
+			campaign, _, err = db.StartCampaignTx(ctx, id)
+			if err != nil {
+				return fmt.Errorf("error starting campaign: %w", err)
+			}
+
+			if campaign == nil {
+				return nil
+			}
+		case models.CampaignStatusSending:
+		default:
+			return nil
+		}
+
+		_, err = db.QueueCampaignBatchTx(ctx, storage.QueueCampaignBatchTxParams{
+			CampaignID: id,
+			Limit:      batchSize,
+			Message: func(recipient *models.CampaignRecipient) models.Message {
+				return models.Message{
+					"job":                   "campaign_email",
+					"campaign_recipient_id": strconv.FormatInt(recipient.ID, 10),
+
+					messaging.DeduplicationIDKey: fmt.Sprintf("campaign_recipient:%v", recipient.ID),
+				}
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("error queuing campaign batch: %w", err)
+		}
+
+		_, err = db.ExpireCampaignRecipientClaims(ctx, storage.ExpireCampaignRecipientClaimsParams{
+			CampaignID:    id,
+			ClaimedBefore: time.Now().Add(-campaignClaimTimeout),
+		})
+		if err != nil {
+			return fmt.Errorf("error expiring campaign recipient claims: %w", err)
+		}
+
+		counts, err := db.CountCampaignRecipients(ctx, id)
+		if err != nil {
+			return fmt.Errorf("error counting campaign recipients: %w", err)
+		}
+
+		remaining := counts[models.CampaignRecipientStatusPending] + counts[models.CampaignRecipientStatusQueued] + counts[models.CampaignRecipientStatusSending]
+		if remaining == 0 {
+			if err := db.FinishCampaign(ctx, id); err != nil {
+				return fmt.Errorf("error finishing campaign: %w", err)
+			}
+			return nil
+		}
+
+		runAt := time.Now().Add(interval).UTC()
+		key := fmt.Sprintf("campaign:%v:batch:%v", id, runAt.Unix())
+		err = db.CreateScheduledJob(ctx, storage.CreateScheduledJobParams{
+			Key:     &key,
+			Payload: models.Message{"job": "campaign_batch", "campaign_id": m["campaign_id"]},
+			RunAt:   runAt,
+		})
+		if err != nil {
+			return fmt.Errorf("error scheduling next campaign batch: %w", err)
+		}
+
+		return nil
+	})
+}
+
+type iCampaignRecipientStore interface {
+	GetCampaign(ctx context.Context, id int64) (*models.Campaign, error)
+	GetCampaignRecipient(ctx context.Context, id int64) (*models.CampaignRecipient, error)
+	ClaimCampaignRecipient(ctx context.Context, id int64) (*models.CampaignRecipient, error)
+	FinishCampaignRecipient(ctx context.Context, arg storage.FinishCampaignRecipientParams) error
+	GetMarketingOptOut(ctx context.Context, email string) (*models.MarketingOptOut, error)
+}
+
+type iCampaignEmailSender interface {
+	SendCampaignEmail(ctx context.Context, to models.Email, locale models.Locale, name string, campaign *models.Campaign) error
+}
+
+// SendCampaignEmail sends the campaign to one recipient, skipping those who opted out since
+// the audience was snapshotted and every recipient of a cancelled campaign.
+// The recipient is claimed before sending, so that a retry never sends the email again when an
+// attempt sent it but failed to record it, the recipient then staying in the sending status.
+func SendCampaignEmail(r registry, db iCampaignRecipientStore, es iCampaignEmailSender) {
+	r.Register("campaign_email", func(ctx context.Context, m models.Message) error {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+
+		id, err := strconv.ParseInt(m["campaign_recipient_id"], 10, 64)
+		if err != nil {
+			return fmt.Errorf("error parsing campaign recipient id in message: %w", err)
+		}
+
+		recipient, err := db.GetCampaignRecipient(ctx, id)
+		if err != nil {
+			return fmt.Errorf("error getting campaign recipient: %w", err)
+		}
+
+		switch {
+		case recipient == nil:
+			return nil
+		case recipient.Status == models.CampaignRecipientStatusSending, recipient.Status == models.CampaignRecipientStatusSent, recipient.Status == models.CampaignRecipientStatusSkipped:
+			return nil
+		}
+
+		campaign, err := db.GetCampaign(ctx, recipient.CampaignID)
+		if err != nil {
+			return fmt.Errorf("error getting campaign: %w", err)
+		}
+
+		if campaign == nil || campaign.Status == models.CampaignStatusCancelled {
+			return finishCampaignRecipient(ctx, db, id, models.CampaignRecipientStatusSkipped, nil)
+		}
+
+		optOut, err := db.GetMarketingOptOut(ctx, recipient.Email)
+		if err != nil {
+			return fmt.Errorf("error checking marketing opt-out: %w", err)
+		}
+
+		if optOut != nil {
+			return finishCampaignRecipient(ctx, db, id, models.CampaignRecipientStatusSkipped, nil)
+		}
+
+		recipient, err = db.ClaimCampaignRecipient(ctx, id)
+		if err != nil {
+			return fmt.Errorf("error claiming campaign recipient: %w", err)
+		}
+
+		if recipient == nil {
+			return nil
+		}
+
+		err = es.SendCampaignEmail(ctx, models.Email(recipient.Email), recipient.Locale, recipient.Name, campaign)
+		if err != nil {
+			errorAsString := err.Error()
+			if errors.Is(err, messaging.ErrRecipientSuppressed) {
+				return finishCampaignRecipient(ctx, db, id, models.CampaignRecipientStatusSkipped, &errorAsString)
+			}
+
+			if err := finishCampaignRecipient(ctx, db, id, models.CampaignRecipientStatusFailed, &errorAsString); err != nil {
+				return err
+			}
+			return fmt.Errorf("error sending campaign email: %w", err)
+		}
+
+		return finishCampaignRecipient(ctx, db, id, models.CampaignRecipientStatusSent, nil)
+	})
+}
+
+func finishCampaignRecipient(ctx context.Context, db iCampaignRecipientStore, id int64, status models.CampaignRecipientStatus, lastError *string) error {
+	err := db.FinishCampaignRecipient(ctx, storage.FinishCampaignRecipientParams{
+		ID:        id,
+		Status:    status,
+		LastError: lastError,
+	})
+	if err != nil {
+		return fmt.Errorf("error recording campaign recipient status: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,229 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"cyberix.fr/frcc/models"
+	"cyberix.fr/frcc/storage"
+)
+
+// testRegistry keeps the registered jobs to be called directly.
+type testRegistry map[string]Func
+
+func (r testRegistry) Register(name string, fn Func) {
+	r[name] = fn
+}
+
+type fakeCampaignEmailSender struct {
+	err  error
+	sent []models.Email
+}
+
+func (es *fakeCampaignEmailSender) SendCampaignEmail(ctx context.Context, to models.Email, locale models.Locale, name string, campaign *models.Campaign) error {
+	es.sent = append(es.sent, to)
+	return es.err
+}
+
+type campaignTest struct {
+	jobs     testRegistry
+	sender   *fakeCampaignEmailSender
+	storage  *storage.MemoryStorage
+	campaign *models.Campaign
+}
+
+// newCampaignTest creates a campaign due now for the given number of consenting users, sent
+// in batches of batchSize recipients.
+func newCampaignTest(t *testing.T, users int, batchSize int32) *campaignTest {
+	t.Helper()
+	ctx := context.Background()
+
+	c := &campaignTest{
+		jobs:    testRegistry{},
+		sender:  &fakeCampaignEmailSender{},
+		storage: storage.NewMemoryStorage(),
+	}
+	SendCampaignBatch(c.jobs, c.storage, batchSize, time.Minute)
+	SendCampaignEmail(c.jobs, c.storage, c.sender)
+
+	for i := range users {
+		user, err := c.storage.CreateUser(ctx, storage.CreateUserParams{
+			FirstName: "Jane",
+			LastName:  "Doe",
+			Email:     fmt.Sprintf("jane%v@example.com", i),
+			Phone:     fmt.Sprintf("+23760000000%v", i),
+			Locale:    "fr",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = c.storage.CreateMarketingConsent(ctx, storage.CreateMarketingConsentParams{UserID: user.ID, Granted: true, Source: "test", TextVersion: "1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	campaign, err := c.storage.CreateCampaign(ctx, storage.CreateCampaignParams{
+		Name:     "News",
+		Subject:  "News",
+		Body:     "News",
+		Audience: models.CampaignAudience{IncludeUnconfirmed: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.campaign, err = c.storage.ScheduleCampaign(ctx, storage.ScheduleCampaignParams{ID: campaign.ID, SendAt: time.Now().Add(-time.Second)})
+	if err != nil || c.campaign == nil {
+		t.Fatalf("error scheduling campaign: %v", err)
+	}
+
+	return c
+}
+
+// runBatch runs the campaign_batch job and returns the campaign status.
+func (c *campaignTest) runBatch(t *testing.T) models.CampaignStatus {
+	t.Helper()
+
+	err := c.jobs["campaign_batch"](context.Background(), models.Message{"campaign_id": strconv.FormatInt(c.campaign.ID, 10)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	campaign, err := c.storage.GetCampaign(context.Background(), c.campaign.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return campaign.Status
+}
+
+func (c *campaignTest) runEmail(recipientID int64) error {
+	return c.jobs["campaign_email"](context.Background(), models.Message{"campaign_recipient_id": strconv.FormatInt(recipientID, 10)})
+}
+
+func (c *campaignTest) recipient(t *testing.T, id int64) *models.CampaignRecipient {
+	t.Helper()
+
+	recipient, err := c.storage.GetCampaignRecipient(context.Background(), id)
+	if err != nil || recipient == nil {
+		t.Fatalf("error getting campaign recipient: %v", err)
+	}
+	return recipient
+}
+
+func TestCampaignFinishesOnceNoRecipientIsQueued(t *testing.T) {
+	c := newCampaignTest(t, 3, 2)
+
+	if status := c.runBatch(t); status != models.CampaignStatusSending {
+		t.Fatalf("expected the campaign to be sending, got %v", status)
+	}
+
+	// the last recipient is queued while the first two are not sent yet
+	if status := c.runBatch(t); status != models.CampaignStatusSending {
+		t.Fatalf("expected the campaign to keep sending while recipients are queued, got %v", status)
+	}
+
+	for id := range int64(3) {
+		if err := c.runEmail(id + 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if status := c.runBatch(t); status != models.CampaignStatusSent {
+		t.Fatalf("expected the campaign to be sent, got %v", status)
+	}
+	if len(c.sender.sent) != 3 {
+		t.Fatalf("expected 3 emails, got %v", c.sender.sent)
+	}
+}
+
+func TestCampaignExpiresStaleClaims(t *testing.T) {
+	c := newCampaignTest(t, 1, 10)
+	ctx := context.Background()
+
+	c.runBatch(t)
+
+	// a job which claimed the recipient and stopped before recording the outcome
+	if _, err := c.storage.ClaimCampaignRecipient(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if status := c.runBatch(t); status != models.CampaignStatusSending {
+		t.Fatalf("expected the campaign to wait for the claimed recipient, got %v", status)
+	}
+
+	// the claim expires once it is older than the timeout
+	expired, err := c.storage.ExpireCampaignRecipientClaims(ctx, storage.ExpireCampaignRecipientClaimsParams{
+		CampaignID:    c.campaign.ID,
+		ClaimedBefore: time.Now().Add(time.Second),
+	})
+	if err != nil || expired != 1 {
+		t.Fatalf("expected the claim to expire, got %v, %v", expired, err)
+	}
+
+	if status := c.runBatch(t); status != models.CampaignStatusSent {
+		t.Fatalf("expected the campaign to be sent, got %v", status)
+	}
+	if recipient := c.recipient(t, 1); recipient.Status != models.CampaignRecipientStatusFailed || recipient.LastError == nil {
+		t.Fatalf("expected the recipient to be failed, got %+v", recipient)
+	}
+}
+
+func TestCampaignEmailIsNotSentAgainWhileClaimed(t *testing.T) {
+	c := newCampaignTest(t, 1, 10)
+	c.runBatch(t)
+
+	if _, err := c.storage.ClaimCampaignRecipient(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.runEmail(1); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.sender.sent) != 0 {
+		t.Fatalf("expected no email to a claimed recipient, got %v", c.sender.sent)
+	}
+}
+
+func TestCampaignEmailRetriesFailedRecipient(t *testing.T) {
+	c := newCampaignTest(t, 1, 10)
+	c.runBatch(t)
+
+	c.sender.err = errors.New("provider unavailable")
+	if err := c.runEmail(1); err == nil {
+		t.Fatal("expected the sending error to be returned for a retry")
+	}
+	if status := c.recipient(t, 1).Status; status != models.CampaignRecipientStatusFailed {
+		t.Fatalf("expected the recipient to be failed, got %v", status)
+	}
+
+	c.sender.err = nil
+	if err := c.runEmail(1); err != nil {
+		t.Fatal(err)
+	}
+	if status := c.recipient(t, 1).Status; status != models.CampaignRecipientStatusSent {
+		t.Fatalf("expected the recipient to be sent, got %v", status)
+	}
+}
+
+func TestCampaignEmailSkipsOptedOutRecipient(t *testing.T) {
+	c := newCampaignTest(t, 1, 10)
+	c.runBatch(t)
+
+	err := c.storage.CreateMarketingOptOut(context.Background(), storage.CreateMarketingOptOutParams{Email: "JANE0@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.runEmail(1); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.sender.sent) != 0 || c.recipient(t, 1).Status != models.CampaignRecipientStatusSkipped {
+		t.Fatalf("expected the recipient to be skipped, got %v", c.sender.sent)
+	}
+}
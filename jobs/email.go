@@ -4,18 +4,21 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
+	"cyberix.fr/frcc/metrics"
 	"cyberix.fr/frcc/models"
+	"cyberix.fr/frcc/storage"
 )
 
 type iVerificationEmailSender interface {
-	SendVerificationEmail(ctx context.Context, to models.Email, token string) error
+	SendVerificationEmail(ctx context.Context, to models.Email, locale models.Locale, token string) error
 }
 
 func SendVerificationEmail(r registry, es iVerificationEmailSender) {
 	r.Register("verification_email", func(ctx context.Context, m models.Message) error {
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 		defer cancel()
 
 		to, ok := m["email"]
@@ -28,7 +31,7 @@ func SendVerificationEmail(r registry, es iVerificationEmailSender) {
 			return errors.New("no token in message")
 		}
 
-		if err := es.SendVerificationEmail(ctx, models.Email(to), token); err != nil {
+		if err := es.SendVerificationEmail(ctx, models.Email(to), localeFromMessage(m), token); err != nil {
 			return fmt.Errorf("error sending verification email: %w", err)
 		}
 
@@ -37,12 +40,17 @@ func SendVerificationEmail(r registry, es iVerificationEmailSender) {
 }
 
 type iOtpEmailSender interface {
-	SendOtpEmail(ctx context.Context, to models.Email, name, otp string) error
+	SendOtpEmail(ctx context.Context, to models.Email, locale models.Locale, name, otp string) error
 }
 
-func SendOtpEmail(r registry, es iOtpEmailSender) {
+type iPayloadOpener interface {
+	Open(m models.Message, key string) (string, bool, error)
+}
+
+// SendOtpEmail sends the otp, which is only decrypted here when the queue encrypts it.
+func SendOtpEmail(r registry, es iOtpEmailSender, c iPayloadOpener) {
 	r.Register("otp_email", func(ctx context.Context, m models.Message) error {
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 		defer cancel()
 
 		to, ok := m["email"]
@@ -55,26 +63,31 @@ func SendOtpEmail(r registry, es iOtpEmailSender) {
 			return errors.New("no name in message")
 		}
 
-		otp, ok := m["otp"]
+		otp, ok, err := c.Open(m, "otp")
+		if err != nil {
+			return fmt.Errorf("error reading otp in message: %w", err)
+		}
+
 		if !ok {
 			return errors.New("no otp in message")
 		}
 
-		if err := es.SendOtpEmail(ctx, models.Email(to), name, otp); err != nil {
+		if err := es.SendOtpEmail(ctx, models.Email(to), localeFromMessage(m), name, otp); err != nil {
 			return fmt.Errorf("error sending verification email: %w", err)
 		}
+		metrics.RegistrationFunnel.WithLabelValues(metrics.FunnelOtpSent).Inc()
 
 		return nil
 	})
 }
 
 type iWelcomeEmailSender interface {
-	SendWelcomeEmail(ctx context.Context, to models.Email, name string) error
+	SendWelcomeEmail(ctx context.Context, to models.Email, locale models.Locale, name string) error
 }
 
 func SendWelcomeEmail(r registry, es iWelcomeEmailSender) {
 	r.Register("welcome_email", func(ctx context.Context, m models.Message) error {
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 		defer cancel()
 
 		to, ok := m["email"]
@@ -87,10 +100,88 @@ func SendWelcomeEmail(r registry, es iWelcomeEmailSender) {
 			return errors.New("no name in message")
 		}
 
-		if err := es.SendWelcomeEmail(ctx, models.Email(to), name); err != nil {
+		if err := es.SendWelcomeEmail(ctx, models.Email(to), localeFromMessage(m), name); err != nil {
 			return fmt.Errorf("error sending verification email: %w", err)
 		}
 
 		return nil
 	})
 }
+
+type iEventReminderEmailSender interface {
+	SendEventReminderEmail(ctx context.Context, to models.Email, locale models.Locale, name string, daysLeft int, startsAt time.Time) error
+}
+
+func SendEventReminderEmail(r registry, es iEventReminderEmailSender, startsAt time.Time) {
+	r.Register("event_reminder_email", func(ctx context.Context, m models.Message) error {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+
+		to, ok := m["email"]
+		if !ok {
+			return errors.New("no email address in message")
+		}
+
+		name, ok := m["name"]
+		if !ok {
+			return errors.New("no name in message")
+		}
+
+		daysLeft, err := strconv.Atoi(m["days_left"])
+		if err != nil {
+			return fmt.Errorf("error parsing days left in message: %w", err)
+		}
+
+		if err := es.SendEventReminderEmail(ctx, models.Email(to), localeFromMessage(m), name, daysLeft, startsAt); err != nil {
+			return fmt.Errorf("error sending event reminder email: %w", err)
+		}
+
+		return nil
+	})
+}
+
+type iRegistrationReminderEmailSender interface {
+	SendRegistrationReminderEmail(ctx context.Context, to models.Email, locale models.Locale, name string) error
+}
+
+type iUserGetter interface {
+	GetUserByEmailOrPhone(ctx context.Context, arg storage.GetUserByEmailOrPhoneParams) (*models.User, error)
+}
+
+// SendRegistrationReminderEmail nudges users who still have not confirmed their account.
+func SendRegistrationReminderEmail(r registry, db iUserGetter, es iRegistrationReminderEmailSender) {
+	r.Register("registration_reminder_email", func(ctx context.Context, m models.Message) error {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+
+		to, ok := m["email"]
+		if !ok {
+			return errors.New("no email address in message")
+		}
+
+		user, err := db.GetUserByEmailOrPhone(ctx, storage.GetUserByEmailOrPhoneParams{
+			Email: to,
+			Phone: to,
+		})
+		if err != nil {
+			return fmt.Errorf("error getting user: %w", err)
+		}
+
+		if user == nil || user.ConfirmedAccount {
+			return nil
+		}
+
+		name := fmt.Sprintf("%s %s", user.FirstName, user.LastName)
+		if err := es.SendRegistrationReminderEmail(ctx, models.Email(to), user.Locale, name); err != nil {
+			return fmt.Errorf("error sending registration reminder email: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// localeFromMessage returns the locale of the recipient, messages enqueued before locales
+// were introduced falling back to the default one.
+func localeFromMessage(m models.Message) models.Locale {
+	return models.ParseLocale(m["locale"])
+}
@@ -1,7 +1,20 @@
 package jobs
 
+import (
+	"cyberix.fr/frcc/models"
+)
+
 func (r *Runner) registerJobs() {
 	SendVerificationEmail(r, r.emailer)
-	SendOtpEmail(r, r.emailer)
+	SendOtpEmail(r, r.emailer, r.payloadCipher)
 	SendWelcomeEmail(r, r.emailer)
+	SendEventReminders(r, r.storage, r.eventStart)
+	SendEventReminderEmail(r, r.emailer, r.eventStart)
+	SendRegistrationReminderEmail(r, r.storage, r.emailer)
+	SendCampaignBatch(r, r.storage, r.campaignBatchSize, r.campaignBatchInterval)
+	SendCampaignEmail(r, r.storage, r.emailer)
+}
+
+func (s *Scheduler) registerSchedules() {
+	s.Every("event_reminders", "0 8 * * *", models.Message{"job": "event_reminders"})
 }
@@ -0,0 +1,79 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"cyberix.fr/frcc/messaging"
+	"cyberix.fr/frcc/models"
+	"cyberix.fr/frcc/storage"
+)
+
+// eventReminderDays are the number of days before the event at which attendees are reminded.
+var eventReminderDays = []int{7, 1}
+
+type iEventRemindersStorage interface {
+	GetConfirmedUsers(ctx context.Context) ([]*models.User, error)
+	ExecTx(ctx context.Context, fn func(storage.Querier) error) error
+}
+
+// SendEventReminders runs daily and, when the event is a reminder day away,
+// fans out one event_reminder_email job per confirmed attendee through the outbox.
+func SendEventReminders(r registry, db iEventRemindersStorage, startsAt time.Time) {
+	r.Register("event_reminders", func(ctx context.Context, m models.Message) error {
+		ctx, cancel := context.WithTimeout(ctx, time.Minute)
+		defer cancel()
+
+		daysLeft := daysBetween(time.Now().UTC(), startsAt.UTC())
+
+		remind := false
+		for _, d := range eventReminderDays {
+			if d == daysLeft {
+				remind = true
+			}
+		}
+		if !remind {
+			return nil
+		}
+
+		users, err := db.GetConfirmedUsers(ctx)
+		if err != nil {
+			return fmt.Errorf("error getting confirmed users: %w", err)
+		}
+
+		// the reminders are written at once, and keep their deduplication ID across runs so that
+		// a run repeated after a failure does not remind anyone twice
+		err = db.ExecTx(ctx, func(q storage.Querier) error {
+			for _, user := range users {
+				_, err := q.CreateOutboxMessage(ctx, models.Message{
+					"job":       "event_reminder_email",
+					"email":     user.Email,
+					"name":      fmt.Sprintf("%s %s", user.FirstName, user.LastName),
+					"days_left": strconv.Itoa(daysLeft),
+					"locale":    user.Locale.String(),
+
+					messaging.DeduplicationIDKey: fmt.Sprintf("event_reminder:%v:%v", daysLeft, user.ID),
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("error adding event reminders into outbox: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// daysBetween counts the calendar days from from to to.
+func daysBetween(from, to time.Time) int {
+	fromDay := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	toDay := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+
+	return int(toDay.Sub(fromDay).Hours() / 24)
+}
@@ -2,27 +2,55 @@ package jobs
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"sync"
 	"time"
 
 	"cyberix.fr/frcc/messaging"
+	"cyberix.fr/frcc/metrics"
 	"cyberix.fr/frcc/models"
+	"cyberix.fr/frcc/storage"
+	"cyberix.fr/frcc/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
 type Func = func(context.Context, models.Message) error
 
+// JobIDKey is the message key holding the ID under which job runs are tracked.
+const JobIDKey = "job_id"
+
 type Runner struct {
-	emailer *messaging.Emailer
-	jobs    map[string]Func
-	log     *zap.Logger
-	queue   *messaging.Queue
+	campaignBatchInterval time.Duration
+	campaignBatchSize     int32
+	emailer               *messaging.Emailer
+	eventStart            time.Time
+	jobs                  map[string]Func
+	log                   *zap.Logger
+	maxAttempts           int32
+	payloadCipher         *messaging.PayloadCipher
+	queue                 messaging.Queue
+	storage               storage.Storage
 }
 
 type NewRunnerOptions struct {
-	Emailer *messaging.Emailer
-	Log     *zap.Logger
-	Queue   *messaging.Queue
+	// CampaignBatchSize recipients of a campaign are queued every CampaignBatchInterval,
+	// to stay within the rate limits of the email providers.
+	CampaignBatchInterval time.Duration
+	CampaignBatchSize     int32
+	Emailer               *messaging.Emailer
+	EventStart            time.Time
+	Log                   *zap.Logger
+	MaxAttempts           int32
+	PayloadCipher         *messaging.PayloadCipher
+	Queue                 messaging.Queue
+	Storage               storage.Storage
 }
 
 func NewRunner(opts NewRunnerOptions) *Runner {
@@ -30,11 +58,29 @@ func NewRunner(opts NewRunnerOptions) *Runner {
 		opts.Log = zap.NewNop()
 	}
 
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 5
+	}
+
+	if opts.CampaignBatchSize <= 0 {
+		opts.CampaignBatchSize = 100
+	}
+
+	if opts.CampaignBatchInterval <= 0 {
+		opts.CampaignBatchInterval = time.Minute
+	}
+
 	return &Runner{
-		emailer: opts.Emailer,
-		jobs:    map[string]Func{},
-		log:     opts.Log,
-		queue:   opts.Queue,
+		campaignBatchInterval: opts.CampaignBatchInterval,
+		campaignBatchSize:     opts.CampaignBatchSize,
+		emailer:               opts.Emailer,
+		eventStart:            opts.EventStart,
+		jobs:                  map[string]Func{},
+		log:                   opts.Log,
+		maxAttempts:           opts.MaxAttempts,
+		payloadCipher:         opts.PayloadCipher,
+		queue:                 opts.Queue,
+		storage:               opts.Storage,
 	}
 }
 
@@ -67,15 +113,16 @@ func (r *Runner) receiveAndRun(ctx context.Context, wg *sync.WaitGroup) {
 		return
 	}
 
+	// a message which no job can run would be delivered again forever, it is recorded as failed
 	name, ok := (*m)["job"]
 	if !ok {
-		r.log.Info("Error getting job name from message")
+		r.discard(*m, receiptID, name, errors.New("no job name in message"))
 		return
 	}
 
 	job, ok := r.jobs[name]
 	if !ok {
-		r.log.Info("No job with this name", zap.String("name", name))
+		r.discard(*m, receiptID, name, fmt.Errorf("no job named %q", name))
 		return
 	}
 
@@ -83,22 +130,90 @@ func (r *Runner) receiveAndRun(ctx context.Context, wg *sync.WaitGroup) {
 	go func() {
 		defer wg.Done()
 
-		log := r.log.With(zap.String("name", name))
+		jobID := jobIDFromMessage(*m)
+		log := r.log.With(zap.String("name", name), zap.String("job_id", jobID))
 
-		defer func() {
-			if rec := recover(); rec != nil {
-				log.Info("Recovered from panic in job", zap.Any("recover", rec))
+		// the job span continues the trace of the request which queued the message, and jobs
+		// run to completion on shutdown as they did before being given the runner context
+		jobCtx, span := tracing.Tracer().Start(tracing.Extract(context.WithoutCancel(ctx), *m), "job "+name,
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(
+				attribute.String("job", name),
+				attribute.String("job.id", jobID),
+			),
+		)
+		defer span.End()
+
+		var attempts int32
+		run, err := r.storage.StartJobRun(ctx, storage.StartJobRunParams{
+			JobID:       jobID,
+			Name:        name,
+			Payload:     *m,
+			PayloadHash: hashPayload(*m),
+		})
+		switch {
+		case err != nil:
+			// without a run the attempts could not be counted, so the job is left to the next
+			// delivery of the message rather than run without a limit
+			log.Info("Error recording job run start, leaving message for redelivery", zap.Error(err))
+			return
+		case run == nil:
+			// The job already succeeded under this ID, so the message is a duplicate delivery
+			// or a resend of the same outbox message, which deduplication is relied on to drop.
+			log.Info("Job already succeeded, skipping duplicate message")
+			metrics.JobRuns.WithLabelValues(name, "duplicate").Inc()
+
+			deleteCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			if err := r.queue.Delete(deleteCtx, receiptID); err != nil {
+				log.Info("Error deleting duplicate message", zap.Error(err))
 			}
-		}()
+			return
+		default:
+			attempts = run.Attempts
+		}
 
 		before := time.Now()
-		if err := job(ctx, *m); err != nil {
-			log.Info("Error running job", zap.Error(err))
+		err = runJob(jobCtx, job, *m)
+		duration := time.Since(before)
+		tracing.RecordError(span, err)
+
+		status := models.JobRunStatusSucceeded
+		var lastError *string
+		if err != nil {
+			log.Info("Error running job", zap.Error(err), zap.Int32("attempts", attempts))
+
+			errorAsString := err.Error()
+			lastError = &errorAsString
+
+			// Leave the message in the queue to be received again, unless attempts are exhausted
+			// or the error is permanent, such as a suppressed recipient.
+			var permanentErr *messaging.PermanentError
+			status = models.JobRunStatusRetrying
+			if attempts >= r.maxAttempts || errors.As(err, &permanentErr) {
+				status = models.JobRunStatusFailed
+			}
+		} else {
+			log.Info("Successfully ran job", zap.Duration("duration", duration))
+		}
+		metrics.JobRuns.WithLabelValues(name, status).Inc()
+		metrics.JobDuration.WithLabelValues(name).Observe(duration.Seconds())
+
+		finishCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		err = r.storage.FinishJobRun(finishCtx, storage.FinishJobRunParams{
+			JobID:      jobID,
+			Status:     status,
+			DurationMs: duration.Milliseconds(),
+			LastError:  lastError,
+		})
+		if err != nil {
+			log.Info("Error recording job run result", zap.Error(err))
+		}
+
+		if status == models.JobRunStatusRetrying {
 			return
 		}
-		after := time.Now()
-		duration := after.Sub(before)
-		log.Info("Successfully ran job", zap.Duration("duration", duration))
 
 		deleteCtx, cancel := context.WithTimeout(context.Background(), time.Second)
 		defer cancel()
@@ -108,6 +223,88 @@ func (r *Runner) receiveAndRun(ctx context.Context, wg *sync.WaitGroup) {
 	}()
 }
 
+// discard records a message which cannot be run as a failed job run, and deletes it.
+func (r *Runner) discard(m models.Message, receiptID, name string, reason error) {
+	jobID := jobIDFromMessage(m)
+	log := r.log.With(zap.String("name", name), zap.String("job_id", jobID))
+	log.Info("Error running job, discarding message", zap.Error(reason))
+	metrics.JobRuns.WithLabelValues(name, models.JobRunStatusFailed).Inc()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	run, err := r.storage.StartJobRun(ctx, storage.StartJobRunParams{
+		JobID:       jobID,
+		Name:        name,
+		Payload:     m,
+		PayloadHash: hashPayload(m),
+	})
+	if err == nil && run != nil {
+		lastError := reason.Error()
+		err = r.storage.FinishJobRun(ctx, storage.FinishJobRunParams{
+			JobID:     jobID,
+			Status:    models.JobRunStatusFailed,
+			LastError: &lastError,
+		})
+	}
+	if err != nil {
+		log.Info("Error recording discarded job run", zap.Error(err))
+	}
+
+	if err := r.queue.Delete(ctx, receiptID); err != nil {
+		log.Info("Error deleting discarded message", zap.Error(err))
+	}
+}
+
+// runJob runs the job, turning a panic into an error.
+func runJob(ctx context.Context, job Func, m models.Message) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("recovered from panic in job: %v", rec)
+		}
+	}()
+
+	return job(ctx, m)
+}
+
+// jobIDFromMessage identifies the job across deliveries and re-enqueues of the same message,
+// falling back to the ID the queue gave the message, so that the attempts of a message sent
+// without a job or deduplication ID are still counted on a single run.
+func jobIDFromMessage(m models.Message) string {
+	if id, ok := m[JobIDKey]; ok {
+		return id
+	}
+
+	if id, ok := m[messaging.DeduplicationIDKey]; ok {
+		return id
+	}
+
+	if id, ok := m[messaging.MessageIDKey]; ok {
+		return "message:" + id
+	}
+
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// hashPayload hashes the message without its identifiers and trace context, so identical
+// payloads share a hash.
+func hashPayload(m models.Message) string {
+	payload := make(models.Message, len(m))
+	for k, v := range m {
+		if k == JobIDKey || k == messaging.DeduplicationIDKey || k == messaging.MessageIDKey || k == tracing.TraceparentKey || k == tracing.TracestateKey {
+			continue
+		}
+		payload[k] = v
+	}
+
+	// json.Marshal sorts map keys, which makes the encoding canonical.
+	payloadAsBytes, _ := json.Marshal(payload)
+	sum := sha256.Sum256(payloadAsBytes)
+	return hex.EncodeToString(sum[:])
+}
+
 type registry interface {
 	Register(name string, fn Func)
 }
@@ -0,0 +1,196 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"cyberix.fr/frcc/messaging"
+	"cyberix.fr/frcc/models"
+	"cyberix.fr/frcc/storage"
+)
+
+// newTestRunner runs jobs from a memory queue whose messages are received again 20ms after
+// being received when they are not deleted.
+func newTestRunner(t *testing.T, s storage.Storage) (*Runner, *messaging.MemoryQueue) {
+	t.Helper()
+
+	queue := messaging.NewMemoryQueue(messaging.NewMemoryQueueOptions{
+		VisibilityTimeout: 20 * time.Millisecond,
+		WaitTime:          50 * time.Millisecond,
+	})
+
+	r := NewRunner(NewRunnerOptions{
+		MaxAttempts: 2,
+		Queue:       queue,
+		Storage:     s,
+	})
+	return r, queue
+}
+
+// runOnce receives one message and waits for its job.
+func runOnce(r *Runner) {
+	var wg sync.WaitGroup
+	r.receiveAndRun(context.Background(), &wg)
+	wg.Wait()
+}
+
+func send(t *testing.T, queue messaging.Queue, m models.Message) {
+	t.Helper()
+
+	if err := queue.Send(context.Background(), m); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectEmptyQueue(t *testing.T, queue messaging.Queue) {
+	t.Helper()
+
+	m, _, err := queue.Receive(context.Background())
+	if err != nil || m != nil {
+		t.Fatalf("expected the message to be deleted, got %v, %v", m, err)
+	}
+}
+
+func jobRuns(t *testing.T, s storage.Storage) []*models.JobRun {
+	t.Helper()
+
+	runs, err := s.ListJobRuns(context.Background(), storage.ListJobRunsParams{Limit: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return runs
+}
+
+func TestRunnerRecordsSucceededRun(t *testing.T) {
+	s := storage.NewMemoryStorage()
+	r, queue := newTestRunner(t, s)
+	r.Register("test", func(ctx context.Context, m models.Message) error { return nil })
+
+	send(t, queue, models.Message{"job": "test", JobIDKey: "1"})
+	runOnce(r)
+
+	runs := jobRuns(t, s)
+	if len(runs) != 1 || runs[0].JobID != "1" || runs[0].Status != models.JobRunStatusSucceeded || runs[0].Attempts != 1 {
+		t.Fatalf("expected a succeeded run, got %+v", runs)
+	}
+	expectEmptyQueue(t, queue)
+}
+
+func TestRunnerRetriesUntilMaxAttempts(t *testing.T) {
+	s := storage.NewMemoryStorage()
+	r, queue := newTestRunner(t, s)
+	r.Register("test", func(ctx context.Context, m models.Message) error { return errors.New("failing") })
+
+	send(t, queue, models.Message{"job": "test"})
+
+	runOnce(r)
+	if runs := jobRuns(t, s); runs[0].Status != models.JobRunStatusRetrying {
+		t.Fatalf("expected the run to be retried, got %v", runs[0].Status)
+	}
+
+	// the message is received again once its visibility timeout expires, under the same run
+	runOnce(r)
+	runs := jobRuns(t, s)
+	if len(runs) != 1 || runs[0].Status != models.JobRunStatusFailed || runs[0].Attempts != 2 {
+		t.Fatalf("expected the run to fail after 2 attempts, got %+v", runs)
+	}
+	if runs[0].LastError == nil || *runs[0].LastError != "failing" {
+		t.Fatalf("expected the last error to be recorded, got %v", runs[0].LastError)
+	}
+	expectEmptyQueue(t, queue)
+}
+
+func TestRunnerStopsOnPermanentError(t *testing.T) {
+	s := storage.NewMemoryStorage()
+	r, queue := newTestRunner(t, s)
+	r.Register("test", func(ctx context.Context, m models.Message) error {
+		return &messaging.PermanentError{Err: errors.New("suppressed")}
+	})
+
+	send(t, queue, models.Message{"job": "test"})
+	runOnce(r)
+
+	if runs := jobRuns(t, s); runs[0].Status != models.JobRunStatusFailed || runs[0].Attempts != 1 {
+		t.Fatalf("expected the run to fail at once, got %+v", runs[0])
+	}
+	expectEmptyQueue(t, queue)
+}
+
+func TestRunnerSkipsSucceededDuplicate(t *testing.T) {
+	s := storage.NewMemoryStorage()
+	r, queue := newTestRunner(t, s)
+
+	calls := 0
+	r.Register("test", func(ctx context.Context, m models.Message) error {
+		calls++
+		return nil
+	})
+
+	send(t, queue, models.Message{"job": "test", JobIDKey: "1"})
+	send(t, queue, models.Message{"job": "test", JobIDKey: "1"})
+	runOnce(r)
+	runOnce(r)
+
+	if calls != 1 {
+		t.Fatalf("expected the job to run once, ran %v times", calls)
+	}
+	if runs := jobRuns(t, s); len(runs) != 1 || runs[0].Attempts != 1 {
+		t.Fatalf("expected a single run, got %+v", runs)
+	}
+	expectEmptyQueue(t, queue)
+}
+
+func TestRunnerDiscardsMessagesWithoutJob(t *testing.T) {
+	s := storage.NewMemoryStorage()
+	r, queue := newTestRunner(t, s)
+
+	send(t, queue, models.Message{"job": "unknown"})
+	send(t, queue, models.Message{"email": "jane@example.com"})
+	runOnce(r)
+	runOnce(r)
+
+	runs := jobRuns(t, s)
+	if len(runs) != 2 {
+		t.Fatalf("expected 2 runs, got %+v", runs)
+	}
+	for _, run := range runs {
+		if run.Status != models.JobRunStatusFailed || run.LastError == nil {
+			t.Fatalf("expected a failed run, got %+v", run)
+		}
+	}
+	expectEmptyQueue(t, queue)
+}
+
+// failingStartStorage cannot record job runs.
+type failingStartStorage struct {
+	*storage.MemoryStorage
+}
+
+func (s failingStartStorage) StartJobRun(ctx context.Context, arg storage.StartJobRunParams) (*models.JobRun, error) {
+	return nil, errors.New("database unavailable")
+}
+
+func TestRunnerLeavesMessageWhenRunIsNotRecorded(t *testing.T) {
+	r, queue := newTestRunner(t, failingStartStorage{storage.NewMemoryStorage()})
+
+	calls := 0
+	r.Register("test", func(ctx context.Context, m models.Message) error {
+		calls++
+		return nil
+	})
+
+	send(t, queue, models.Message{"job": "test"})
+	runOnce(r)
+
+	if calls != 0 {
+		t.Fatal("expected the job not to run without a job run")
+	}
+
+	m, _, err := queue.Receive(context.Background())
+	if err != nil || m == nil {
+		t.Fatalf("expected the message to be delivered again, got %v, %v", m, err)
+	}
+}
@@ -0,0 +1,197 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cyberix.fr/frcc/models"
+	"cyberix.fr/frcc/storage"
+	"github.com/robfig/cron/v3"
+	"go.uber.org/zap"
+)
+
+// schedulerLockKey identifies the Postgres advisory lock held by the leader scheduler.
+const schedulerLockKey int64 = 0x66726363
+
+type iScheduledJobStore interface {
+	CreateScheduledJob(ctx context.Context, arg storage.CreateScheduledJobParams) error
+	EnqueueDueScheduledJobsTx(ctx context.Context, limit int32) (int, error)
+}
+
+type iLocker interface {
+	TryAdvisoryLock(ctx context.Context, key int64) (*storage.AdvisoryLock, error)
+}
+
+// cronLookback bounds how far back the occurrences missed by the scheduler, while no instance
+// was leading or the leader was paused, are caught up.
+const cronLookback = 24 * time.Hour
+
+type cronEntry struct {
+	msg      models.Message
+	name     string
+	schedule cron.Schedule
+	// scheduledUntil is the time up to which the occurrences were scheduled by this instance.
+	scheduledUntil time.Time
+}
+
+// Scheduler turns recurring cron jobs and one-off delayed jobs into queue messages.
+// Only the instance holding the advisory lock schedules anything, the others stand by.
+// Without a Locker, as in demo mode, the instance is assumed to run alone and always schedules.
+type Scheduler struct {
+	batchSize int32
+	crons     []cronEntry
+	db        iScheduledJobStore
+	interval  time.Duration
+	locker    iLocker
+	log       *zap.Logger
+}
+
+type NewSchedulerOptions struct {
+	BatchSize int32
+	DB        iScheduledJobStore
+	Interval  time.Duration
+	Locker    iLocker
+	Log       *zap.Logger
+}
+
+func NewScheduler(opts NewSchedulerOptions) *Scheduler {
+	if opts.Log == nil {
+		opts.Log = zap.NewNop()
+	}
+
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+
+	if opts.Interval <= 0 {
+		opts.Interval = 10 * time.Second
+	}
+
+	return &Scheduler{
+		batchSize: opts.BatchSize,
+		db:        opts.DB,
+		interval:  opts.Interval,
+		locker:    opts.Locker,
+		log:       opts.Log,
+	}
+}
+
+// Every registers msg to be enqueued on the standard cron spec, evaluated in UTC.
+func (s *Scheduler) Every(name, spec string, msg models.Message) {
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		panic(fmt.Sprintf("invalid cron spec %q for %v: %v", spec, name, err))
+	}
+
+	s.crons = append(s.crons, cronEntry{
+		msg:      msg,
+		name:     name,
+		schedule: schedule,
+	})
+}
+
+func (s *Scheduler) Start(ctx context.Context) {
+	s.log.Info("Starting scheduler")
+	s.registerSchedules()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	var lock *storage.AdvisoryLock
+	for {
+		select {
+		case <-ctx.Done():
+			s.log.Info("Stopping scheduler")
+			if lock != nil {
+				releaseCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+				if err := lock.Release(releaseCtx); err != nil {
+					s.log.Info("Error releasing scheduler lock", zap.Error(err))
+				}
+				cancel()
+			}
+			return
+		case <-ticker.C:
+			if s.locker != nil {
+				lock = s.lead(ctx, lock)
+				if lock == nil {
+					continue
+				}
+			}
+
+			s.scheduleCrons(ctx, time.Now().UTC())
+			s.enqueueDue(ctx)
+		}
+	}
+}
+
+// lead returns the held lock if this instance is the leader, trying to become it otherwise.
+func (s *Scheduler) lead(ctx context.Context, lock *storage.AdvisoryLock) *storage.AdvisoryLock {
+	if lock != nil {
+		if err := lock.Ping(ctx); err == nil {
+			return lock
+		}
+
+		s.log.Info("Lost scheduler lock")
+		_ = lock.Release(ctx)
+	}
+
+	lock, err := s.locker.TryAdvisoryLock(ctx, schedulerLockKey)
+	if err != nil {
+		s.log.Info("Error taking scheduler lock", zap.Error(err))
+		return nil
+	}
+
+	if lock != nil {
+		s.log.Info("Elected scheduler leader")
+	}
+
+	return lock
+}
+
+// scheduleCrons stores the last cron occurrence since the previous call, or within cronLookback,
+// as a scheduled job. Missed occurrences are coalesced into the last one, a late run being enough.
+// Occurrences are keyed by name and time, so instances taking over never schedule a job twice.
+func (s *Scheduler) scheduleCrons(ctx context.Context, now time.Time) {
+	for i := range s.crons {
+		c := &s.crons[i]
+
+		from := c.scheduledUntil
+		if lookback := now.Add(-cronLookback); from.Before(lookback) {
+			from = lookback
+		}
+
+		var last time.Time
+		for t := c.schedule.Next(from); !t.After(now); t = c.schedule.Next(t) {
+			last = t
+		}
+
+		if !last.IsZero() {
+			key := fmt.Sprintf("cron:%v:%v", c.name, last.Unix())
+
+			err := s.db.CreateScheduledJob(ctx, storage.CreateScheduledJobParams{
+				Key:     &key,
+				Payload: c.msg,
+				RunAt:   last,
+			})
+			if err != nil {
+				s.log.Info("Error scheduling cron job", zap.String("name", c.name), zap.Error(err))
+				continue
+			}
+		}
+
+		c.scheduledUntil = now
+	}
+}
+
+func (s *Scheduler) enqueueDue(ctx context.Context) {
+	enqueued, err := s.db.EnqueueDueScheduledJobsTx(ctx, s.batchSize)
+	if err != nil {
+		s.log.Info("Error enqueuing scheduled jobs", zap.Error(err))
+		return
+	}
+
+	if enqueued > 0 {
+		s.log.Debug("Enqueued scheduled jobs", zap.Int("count", enqueued))
+	}
+}
@@ -0,0 +1,144 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"cyberix.fr/frcc/models"
+	"cyberix.fr/frcc/storage"
+)
+
+func scheduledJobs(t *testing.T, s *storage.MemoryStorage) []*models.ScheduledJob {
+	t.Helper()
+
+	jobs, err := s.GetDueScheduledJobsForUpdate(context.Background(), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jobs
+}
+
+func TestScheduleCronsCoalescesMissedOccurrences(t *testing.T) {
+	s := storage.NewMemoryStorage()
+	scheduler := NewScheduler(NewSchedulerOptions{DB: s})
+	scheduler.Every("hourly", "0 * * * *", models.Message{"job": "hourly"})
+
+	// the occurrences of the last day are coalesced into the last one
+	scheduler.scheduleCrons(context.Background(), time.Date(2026, 1, 1, 10, 30, 0, 0, time.UTC))
+
+	jobs := scheduledJobs(t, s)
+	if len(jobs) != 1 || !jobs[0].RunAt.Equal(time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected a single job at 10:00, got %+v", jobs)
+	}
+	if jobs[0].Key == nil || *jobs[0].Key != "cron:hourly:1767261600" || jobs[0].Payload["job"] != "hourly" {
+		t.Fatalf("expected the job to be keyed by name and time, got %+v", jobs[0])
+	}
+
+	// later calls only schedule the occurrences since the previous one
+	scheduler.scheduleCrons(context.Background(), time.Date(2026, 1, 1, 10, 50, 0, 0, time.UTC))
+	if jobs := scheduledJobs(t, s); len(jobs) != 1 {
+		t.Fatalf("expected no occurrence before 11:00, got %+v", jobs)
+	}
+
+	scheduler.scheduleCrons(context.Background(), time.Date(2026, 1, 1, 11, 5, 0, 0, time.UTC))
+	jobs = scheduledJobs(t, s)
+	if len(jobs) != 2 || !jobs[1].RunAt.Equal(time.Date(2026, 1, 1, 11, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected the 11:00 occurrence, got %+v", jobs)
+	}
+}
+
+func TestScheduleCronsOnceAcrossInstances(t *testing.T) {
+	s := storage.NewMemoryStorage()
+	now := time.Date(2026, 1, 1, 10, 30, 0, 0, time.UTC)
+
+	// an instance taking over the lead schedules the occurrences of the previous leader again
+	for range 2 {
+		scheduler := NewScheduler(NewSchedulerOptions{DB: s})
+		scheduler.Every("hourly", "0 * * * *", models.Message{"job": "hourly"})
+		scheduler.scheduleCrons(context.Background(), now)
+	}
+
+	if jobs := scheduledJobs(t, s); len(jobs) != 1 {
+		t.Fatalf("expected the occurrence to be scheduled once, got %+v", jobs)
+	}
+}
+
+// fakeLocker never gets the lock, another instance holding it or the database failing.
+type fakeLocker struct {
+	err   error
+	tries int
+}
+
+func (l *fakeLocker) TryAdvisoryLock(ctx context.Context, key int64) (*storage.AdvisoryLock, error) {
+	l.tries++
+	return nil, l.err
+}
+
+func TestSchedulerStandsByWithoutLock(t *testing.T) {
+	for name, err := range map[string]error{"held elsewhere": nil, "database error": errors.New("unavailable")} {
+		t.Run(name, func(t *testing.T) {
+			locker := &fakeLocker{err: err}
+			scheduler := NewScheduler(NewSchedulerOptions{Locker: locker})
+
+			if lock := scheduler.lead(context.Background(), nil); lock != nil {
+				t.Fatal("expected the scheduler to stand by")
+			}
+			if lock := scheduler.lead(context.Background(), nil); lock != nil || locker.tries != 2 {
+				t.Fatalf("expected the scheduler to try again on each tick, tried %v times", locker.tries)
+			}
+		})
+	}
+}
+
+func TestSchedulerEnqueuesDueJobsWhenLeading(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := storage.NewMemoryStorage()
+	key := "reminder:1"
+	err := s.CreateScheduledJob(ctx, storage.CreateScheduledJobParams{
+		Key:     &key,
+		Payload: models.Message{"job": "reminder"},
+		RunAt:   time.Now().Add(-time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// standby instances enqueue nothing
+	standby := NewScheduler(NewSchedulerOptions{DB: s, Interval: 5 * time.Millisecond, Locker: &fakeLocker{}})
+	standbyCtx, stopStandby := context.WithTimeout(ctx, 30*time.Millisecond)
+	defer stopStandby()
+	standby.Start(standbyCtx)
+
+	if outbox := outboxJobs(t, s); len(outbox) != 0 {
+		t.Fatalf("expected a standby scheduler to enqueue nothing, got %v", outbox)
+	}
+
+	// without a locker the instance runs alone and leads
+	alone := NewScheduler(NewSchedulerOptions{DB: s, Interval: 5 * time.Millisecond})
+	aloneCtx, stopAlone := context.WithTimeout(ctx, 30*time.Millisecond)
+	defer stopAlone()
+	alone.Start(aloneCtx)
+
+	if outbox := outboxJobs(t, s); !outbox["reminder"] {
+		t.Fatalf("expected the due job in the outbox, got %v", outbox)
+	}
+}
+
+func outboxJobs(t *testing.T, s *storage.MemoryStorage) map[string]bool {
+	t.Helper()
+
+	messages, err := s.GetUnpublishedOutboxMessagesForUpdate(context.Background(), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jobs := map[string]bool{}
+	for _, m := range messages {
+		jobs[m.Payload["job"]] = true
+	}
+	return jobs
+}
@@ -0,0 +1,74 @@
+package logging
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+type contextKey int
+
+const (
+	loggerKey contextKey = iota
+	requestKey
+)
+
+// WithLogger returns ctx carrying the request-scoped logger.
+func WithLogger(ctx context.Context, log *zap.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, log)
+}
+
+// FromContext returns the logger of the request, or a no-op one outside of a request.
+func FromContext(ctx context.Context) *zap.Logger {
+	if log, ok := ctx.Value(loggerKey).(*zap.Logger); ok {
+		return log
+	}
+	return zap.NewNop()
+}
+
+// RequestInfo is filled by handlers while serving a request, for the access log.
+type RequestInfo struct {
+	mutex  sync.Mutex
+	userID string
+}
+
+// WithRequestInfo returns ctx carrying info, to be read once the request is served.
+func WithRequestInfo(ctx context.Context, info *RequestInfo) context.Context {
+	return context.WithValue(ctx, requestKey, info)
+}
+
+// SetUserID records the user the request was made by or about, once known to the handler.
+func SetUserID(ctx context.Context, id string) {
+	if info, ok := ctx.Value(requestKey).(*RequestInfo); ok {
+		info.mutex.Lock()
+		defer info.mutex.Unlock()
+		info.userID = id
+	}
+}
+
+func (i *RequestInfo) UserID() string {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return i.userID
+}
+
+// Email returns a field holding the email address with its local part masked,
+// such as j***@example.com, which is enough to tell addresses apart in logs.
+func Email(key, email string) zap.Field {
+	return zap.String(key, RedactEmail(email))
+}
+
+func RedactEmail(email string) string {
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok || local == "" {
+		return "***"
+	}
+	return local[:1] + "***@" + domain
+}
+
+// Redacted returns a field whose value is never logged, such as an OTP.
+func Redacted(key string) zap.Field {
+	return zap.String(key, redacted)
+}
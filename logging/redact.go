@@ -0,0 +1,97 @@
+package logging
+
+import (
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const redacted = "[REDACTED]"
+
+// Secret is a string which prints masked, through fmt as well as zap, so that a password or a
+// key cannot end up in logs by mistake. Its value is read by converting it back to a string.
+type Secret string
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+func (s Secret) GoString() string {
+	return s.String()
+}
+
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// sensitiveKeys are the parts of field names whose values are never logged.
+var sensitiveKeys = []string{"authorization", "cookie", "otp", "password", "secret", "token"}
+
+// Redact returns log with the values of its sensitive fields masked: fields named after a secret,
+// such as otp or password, are replaced, and email fields keep the first letter of the address.
+func Redact(log *zap.Logger) *zap.Logger {
+	return log.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &redactingCore{Core: core}
+	}))
+}
+
+type redactingCore struct {
+	zapcore.Core
+}
+
+func (c *redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactingCore{Core: c.Core.With(redactFields(fields))}
+}
+
+func (c *redactingCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *redactingCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	return c.Core.Write(entry, redactFields(fields))
+}
+
+func redactFields(fields []zapcore.Field) []zapcore.Field {
+	var out []zapcore.Field
+	for i, field := range fields {
+		replacement, ok := redactField(field)
+		if !ok {
+			continue
+		}
+
+		// fields are only copied once one needs replacing, as most need not
+		if out == nil {
+			out = make([]zapcore.Field, len(fields))
+			copy(out, fields)
+		}
+		out[i] = replacement
+	}
+
+	if out == nil {
+		return fields
+	}
+	return out
+}
+
+func redactField(field zapcore.Field) (zapcore.Field, bool) {
+	key := strings.ToLower(field.Key)
+
+	if field.Type == zapcore.StringType && (key == "email" || strings.HasSuffix(key, "_email")) {
+		return zap.String(field.Key, RedactEmail(field.String)), true
+	}
+
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(key, sensitive) {
+			return Redacted(field.Key), true
+		}
+	}
+
+	return field, false
+}
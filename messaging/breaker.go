@@ -0,0 +1,115 @@
+package messaging
+
+import (
+	"sync"
+	"time"
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreaker stops calling a failing provider after threshold consecutive failures.
+// Once cooldown has elapsed a single trial call is let through, closing the breaker again
+// on success and reopening it on failure.
+type circuitBreaker struct {
+	cooldown  time.Duration
+	failures  int
+	mutex     sync.Mutex
+	openedAt  time.Time
+	state     breakerState
+	threshold int
+	trial     bool
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	if threshold <= 0 {
+		threshold = 5
+	}
+
+	if cooldown <= 0 {
+		cooldown = 30 * time.Second
+	}
+
+	return &circuitBreaker{
+		cooldown:  cooldown,
+		threshold: threshold,
+	}
+}
+
+// allow reports whether a call may go through.
+func (b *circuitBreaker) allow() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		b.trial = true
+		return true
+	case breakerHalfOpen:
+		// only the trial call is allowed until its outcome is known
+		if b.trial {
+			return false
+		}
+		b.trial = true
+		return true
+	default:
+		return true
+	}
+}
+
+func (b *circuitBreaker) success() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.failures = 0
+	b.state = breakerClosed
+	b.trial = false
+}
+
+func (b *circuitBreaker) failure() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.failures++
+	b.trial = false
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// abandon releases a call allowed but never made, so that a trial call does not keep the
+// breaker half open.
+func (b *circuitBreaker) abandon() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.trial = false
+}
+
+func (b *circuitBreaker) currentState() breakerState {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.state
+}
@@ -0,0 +1,44 @@
+package messaging
+
+import (
+	"net/url"
+	"time"
+
+	"cyberix.fr/frcc/calendar"
+)
+
+// calendarAttachmentName is the name of the calendar attached to emails.
+const calendarAttachmentName = "invitation.ics"
+
+// EventCalendar returns the calendar of the event, with a UID kept across changes of the
+// agenda so that calendars update the event instead of adding a copy.
+func EventCalendar(event EventInfo) calendar.Calendar {
+	domain := "frcc"
+	if u, err := url.Parse(event.Website); err == nil && u.Host != "" {
+		domain = u.Host
+	}
+
+	return calendar.Calendar{
+		Name:   event.Name,
+		Method: calendar.MethodPublish,
+		Events: []calendar.Event{
+			{
+				UID:      "event@" + domain,
+				Summary:  event.Name,
+				Location: event.Location,
+				URL:      event.Website,
+				StartsAt: event.StartsAt,
+				EndsAt:   event.EndsAt,
+			},
+		},
+	}
+}
+
+// calendarAttachment attaches the calendar of the event.
+func calendarAttachment(event EventInfo) Attachment {
+	return Attachment{
+		Name:        calendarAttachmentName,
+		Content:     EventCalendar(event).Bytes(time.Now()),
+		ContentType: calendar.ContentType + "; method=" + calendar.MethodPublish,
+	}
+}
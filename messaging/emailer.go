@@ -1,18 +1,21 @@
 package messaging
 
 import (
-	"bytes"
 	"context"
 	"embed"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
-	"os"
-	"strings"
+	"io/fs"
+	"net/mail"
+	"net/url"
 	"time"
 
+	"cyberix.fr/frcc/metrics"
 	"cyberix.fr/frcc/models"
+	"cyberix.fr/frcc/storage"
+	"cyberix.fr/frcc/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
@@ -26,160 +29,272 @@ type nameAndEmail = string
 //go:embed emails
 var emails embed.FS
 
+// EmailTemplatesFS returns the embedded email templates, with one directory per locale at its root.
+func EmailTemplatesFS() fs.FS {
+	fsys, err := fs.Sub(emails, "emails")
+	if err != nil {
+		panic(err)
+	}
+	return fsys
+}
+
+// ErrRecipientSuppressed is returned when sending to an address on the suppression list.
+var ErrRecipientSuppressed = errors.New("recipient is on the suppression list")
+
+type iDeliveryStore interface {
+	CreateEmailDelivery(ctx context.Context, arg storage.CreateEmailDeliveryParams) error
+	GetEmailSuppression(ctx context.Context, email string) (*models.EmailSuppression, error)
+}
+
 type Emailer struct {
+	apiURL            string
 	baseURL           string
-	client            *http.Client
+	deliveries        iDeliveryStore
+	event             EventInfo
 	log               *zap.Logger
 	marketingFrom     nameAndEmail
-	token             string
 	transactionalFrom nameAndEmail
+	templates         *Templates
+	transport         *FailoverTransport
+	unsubscribeKey    []byte
 }
 
 type NewEmailerOptions struct {
-	BaseURL                   string
+	// APIURL is the URL of this API, which mail clients post one-click unsubscriptions to.
+	APIURL string
+	// BaseURL is the URL of the website, linked to from the emails.
+	BaseURL string
+	// Deliveries records sent emails and holds the suppression list checked before sending.
+	Deliveries                iDeliveryStore
+	Event                     EventInfo
 	Log                       *zap.Logger
 	MarketingEmailAddress     string
 	MarketingEmailName        string
-	Token                     string
 	TransactionalEmailAddress string
 	TransactionalEmailName    string
+	// Providers are tried in order, the next one taking over when one fails or is unavailable.
+	Providers []Provider
+	// Templates are parsed with ParseTemplates, usually from EmailTemplatesFS.
+	Templates *Templates
+	// UnsubscribeKey signs the unsubscribe tokens of campaign emails, see CreateUnsubscribeToken.
+	UnsubscribeKey []byte
 }
 
 func NewEmailer(opts NewEmailerOptions) *Emailer {
+	if opts.Log == nil {
+		opts.Log = zap.NewNop()
+	}
+
 	return &Emailer{
-		baseURL: opts.BaseURL,
-		client:  &http.Client{Timeout: 3 * time.Second},
-		log:     opts.Log,
+		apiURL:     opts.APIURL,
+		baseURL:    opts.BaseURL,
+		deliveries: opts.Deliveries,
+		event:      opts.Event,
+		log:        opts.Log,
 		marketingFrom: createNameAndEmail(
 			opts.MarketingEmailName,
 			opts.MarketingEmailAddress,
 		),
-		token:             opts.Token,
+		templates:         opts.Templates,
 		transactionalFrom: createNameAndEmail(opts.TransactionalEmailName, opts.TransactionalEmailAddress),
+		transport:         NewFailoverTransport(opts.Log, opts.Providers...),
+		unsubscribeKey:    opts.UnsubscribeKey,
 	}
 }
 
-func (e *Emailer) SendVerificationEmail(ctx context.Context, to models.Email, token string) error {
-	keywords := map[string]string{
-		"base_url":   e.baseURL,
-		"action_url": e.baseURL + "/register/confirm/" + token,
+func (e *Emailer) SendVerificationEmail(ctx context.Context, to models.Email, locale models.Locale, token string) error {
+	return e.render(ctx, to, locale, "verification_email", VerificationEmailData{
+		EmailData: e.emailData(to, ""),
+		ActionURL: e.baseURL + "/register/confirm/" + token,
+		BaseURL:   e.baseURL,
+	})
+}
+
+func (e *Emailer) SendOtpEmail(ctx context.Context, to models.Email, locale models.Locale, name, otp string) error {
+	return e.render(ctx, to, locale, "otp_email", OtpEmailData{
+		EmailData: e.emailData(to, name),
+		Otp:       otp,
+	})
+}
+
+func (e *Emailer) SendWelcomeEmail(ctx context.Context, to models.Email, locale models.Locale, name string) error {
+	// the event lands in the attendee's calendar in one click
+	return e.render(ctx, to, locale, "confirmation_email", WelcomeEmailData{
+		EmailData: e.emailData(to, name),
+	}, calendarAttachment(e.event))
+}
+
+func (e *Emailer) SendEventReminderEmail(ctx context.Context, to models.Email, locale models.Locale, name string, daysLeft int, startsAt time.Time) error {
+	data := EventReminderEmailData{
+		EmailData: e.emailData(to, name),
+		DaysLeft:  daysLeft,
 	}
+	data.Event.StartsAt = startsAt
 
-	return e.send(ctx, requestBody{
-		MessageStream: transactionalMessageStream,
-		From:          e.transactionalFrom,
+	return e.render(ctx, to, locale, "event_reminder_email", data)
+}
+
+func (e *Emailer) SendRegistrationReminderEmail(ctx context.Context, to models.Email, locale models.Locale, name string) error {
+	return e.render(ctx, to, locale, "registration_reminder_email", RegistrationReminderEmailData{
+		EmailData: e.emailData(to, name),
+	})
+}
+
+// SendCampaignEmail renders the campaign for the recipient and sends it on the broadcast stream,
+// with a link to the email preferences and a one-click unsubscribe header (RFC 8058).
+func (e *Emailer) SendCampaignEmail(ctx context.Context, to models.Email, locale models.Locale, name string, campaign *models.Campaign) error {
+	token := url.QueryEscape(CreateUnsubscribeToken(e.unsubscribeKey, to.String()))
+
+	email, err := e.templates.Render(locale, campaign.Template, CampaignEmailData{
+		EmailData:      e.emailData(to, name),
+		Subject:        campaign.Subject,
+		Body:           campaign.Body,
+		PreferencesURL: e.baseURL + "/preferences?token=" + token,
+	})
+	if err != nil {
+		return err
+	}
+
+	return e.send(ctx, Mail{
+		Tag:           "campaign",
+		MessageStream: marketingMessageStream,
+		From:          e.marketingFrom,
 		To:            to.String(),
-		Subject:       "Verify your registration to FRCC",
-		HtmlBody:      getEmail("verification_email.html", keywords),
-		TextBody:      getEmail("verification_email.txt", keywords),
+		Subject:       email.Subject,
+		HtmlBody:      email.HtmlBody,
+		TextBody:      email.TextBody,
+		Headers: map[string]string{
+			"List-Unsubscribe":      fmt.Sprintf("<%v/unsubscribe?token=%v&campaign=%v>", e.apiURL, token, campaign.ID),
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
 	})
 }
 
-func (e *Emailer) SendOtpEmail(ctx context.Context, to models.Email, name, otp string) error {
-	keywords := map[string]string{
-		"otp":     otp,
-		"email":   to.String(),
-		"name":    name,
-		"website": os.Getenv("WEBSITE"),
+func (e *Emailer) emailData(to models.Email, name string) EmailData {
+	return EmailData{
+		Name:  name,
+		Email: to.String(),
+		Event: e.event,
 	}
+}
 
-	return e.send(ctx, requestBody{
+// render renders the named email template in locale with data and sends it as a transactional email.
+func (e *Emailer) render(ctx context.Context, to models.Email, locale models.Locale, name string, data interface{}, attachments ...Attachment) error {
+	email, err := e.templates.Render(locale, name, data)
+	if err != nil {
+		return err
+	}
+
+	return e.send(ctx, Mail{
+		Tag:           name,
 		MessageStream: transactionalMessageStream,
 		From:          e.transactionalFrom,
 		To:            to.String(),
-		Subject:       "Votre code OTP pour l'enregistrement au Forum Régional sur la Sécurité",
-		HtmlBody:      getEmail("otp_email.html", keywords),
-		TextBody:      getEmail("otp_email.txt", keywords),
+		Subject:       email.Subject,
+		HtmlBody:      email.HtmlBody,
+		TextBody:      email.TextBody,
+		Attachments:   attachments,
 	})
 }
 
-type requestBody struct {
-	MessageStream string
-	From          nameAndEmail
-	To            nameAndEmail
-	Subject       string
-	HtmlBody      string
-	TextBody      string
+// TemplateNames returns the names of the email templates, sorted.
+func (e *Emailer) TemplateNames() []string {
+	return e.templates.Names()
 }
 
-func (e *Emailer) SendWelcomeEmail(ctx context.Context, to models.Email, name string) error {
-	keywords := map[string]string{
-		"email":   to.String(),
-		"name":    name,
-		"website": os.Getenv("WEBSITE"),
+// Preview renders the named email in locale for the recipient to and name, with the sample
+// values of the fields only known when the email is sent, such as the otp.
+func (e *Emailer) Preview(locale models.Locale, template string, to models.Email, name string) (*RenderedEmail, error) {
+	sample, ok := emailSamples[template]
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", ErrTemplateNotFound, template)
 	}
 
-	return e.send(ctx, requestBody{
+	return e.templates.Render(locale, template, sample(e.emailData(to, name)))
+}
+
+// SendTestEmail sends a rendered email to to, its subject marking it as a test.
+func (e *Emailer) SendTestEmail(ctx context.Context, to models.Email, email *RenderedEmail) error {
+	return e.send(ctx, Mail{
+		Tag:           "test",
 		MessageStream: transactionalMessageStream,
 		From:          e.transactionalFrom,
 		To:            to.String(),
-		Subject:       "Merci pour votre enregistrement au Forum Régional sur la Sécurité",
-		HtmlBody:      getEmail("confirmation_email.html", keywords),
-		TextBody:      getEmail("confirmation_email.txt", keywords),
+		Subject:       "[TEST] " + email.Subject,
+		HtmlBody:      email.HtmlBody,
+		TextBody:      email.TextBody,
 	})
 }
 
-func (e *Emailer) send(ctx context.Context, body requestBody) error {
-	bodyAsBytes, err := json.Marshal(body)
+// send sends the mail unless its recipient is suppressed, and records it for delivery webhooks.
+func (e *Emailer) send(ctx context.Context, m Mail) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "email send "+m.Tag, trace.WithAttributes(
+		attribute.String("email.template", m.Tag),
+		attribute.String("email.message_stream", m.MessageStream),
+	))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	from, err := mail.ParseAddress(m.From)
 	if err != nil {
-		return fmt.Errorf("error marshalling request body to json: %w", err)
+		return fmt.Errorf("error parsing from address: %w", err)
 	}
 
-	request, err := http.NewRequestWithContext(
-		ctx,
-		http.MethodPost,
-		"https://api.postmarkapp.com/email",
-		bytes.NewReader(bodyAsBytes),
-	)
+	to, err := mail.ParseAddress(m.To)
 	if err != nil {
-		return fmt.Errorf("error creating request: %w", err)
+		return &PermanentError{Err: fmt.Errorf("error parsing to address: %w", err)}
 	}
 
-	request.Header.Set("Accept", "application/json")
-	request.Header.Set("Content-Type", "application/json")
-	request.Header.Set("X-Postmark-Server-Token", e.token)
+	if e.deliveries != nil {
+		suppression, err := e.deliveries.GetEmailSuppression(ctx, to.Address)
+		if err != nil {
+			return fmt.Errorf("error checking suppression list: %w", err)
+		}
 
-	response, err := e.client.Do(request)
-	if err != nil {
-		return fmt.Errorf("error making request: %w", err)
+		if suppression != nil {
+			return &PermanentError{Err: fmt.Errorf("%w: %v (%v)", ErrRecipientSuppressed, to.Address, suppression.Reason)}
+		}
 	}
-	defer func() {
-		_ = response.Body.Close()
-	}()
-	bodyAsBytes, err = io.ReadAll(response.Body)
+
+	m.ID = newMessageID(from.Address)
+	span.SetAttributes(attribute.String("email.message_id", m.ID))
+
+	provider, err := e.transport.SendVia(ctx, m)
+	span.SetAttributes(attribute.String("email.provider", provider))
 	if err != nil {
-		return fmt.Errorf("error reading response body: %w", err)
+		return err
 	}
-	if response.StatusCode > 299 {
-		e.log.Info(
-			"Error sending email",
-			zap.Int("status", response.StatusCode),
-			zap.String("response", string(bodyAsBytes)),
-		)
-		return fmt.Errorf("error sending email, got status %v", response.StatusCode)
+	metrics.EmailsSent.WithLabelValues(m.Tag, provider).Inc()
+
+	if e.deliveries != nil {
+		err := e.deliveries.CreateEmailDelivery(ctx, storage.CreateEmailDeliveryParams{
+			MessageID: m.ID,
+			Provider:  provider,
+			Recipient: to.Address,
+			Tag:       m.Tag,
+			Status:    models.EmailDeliveryStatusSent,
+		})
+		if err != nil {
+			// the email is gone, failing would send it again
+			e.log.Info("Error recording email delivery", zap.String("message_id", m.ID), zap.Error(err))
+		}
 	}
 
 	return nil
 }
 
-func createNameAndEmail(name, email string) nameAndEmail {
-	return fmt.Sprintf("%v <%v>", name, email)
+// Check verifies that at least one email provider is configured to send.
+func (e *Emailer) Check(ctx context.Context) error {
+	return e.transport.Check(ctx)
 }
 
-func getEmail(path string, keywords map[string]string) string {
-	email, err := emails.ReadFile("emails/" + path)
-	if err != nil {
-		panic(err)
-	}
-
-	emailString := string(email)
-	for keyword, replacement := range keywords {
-		emailString = strings.ReplaceAll(
-			emailString,
-			"{{"+keyword+"}}",
-			replacement,
-		)
-	}
+// ProviderStats returns the delivery counters of each email provider.
+func (e *Emailer) ProviderStats() []ProviderStats {
+	return e.transport.Stats()
+}
 
-	return emailString
+func createNameAndEmail(name, email string) nameAndEmail {
+	return fmt.Sprintf("%v <%v>", name, email)
 }
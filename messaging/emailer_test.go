@@ -0,0 +1,63 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"cyberix.fr/frcc/models"
+	"cyberix.fr/frcc/storage"
+)
+
+func newTestEmailer(s *storage.MemoryStorage, transport *fakeTransport) *Emailer {
+	return NewEmailer(NewEmailerOptions{
+		Deliveries:                s,
+		Providers:                 []Provider{{Name: "postmark", Transport: transport}},
+		TransactionalEmailAddress: "noreply@example.com",
+		TransactionalEmailName:    "FRCC",
+	})
+}
+
+func TestEmailerRecordsDelivery(t *testing.T) {
+	s := storage.NewMemoryStorage()
+	transport := &fakeTransport{}
+	e := newTestEmailer(s, transport)
+
+	err := e.send(context.Background(), Mail{From: e.transactionalFrom, To: "Jane <Jane@Example.com>", Tag: "otp_email"})
+	if err != nil || transport.sent != 1 {
+		t.Fatalf("expected the email to be sent, got %v", err)
+	}
+
+	deliveries, err := s.ListEmailDeliveries(context.Background(), storage.ListEmailDeliveriesParams{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 || deliveries[0].Recipient != "jane@example.com" || deliveries[0].Provider != "postmark" ||
+		deliveries[0].Status != models.EmailDeliveryStatusSent || deliveries[0].MessageID == "" {
+		t.Fatalf("expected the delivery to be recorded, got %+v", deliveries)
+	}
+}
+
+func TestEmailerRefusesSuppressedRecipient(t *testing.T) {
+	s := storage.NewMemoryStorage()
+	err := s.CreateEmailSuppression(context.Background(), storage.CreateEmailSuppressionParams{
+		Email:  "jane@example.com",
+		Reason: models.EmailSuppressionReasonHardBounce,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transport := &fakeTransport{}
+	e := newTestEmailer(s, transport)
+
+	err = e.send(context.Background(), Mail{From: e.transactionalFrom, To: "Jane <Jane@Example.com>", Tag: "otp_email"})
+
+	var permanentErr *PermanentError
+	if !errors.Is(err, ErrRecipientSuppressed) || !errors.As(err, &permanentErr) {
+		t.Fatalf("expected a permanent suppression error, got %v", err)
+	}
+	if transport.sent != 0 {
+		t.Fatal("expected no email to a suppressed recipient")
+	}
+}
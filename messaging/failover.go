@@ -0,0 +1,295 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+var _ Transport = (*FailoverTransport)(nil)
+
+// Provider is an email provider with its own sending limits.
+type Provider struct {
+	Name      string
+	Transport Transport
+	// RateLimit is the number of emails per second, unlimited when zero.
+	RateLimit float64
+	Burst     int
+	// DailyQuota is the number of emails per UTC day, unlimited when zero.
+	DailyQuota int
+	// BreakerThreshold is the number of consecutive failures opening the circuit breaker.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
+type ProviderStats struct {
+	Name         string `json:"name"`
+	State        string `json:"state"`
+	Sent         int64  `json:"sent"`
+	Failed       int64  `json:"failed"`
+	Skipped      int64  `json:"skipped"`
+	QuotaUsed    int    `json:"quota_used"`
+	DailyQuota   int    `json:"daily_quota"`
+	LastError    string `json:"last_error,omitempty"`
+	LastSentTime string `json:"last_sent_time,omitempty"`
+}
+
+type provider struct {
+	Provider
+	breaker *circuitBreaker
+	limiter *rate.Limiter
+
+	mutex      sync.Mutex
+	quotaDay   string
+	quotaUsed  int
+	sent       int64
+	failed     int64
+	skipped    int64
+	lastError  string
+	lastSentAt time.Time
+}
+
+// FailoverTransport sends through the first available provider of an ordered list.
+// A provider is skipped while its circuit breaker is open or its daily quota is used up, and
+// the next one is tried when it fails. Sending waits for the rate limit of a provider, up to
+// maxRateWait, so that a burst is throttled rather than failed over or refused.
+type FailoverTransport struct {
+	log       *zap.Logger
+	providers []*provider
+}
+
+func NewFailoverTransport(log *zap.Logger, providers ...Provider) *FailoverTransport {
+	if log == nil {
+		log = zap.NewNop()
+	}
+
+	t := &FailoverTransport{log: log}
+	for _, p := range providers {
+		limit := rate.Inf
+		if p.RateLimit > 0 {
+			limit = rate.Limit(p.RateLimit)
+		}
+		if p.Burst <= 0 {
+			p.Burst = 1
+		}
+
+		t.providers = append(t.providers, &provider{
+			Provider: p,
+			breaker:  newCircuitBreaker(p.BreakerThreshold, p.BreakerCooldown),
+			limiter:  rate.NewLimiter(limit, p.Burst),
+		})
+	}
+
+	return t
+}
+
+var errNoProviderAvailable = errors.New("no email provider available")
+
+// maxRateWait bounds the wait for the rate limit of a provider, beyond which the email goes to
+// the next provider rather than holding the job.
+const maxRateWait = 10 * time.Second
+
+func (t *FailoverTransport) Send(ctx context.Context, mail Mail) error {
+	_, err := t.SendVia(ctx, mail)
+	return err
+}
+
+// SendVia sends the mail like Send, and returns the name of the provider which took it.
+func (t *FailoverTransport) SendVia(ctx context.Context, mail Mail) (string, error) {
+	var errs []error
+
+	for _, p := range t.providers {
+		ok, err := p.acquire(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%v: %w", p.Name, err))
+			break
+		}
+		if !ok {
+			continue
+		}
+
+		err = p.Transport.Send(ctx, mail)
+		if err == nil {
+			p.succeeded()
+			t.log.Info("Email delivered", zap.String("provider", p.Name), zap.String("subject", mail.Subject))
+			return p.Name, nil
+		}
+
+		var permanentErr *PermanentError
+		if errors.As(err, &permanentErr) {
+			// the provider works, the email is the problem
+			p.rejected()
+			return p.Name, fmt.Errorf("error sending email with %v: %w", p.Name, err)
+		}
+
+		p.failedWith(err)
+		t.log.Info("Error sending email, failing over", zap.String("provider", p.Name), zap.Error(err))
+		errs = append(errs, fmt.Errorf("%v: %w", p.Name, err))
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	if len(errs) == 0 {
+		return "", errNoProviderAvailable
+	}
+
+	return "", fmt.Errorf("error sending email with every provider: %w", errors.Join(errs...))
+}
+
+// Check verifies the configuration of the providers, failing when none of them could send,
+// the others being left to fail over to.
+func (t *FailoverTransport) Check(ctx context.Context) error {
+	if len(t.providers) == 0 {
+		return errors.New("no email provider configured")
+	}
+
+	var errs []error
+	for _, p := range t.providers {
+		checker, ok := p.Transport.(Checker)
+		if !ok {
+			return nil
+		}
+
+		err := checker.Check(ctx)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%v: %w", p.Name, err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Stats returns the delivery counters of each provider, in failover order.
+func (t *FailoverTransport) Stats() []ProviderStats {
+	stats := make([]ProviderStats, 0, len(t.providers))
+	for _, p := range t.providers {
+		stats = append(stats, p.stats())
+	}
+	return stats
+}
+
+// Transports returns the transports of the providers, in failover order.
+func (t *FailoverTransport) Transports() []Transport {
+	transports := make([]Transport, 0, len(t.providers))
+	for _, p := range t.providers {
+		transports = append(transports, p.Transport)
+	}
+	return transports
+}
+
+// acquire reports whether the provider can take one more email, waiting for its rate limit up
+// to maxRateWait. The quota is only charged once the provider took the email.
+func (p *provider) acquire(ctx context.Context) (bool, error) {
+	p.mutex.Lock()
+	p.resetQuotaDay()
+	if p.DailyQuota > 0 && p.quotaUsed >= p.DailyQuota {
+		p.skipped++
+		p.mutex.Unlock()
+		return false, nil
+	}
+	p.mutex.Unlock()
+
+	reservation := p.limiter.Reserve()
+	delay := reservation.Delay()
+	if !reservation.OK() || delay > maxRateWait {
+		reservation.Cancel()
+		p.skip()
+		return false, nil
+	}
+
+	if !p.breaker.allow() {
+		reservation.Cancel()
+		p.skip()
+		return false, nil
+	}
+
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+
+		select {
+		case <-ctx.Done():
+			reservation.Cancel()
+			p.breaker.abandon()
+			return false, ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	return true, nil
+}
+
+func (p *provider) skip() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.skipped++
+}
+
+// resetQuotaDay starts the quota over on a new UTC day, p.mutex being held.
+func (p *provider) resetQuotaDay() {
+	day := time.Now().UTC().Format(time.DateOnly)
+	if p.quotaDay != day {
+		p.quotaDay = day
+		p.quotaUsed = 0
+	}
+}
+
+func (p *provider) succeeded() {
+	p.breaker.success()
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.resetQuotaDay()
+	p.quotaUsed++
+	p.sent++
+	p.lastSentAt = time.Now()
+}
+
+// rejected records an email refused by the provider for the email itself, which the provider
+// counts against the quota.
+func (p *provider) rejected() {
+	p.breaker.success()
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.resetQuotaDay()
+	p.quotaUsed++
+}
+
+func (p *provider) failedWith(err error) {
+	p.breaker.failure()
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.failed++
+	p.lastError = err.Error()
+}
+
+func (p *provider) stats() ProviderStats {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	s := ProviderStats{
+		Name:       p.Name,
+		State:      p.breaker.currentState().String(),
+		Sent:       p.sent,
+		Failed:     p.failed,
+		Skipped:    p.skipped,
+		QuotaUsed:  p.quotaUsed,
+		DailyQuota: p.DailyQuota,
+		LastError:  p.lastError,
+	}
+	if !p.lastSentAt.IsZero() {
+		s.LastSentTime = p.lastSentAt.Format(time.RFC3339)
+	}
+
+	return s
+}
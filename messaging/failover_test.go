@@ -0,0 +1,160 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeTransport records the emails it is given, failing with the queued errors first.
+type fakeTransport struct {
+	errs  []error
+	mutex sync.Mutex
+	sent  int
+}
+
+func (t *fakeTransport) Send(ctx context.Context, mail Mail) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if len(t.errs) > 0 {
+		err := t.errs[0]
+		t.errs = t.errs[1:]
+		return err
+	}
+
+	t.sent++
+	return nil
+}
+
+func sendVia(t *testing.T, ft *FailoverTransport) (string, error) {
+	t.Helper()
+	return ft.SendVia(context.Background(), Mail{To: "jane@example.com", Subject: "Hello"})
+}
+
+func TestFailoverTransportFailsOver(t *testing.T) {
+	primary := &fakeTransport{errs: []error{errors.New("unavailable")}}
+	secondary := &fakeTransport{}
+	ft := NewFailoverTransport(nil,
+		Provider{Name: "primary", Transport: primary},
+		Provider{Name: "secondary", Transport: secondary},
+	)
+
+	name, err := sendVia(t, ft)
+	if err != nil || name != "secondary" {
+		t.Fatalf("expected the secondary provider to take the email, got %q, %v", name, err)
+	}
+
+	name, err = sendVia(t, ft)
+	if err != nil || name != "primary" {
+		t.Fatalf("expected the primary provider to take the email again, got %q, %v", name, err)
+	}
+
+	stats := ft.Stats()
+	if stats[0].Failed != 1 || stats[0].Sent != 1 || stats[1].Sent != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestFailoverTransportPermanentError(t *testing.T) {
+	primary := &fakeTransport{errs: []error{&PermanentError{Err: errors.New("inactive recipient")}}}
+	secondary := &fakeTransport{}
+	ft := NewFailoverTransport(nil,
+		Provider{Name: "primary", Transport: primary, DailyQuota: 10},
+		Provider{Name: "secondary", Transport: secondary},
+	)
+
+	name, err := sendVia(t, ft)
+	var permanentErr *PermanentError
+	if !errors.As(err, &permanentErr) || name != "primary" {
+		t.Fatalf("expected a permanent error from the primary provider, got %q, %v", name, err)
+	}
+
+	if secondary.sent != 0 {
+		t.Fatal("expected no fail over on a permanent error")
+	}
+
+	stats := ft.Stats()
+	if stats[0].QuotaUsed != 1 || stats[0].Failed != 0 || stats[0].State != "closed" {
+		t.Fatalf("expected the rejected email to be charged without failing the provider, got %+v", stats[0])
+	}
+}
+
+func TestFailoverTransportBreaker(t *testing.T) {
+	primary := &fakeTransport{errs: []error{errors.New("unavailable"), errors.New("unavailable")}}
+	secondary := &fakeTransport{}
+	ft := NewFailoverTransport(nil,
+		Provider{Name: "primary", Transport: primary, BreakerThreshold: 2, BreakerCooldown: time.Hour},
+		Provider{Name: "secondary", Transport: secondary},
+	)
+
+	for range 3 {
+		if _, err := sendVia(t, ft); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats := ft.Stats()
+	if stats[0].State != "open" || stats[0].Failed != 2 || stats[0].Skipped != 1 {
+		t.Fatalf("expected the primary provider to be skipped once its breaker opened, got %+v", stats[0])
+	}
+	if secondary.sent != 3 {
+		t.Fatalf("expected 3 emails through the secondary provider, got %v", secondary.sent)
+	}
+}
+
+func TestFailoverTransportDailyQuota(t *testing.T) {
+	primary := &fakeTransport{errs: []error{errors.New("unavailable")}}
+	secondary := &fakeTransport{}
+	ft := NewFailoverTransport(nil,
+		Provider{Name: "primary", Transport: primary, DailyQuota: 1},
+		Provider{Name: "secondary", Transport: secondary},
+	)
+
+	// the failed email is not charged, so the quota still allows one
+	names := []string{"secondary", "primary", "secondary"}
+	for _, expected := range names {
+		name, err := sendVia(t, ft)
+		if err != nil || name != expected {
+			t.Fatalf("expected %v, got %q, %v", expected, name, err)
+		}
+	}
+
+	if stats := ft.Stats(); stats[0].QuotaUsed != 1 || stats[0].Skipped != 1 {
+		t.Fatalf("unexpected stats %+v", stats[0])
+	}
+}
+
+func TestFailoverTransportWaitsForRateLimit(t *testing.T) {
+	primary := &fakeTransport{}
+	secondary := &fakeTransport{}
+	ft := NewFailoverTransport(nil,
+		Provider{Name: "primary", Transport: primary, RateLimit: 20, Burst: 1},
+		Provider{Name: "secondary", Transport: secondary},
+	)
+
+	before := time.Now()
+	for range 3 {
+		if name, err := sendVia(t, ft); err != nil || name != "primary" {
+			t.Fatalf("expected the rate limited provider to be waited for, got %q, %v", name, err)
+		}
+	}
+
+	if elapsed := time.Since(before); elapsed < 80*time.Millisecond {
+		t.Fatalf("expected the emails to be throttled, took %v", elapsed)
+	}
+}
+
+func TestFailoverTransportNoProvider(t *testing.T) {
+	ft := NewFailoverTransport(nil, Provider{Name: "primary", Transport: &fakeTransport{}, DailyQuota: 1})
+
+	if _, err := sendVia(t, ft); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sendVia(t, ft); !errors.Is(err, errNoProviderAvailable) {
+		t.Fatalf("expected no provider to be available, got %v", err)
+	}
+}
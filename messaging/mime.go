@@ -0,0 +1,172 @@
+package messaging
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+)
+
+// buildMIME renders the mail as an RFC 5322 message with text and HTML alternatives.
+func buildMIME(m Mail, now time.Time) ([]byte, error) {
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing from address: %w", err)
+	}
+
+	to, err := mail.ParseAddress(m.To)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing to address: %w", err)
+	}
+
+	var buf bytes.Buffer
+	header := func(key, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
+	}
+	header("From", from.String())
+	header("To", to.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	header("Date", now.Format(time.RFC1123Z))
+	messageID := m.ID
+	if messageID == "" {
+		messageID = newMessageID(from.Address)
+	}
+	header("Message-ID", messageID)
+	for _, name := range sortedHeaderNames(m.Headers) {
+		header(name, m.Headers[name])
+	}
+	header("MIME-Version", "1.0")
+
+	if len(m.Attachments) == 0 {
+		alternative := multipart.NewWriter(&buf)
+		header("Content-Type", fmt.Sprintf("multipart/alternative; boundary=%q", alternative.Boundary()))
+		buf.WriteString("\r\n")
+
+		if err := writeAlternative(alternative, m); err != nil {
+			return nil, err
+		}
+
+		return buf.Bytes(), nil
+	}
+
+	// the bodies are nested in a multipart/alternative part, followed by the attachments
+	mixed := multipart.NewWriter(&buf)
+	header("Content-Type", fmt.Sprintf("multipart/mixed; boundary=%q", mixed.Boundary()))
+	buf.WriteString("\r\n")
+
+	var body bytes.Buffer
+	alternative := multipart.NewWriter(&body)
+	if err := writeAlternative(alternative, m); err != nil {
+		return nil, err
+	}
+
+	part, err := mixed.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {fmt.Sprintf("multipart/alternative; boundary=%q", alternative.Boundary())},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(body.Bytes()); err != nil {
+		return nil, err
+	}
+
+	for _, a := range m.Attachments {
+		part, err := mixed.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {mime.FormatMediaType(a.ContentType, map[string]string{"name": a.Name})},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Name})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if err := writeBase64(part, a.Content); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := mixed.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// writeAlternative writes the text and HTML bodies as quoted-printable parts.
+func writeAlternative(writer *multipart.Writer, m Mail) error {
+	parts := []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain; charset=utf-8", m.TextBody},
+		{"text/html; charset=utf-8", m.HtmlBody},
+	}
+	for _, p := range parts {
+		if p.body == "" {
+			continue
+		}
+
+		part, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return err
+		}
+
+		qp := quotedprintable.NewWriter(part)
+		if _, err := qp.Write([]byte(p.body)); err != nil {
+			return err
+		}
+		if err := qp.Close(); err != nil {
+			return err
+		}
+	}
+
+	return writer.Close()
+}
+
+// writeBase64 writes content base64 encoded, in lines of 76 characters.
+func writeBase64(w io.Writer, content []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(content)
+	for len(encoded) > 76 {
+		if _, err := io.WriteString(w, encoded[:76]+"\r\n"); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+
+	_, err := io.WriteString(w, encoded+"\r\n")
+	return err
+}
+
+func newMessageID(fromAddress string) string {
+	domain := "localhost"
+	if _, d, ok := strings.Cut(fromAddress, "@"); ok {
+		domain = d
+	}
+
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(id), domain)
+}
+
+// sortedHeaderNames returns the names of the extra headers in a stable order.
+func sortedHeaderNames(headers map[string]string) []string {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
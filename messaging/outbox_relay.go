@@ -0,0 +1,101 @@
+package messaging
+
+import (
+	"context"
+	"time"
+
+	"cyberix.fr/frcc/models"
+	"go.uber.org/zap"
+)
+
+type iOutboxPublisher interface {
+	PublishOutboxTx(ctx context.Context, limit int32, publish func(*models.OutboxMessage) error) (int, error)
+}
+
+// OutboxRelay publishes the messages written to the outbox table to the queue.
+// Delivery is at least once: a message is sent again if the relay stops between
+// sending and marking it as published, and the outbox dedup ID lets the queue drop the copy, or
+// the job runner skip it on the queues which do not deduplicate.
+type OutboxRelay struct {
+	batchSize int32
+	db        iOutboxPublisher
+	interval  time.Duration
+	log       *zap.Logger
+	queue     Queue
+}
+
+type NewOutboxRelayOptions struct {
+	BatchSize int32
+	DB        iOutboxPublisher
+	Interval  time.Duration
+	Log       *zap.Logger
+	Queue     Queue
+}
+
+func NewOutboxRelay(opts NewOutboxRelayOptions) *OutboxRelay {
+	if opts.Log == nil {
+		opts.Log = zap.NewNop()
+	}
+
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 50
+	}
+
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+
+	return &OutboxRelay{
+		batchSize: opts.BatchSize,
+		db:        opts.DB,
+		interval:  opts.Interval,
+		log:       opts.Log,
+		queue:     opts.Queue,
+	}
+}
+
+func (r *OutboxRelay) Start(ctx context.Context) {
+	r.log.Info("Starting outbox relay")
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			r.log.Info("Stopping outbox relay")
+			return
+		case <-ticker.C:
+			r.relay(ctx)
+		}
+	}
+}
+
+// relay publishes full batches back to back until the outbox is drained.
+func (r *OutboxRelay) relay(ctx context.Context) {
+	for ctx.Err() == nil {
+		published, err := r.db.PublishOutboxTx(ctx, r.batchSize, func(m *models.OutboxMessage) error {
+			// a message published twice, the transaction failing after Send, keeps its
+			// deduplication ID, under which the job runner runs it once. A deduplication ID
+			// given in the payload is kept, for messages written again by a repeated job.
+			msg := copyMessage(m.Payload)
+			if _, ok := msg[DeduplicationIDKey]; !ok {
+				msg[DeduplicationIDKey] = m.DedupID
+			}
+
+			return r.queue.Send(ctx, msg)
+		})
+		if err != nil {
+			r.log.Info("Error publishing outbox messages", zap.Error(err))
+			return
+		}
+
+		if published > 0 {
+			r.log.Debug("Published outbox messages", zap.Int("count", published))
+		}
+
+		if published < int(r.batchSize) {
+			return
+		}
+	}
+}
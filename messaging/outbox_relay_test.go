@@ -0,0 +1,112 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"cyberix.fr/frcc/models"
+	"cyberix.fr/frcc/storage"
+)
+
+// failingQueue fails to send the first failures messages.
+type failingQueue struct {
+	Queue
+	failures int
+}
+
+func (q *failingQueue) Send(ctx context.Context, msg models.Message) error {
+	if q.failures > 0 {
+		q.failures--
+		return errors.New("queue unavailable")
+	}
+	return q.Queue.Send(ctx, msg)
+}
+
+func newTestOutbox(t *testing.T, payloads ...models.Message) *storage.MemoryStorage {
+	t.Helper()
+
+	s := storage.NewMemoryStorage()
+	for _, payload := range payloads {
+		if _, err := s.CreateOutboxMessage(context.Background(), payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+func unpublished(t *testing.T, s *storage.MemoryStorage) []*models.OutboxMessage {
+	t.Helper()
+
+	messages, err := s.GetUnpublishedOutboxMessagesForUpdate(context.Background(), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return messages
+}
+
+func TestOutboxRelayDrainsOutboxInBatches(t *testing.T) {
+	s := newTestOutbox(t,
+		models.Message{"job": "a"},
+		models.Message{"job": "b"},
+		models.Message{"job": "c"},
+	)
+	q := newTestMemoryQueue()
+
+	relay := NewOutboxRelay(NewOutboxRelayOptions{BatchSize: 2, DB: s, Queue: q})
+	relay.relay(context.Background())
+
+	if messages := unpublished(t, s); len(messages) != 0 {
+		t.Fatalf("expected the outbox to be drained, %v messages left", len(messages))
+	}
+
+	for _, job := range []string{"a", "b", "c"} {
+		m, _ := receive(t, q)
+		if m == nil || (*m)["job"] != job {
+			t.Fatalf("expected job %v in order, got %v", job, m)
+		}
+	}
+}
+
+func TestOutboxRelayDeduplicationID(t *testing.T) {
+	s := newTestOutbox(t,
+		models.Message{"job": "a"},
+		models.Message{"job": "b", DeduplicationIDKey: "reminder:1"},
+	)
+	outbox := unpublished(t, s)
+	q := newTestMemoryQueue()
+
+	NewOutboxRelay(NewOutboxRelayOptions{DB: s, Queue: q}).relay(context.Background())
+
+	first, _ := receive(t, q)
+	if first == nil || (*first)[DeduplicationIDKey] != outbox[0].DedupID {
+		t.Fatalf("expected the outbox dedup ID, got %v", first)
+	}
+
+	second, _ := receive(t, q)
+	if second == nil || (*second)[DeduplicationIDKey] != "reminder:1" {
+		t.Fatalf("expected the dedup ID of the payload to be kept, got %v", second)
+	}
+}
+
+func TestOutboxRelayKeepsMessagesTheQueueRejects(t *testing.T) {
+	s := newTestOutbox(t, models.Message{"job": "a"})
+	q := &failingQueue{Queue: newTestMemoryQueue(), failures: 1}
+	relay := NewOutboxRelay(NewOutboxRelayOptions{DB: s, Queue: q})
+
+	relay.relay(context.Background())
+
+	messages := unpublished(t, s)
+	if len(messages) != 1 || messages[0].Attempts != 1 || messages[0].LastError == nil {
+		t.Fatalf("expected the message to stay in the outbox with its error, got %+v", messages)
+	}
+
+	relay.relay(context.Background())
+
+	if messages := unpublished(t, s); len(messages) != 0 {
+		t.Fatalf("expected the message to be published on the next relay, got %+v", messages)
+	}
+	if m, _ := receive(t, q); m == nil || (*m)["job"] != "a" {
+		t.Fatalf("expected the message in the queue, got %v", m)
+	}
+}
@@ -0,0 +1,136 @@
+package messaging
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"cyberix.fr/frcc/models"
+)
+
+// SensitiveKeys are the message keys encrypted by a PayloadCipher.
+var SensitiveKeys = []string{"otp"}
+
+const encryptedValuePrefix = "enc:v1:"
+
+// PayloadCipher encrypts the sensitive values of queue messages with AES-256-GCM, so that they
+// are only readable by the job using them, and not by whoever can read the queue or the job runs.
+// A nil PayloadCipher leaves messages in clear text.
+type PayloadCipher struct {
+	aead cipher.AEAD
+}
+
+// NewPayloadCipher creates a cipher from a 32 bytes key, or returns nil when key is empty.
+func NewPayloadCipher(key []byte) (*PayloadCipher, error) {
+	if len(key) == 0 {
+		return nil, nil
+	}
+
+	if len(key) != 32 {
+		return nil, errors.New("error creating payload cipher: the key must be 32 bytes long")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating payload cipher: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("error creating payload cipher: %w", err)
+	}
+
+	return &PayloadCipher{aead: aead}, nil
+}
+
+// Seal returns a copy of m with its sensitive values encrypted.
+func (c *PayloadCipher) Seal(m models.Message) (models.Message, error) {
+	if c == nil {
+		return m, nil
+	}
+
+	sealed := copyMessage(m)
+	for _, key := range SensitiveKeys {
+		value, ok := sealed[key]
+		if !ok || strings.HasPrefix(value, encryptedValuePrefix) {
+			continue
+		}
+
+		nonce := make([]byte, c.aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, fmt.Errorf("error generating nonce: %w", err)
+		}
+
+		// the key is authenticated along, so that a value cannot be moved to another key
+		ciphertext := c.aead.Seal(nonce, nonce, []byte(value), []byte(key))
+		sealed[key] = encryptedValuePrefix + base64.RawStdEncoding.EncodeToString(ciphertext)
+	}
+
+	return sealed, nil
+}
+
+// Open returns the value of key in m, decrypting it if it was sealed. Values in clear text are
+// returned as is, for the messages sent before encryption was enabled.
+func (c *PayloadCipher) Open(m models.Message, key string) (string, bool, error) {
+	value, ok := m[key]
+	if !ok {
+		return "", false, nil
+	}
+
+	encoded, encrypted := strings.CutPrefix(value, encryptedValuePrefix)
+	if !encrypted {
+		return value, true, nil
+	}
+
+	if c == nil {
+		return "", true, fmt.Errorf("error decrypting %v: no payload encryption key", key)
+	}
+
+	ciphertext, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(ciphertext) < c.aead.NonceSize() {
+		return "", true, fmt.Errorf("error decoding encrypted %v", key)
+	}
+
+	nonce, ciphertext := ciphertext[:c.aead.NonceSize()], ciphertext[c.aead.NonceSize():]
+	plaintext, err := c.aead.Open(nil, nonce, ciphertext, []byte(key))
+	if err != nil {
+		return "", true, fmt.Errorf("error decrypting %v: %w", key, err)
+	}
+
+	return string(plaintext), true, nil
+}
+
+var _ Queue = (*EncryptedQueue)(nil)
+
+// EncryptedQueue seals the sensitive values of the messages sent to a Queue, passing the values
+// already sealed when written to the outbox as is. Received messages are left sealed, the jobs
+// open the values they need.
+type EncryptedQueue struct {
+	Queue
+	cipher *PayloadCipher
+}
+
+func NewEncryptedQueue(q Queue, c *PayloadCipher) *EncryptedQueue {
+	return &EncryptedQueue{Queue: q, cipher: c}
+}
+
+func (q *EncryptedQueue) Send(ctx context.Context, msg models.Message) error {
+	sealed, err := q.cipher.Seal(msg)
+	if err != nil {
+		return fmt.Errorf("error encrypting message: %w", err)
+	}
+	return q.Queue.Send(ctx, sealed)
+}
+
+// Check checks the underlying queue, if it can be checked.
+func (q *EncryptedQueue) Check(ctx context.Context) error {
+	if checker, ok := q.Queue.(Checker); ok {
+		return checker.Check(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package messaging
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"cyberix.fr/frcc/models"
+)
+
+func newTestPayloadCipher(t *testing.T, b byte) *PayloadCipher {
+	t.Helper()
+
+	c, err := NewPayloadCipher(bytes.Repeat([]byte{b}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestPayloadCipherRoundTrip(t *testing.T) {
+	c := newTestPayloadCipher(t, 1)
+	m := models.Message{"job": "otp_email", "otp": "123456"}
+
+	sealed, err := c.Seal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(sealed["otp"], encryptedValuePrefix) {
+		t.Fatalf("expected the otp to be sealed, got %q", sealed["otp"])
+	}
+	if sealed["job"] != "otp_email" {
+		t.Fatalf("expected the job to be left in clear text, got %q", sealed["job"])
+	}
+	if m["otp"] != "123456" {
+		t.Fatal("expected Seal to leave the message as is")
+	}
+
+	resealed, err := c.Seal(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resealed["otp"] != sealed["otp"] {
+		t.Fatal("expected a sealed value to be passed through")
+	}
+
+	otp, ok, err := c.Open(sealed, "otp")
+	if err != nil || !ok || otp != "123456" {
+		t.Fatalf("expected 123456, got %q, %v, %v", otp, ok, err)
+	}
+
+	otp, ok, err = c.Open(m, "otp")
+	if err != nil || !ok || otp != "123456" {
+		t.Fatalf("expected a value in clear text to be returned as is, got %q, %v, %v", otp, ok, err)
+	}
+
+	if _, ok, err := c.Open(m, "missing"); ok || err != nil {
+		t.Fatalf("expected a missing key, got %v, %v", ok, err)
+	}
+}
+
+func TestPayloadCipherTamper(t *testing.T) {
+	c := newTestPayloadCipher(t, 1)
+
+	sealed, err := c.Seal(models.Message{"otp": "123456"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := sealed["otp"]
+
+	// a character in the middle always carries ciphertext bits, unlike the last one
+	flipped := []byte(value)
+	middle := len(encryptedValuePrefix) + (len(flipped)-len(encryptedValuePrefix))/2
+	if flipped[middle] == 'A' {
+		flipped[middle] = 'B'
+	} else {
+		flipped[middle] = 'A'
+	}
+
+	tests := map[string]struct {
+		cipher *PayloadCipher
+		m      models.Message
+		key    string
+	}{
+		"flipped ciphertext": {c, models.Message{"otp": string(flipped)}, "otp"},
+		"truncated":          {c, models.Message{"otp": value[:len(encryptedValuePrefix)+4]}, "otp"},
+		"invalid base64":     {c, models.Message{"otp": encryptedValuePrefix + "!!!"}, "otp"},
+		"moved to other key": {c, models.Message{"code": value}, "code"},
+		"other key":          {newTestPayloadCipher(t, 2), sealed, "otp"},
+		"no cipher":          {nil, sealed, "otp"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if otp, _, err := test.cipher.Open(test.m, test.key); err == nil {
+				t.Fatalf("expected an error, got %q", otp)
+			}
+		})
+	}
+}
+
+func TestNewPayloadCipher(t *testing.T) {
+	c, err := NewPayloadCipher(nil)
+	if c != nil || err != nil {
+		t.Fatalf("expected no cipher without key, got %v, %v", c, err)
+	}
+
+	if _, err := NewPayloadCipher([]byte("short")); err == nil {
+		t.Fatal("expected an error for a key which is not 32 bytes long")
+	}
+}
@@ -2,125 +2,36 @@ package messaging
 
 import (
 	"context"
-	"encoding/json"
-	"strings"
-	"sync"
 	"time"
 
 	"cyberix.fr/frcc/models"
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/sqs"
-	"go.uber.org/zap"
 )
 
-type Queue struct {
-	Client   *sqs.Client
-	log      *zap.Logger
-	mutex    sync.Mutex
-	name     string
-	url      *string
-	waitTime time.Duration
+// DeduplicationIDKey is the message key holding an optional deduplication ID.
+// Backends which support it drop a message whose deduplication ID was already sent within their
+// deduplication window, but standard SQS queues do not, so exactly-once processing rests on the job
+// runner, which tracks runs by deduplication ID and skips a message whose run already succeeded.
+const DeduplicationIDKey = "dedup_id"
+
+// MessageIDKey is the message key set by Receive to the ID the backend gave the message, which
+// stays the same on every delivery of the message.
+const MessageIDKey = "message_id"
+
+// defaultWaitTime is how long Receive waits for a message when no wait time is configured, since
+// a receive returning at once would make the job runner spin.
+const defaultWaitTime = 20 * time.Second
+
+// Queue is a job queue with at-least-once delivery.
+// A received message stays invisible to other receivers until it is deleted
+// or its visibility timeout expires, after which it is delivered again.
+type Queue interface {
+	Send(ctx context.Context, msg models.Message) error
+	Receive(ctx context.Context) (*models.Message, string, error)
+	Delete(ctx context.Context, receiptID string) error
 }
 
-type NewQueueOptions struct {
-	Config   aws.Config
-	Log      *zap.Logger
-	Name     string
-	WaitTime time.Duration
-}
-
-func NewQueue(opts NewQueueOptions) *Queue {
-	if opts.Log == nil {
-		opts.Log = zap.NewNop()
-	}
-
-	return &Queue{
-		Client:   sqs.NewFromConfig(opts.Config),
-		log:      opts.Log,
-		name:     opts.Name,
-		waitTime: opts.WaitTime,
-	}
-}
-
-func (q *Queue) getQueueURL(ctx context.Context) error {
-	q.mutex.Lock()
-	defer q.mutex.Unlock()
-
-	if q.url != nil {
-		return nil
-	}
-
-	output, err := q.Client.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{
-		QueueName: &q.name,
-	})
-	if err != nil {
-		return err
-	}
-	q.url = output.QueueUrl
-
-	return nil
-}
-
-func (q *Queue) Send(ctx context.Context, msg models.Message) error {
-	if q.url == nil {
-		if err := q.getQueueURL(ctx); err != nil {
-			return err
-		}
-	}
-
-	messageAsBytes, err := json.Marshal(msg)
-	if err != nil {
-		return err
-	}
-	messageAsString := string(messageAsBytes)
-
-	_, err = q.Client.SendMessage(ctx, &sqs.SendMessageInput{
-		MessageBody: &messageAsString,
-		QueueUrl:    q.url,
-	})
-	return err
-}
-
-func (q *Queue) Receive(ctx context.Context) (*models.Message, string, error) {
-	if q.url == nil {
-		if err := q.getQueueURL(ctx); err != nil {
-			return nil, "", err
-		}
-	}
-
-	output, err := q.Client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
-		QueueUrl:        q.url,
-		WaitTimeSeconds: int32(q.waitTime.Seconds()),
-	})
-	if err != nil {
-		if strings.Contains(err.Error(), "context canceled") {
-			return nil, "", nil
-		}
-		return nil, "", err
-	}
-
-	if len(output.Messages) == 0 {
-		return nil, "", nil
-	}
-
-	var msg models.Message
-	if err := json.Unmarshal([]byte(*output.Messages[0].Body), &msg); err != nil {
-		return nil, "", err
-	}
-
-	return &msg, *output.Messages[0].ReceiptHandle, nil
-}
-
-func (q *Queue) Delete(ctx context.Context, receiptID string) error {
-	if q.url == nil {
-		if err := q.getQueueURL(ctx); err != nil {
-			return err
-		}
-	}
-
-	_, err := q.Client.DeleteMessage(ctx, &sqs.DeleteMessageInput{
-		QueueUrl:      q.url,
-		ReceiptHandle: &receiptID,
-	})
-	return err
+// Checker is implemented by the queues and transports able to tell whether they can be used,
+// for the readiness endpoint.
+type Checker interface {
+	Check(ctx context.Context) error
 }
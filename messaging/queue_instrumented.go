@@ -0,0 +1,93 @@
+package messaging
+
+import (
+	"context"
+
+	"cyberix.fr/frcc/metrics"
+	"cyberix.fr/frcc/models"
+	"cyberix.fr/frcc/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var _ Queue = (*InstrumentedQueue)(nil)
+
+// InstrumentedQueue counts the operations of a Queue and their errors, and traces the sent messages.
+type InstrumentedQueue struct {
+	Queue
+	name string
+}
+
+func NewInstrumentedQueue(q Queue, name string) *InstrumentedQueue {
+	return &InstrumentedQueue{Queue: q, name: name}
+}
+
+// Send records a span, child of the request which created the message when relayed from the
+// outbox, and passes its trace context along in the message to the job.
+func (q *InstrumentedQueue) Send(ctx context.Context, msg models.Message) error {
+	if _, ok := msg[tracing.TraceparentKey]; ok {
+		ctx = tracing.Extract(ctx, msg)
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "queue send "+msg["job"],
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.destination.name", q.name),
+			attribute.String("job", msg["job"]),
+		),
+	)
+	defer span.End()
+
+	traced := make(models.Message, len(msg))
+	for k, v := range msg {
+		if !isTraceKey(k) {
+			traced[k] = v
+		}
+	}
+	tracing.Inject(ctx, traced)
+
+	err := q.Queue.Send(ctx, traced)
+	tracing.RecordError(span, err)
+	q.count("send", err)
+	return err
+}
+
+func isTraceKey(key string) bool {
+	for _, k := range tracing.Keys {
+		if key == k {
+			return true
+		}
+	}
+	return false
+}
+
+// Receive only counts received messages and errors, not the empty polls.
+func (q *InstrumentedQueue) Receive(ctx context.Context) (*models.Message, string, error) {
+	m, receiptID, err := q.Queue.Receive(ctx)
+	if m != nil || err != nil {
+		q.count("receive", err)
+	}
+	return m, receiptID, err
+}
+
+func (q *InstrumentedQueue) Delete(ctx context.Context, receiptID string) error {
+	err := q.Queue.Delete(ctx, receiptID)
+	q.count("delete", err)
+	return err
+}
+
+// Check checks the underlying queue, if it can be checked.
+func (q *InstrumentedQueue) Check(ctx context.Context) error {
+	if checker, ok := q.Queue.(Checker); ok {
+		return checker.Check(ctx)
+	}
+	return nil
+}
+
+func (q *InstrumentedQueue) count(operation string, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	metrics.QueueOperations.WithLabelValues(q.name, operation, result).Inc()
+}
@@ -0,0 +1,173 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"cyberix.fr/frcc/models"
+	"go.uber.org/zap"
+)
+
+var _ Queue = (*MemoryQueue)(nil)
+
+// memoryDeduplicationWindow mirrors the SQS FIFO deduplication interval.
+const memoryDeduplicationWindow = 5 * time.Minute
+
+type memoryEnvelope struct {
+	id  string
+	msg models.Message
+}
+
+// MemoryQueue is an in-process Queue backed by a buffered channel.
+// It is meant for tests and single-binary development, messages are lost on restart.
+type MemoryQueue struct {
+	dedupIDs          map[string]time.Time
+	inFlight          map[string]*time.Timer
+	log               *zap.Logger
+	messages          chan memoryEnvelope
+	mutex             sync.Mutex
+	nextID            int64
+	visibilityTimeout time.Duration
+	waitTime          time.Duration
+}
+
+type NewMemoryQueueOptions struct {
+	Log               *zap.Logger
+	Size              int
+	VisibilityTimeout time.Duration
+	WaitTime          time.Duration
+}
+
+func NewMemoryQueue(opts NewMemoryQueueOptions) *MemoryQueue {
+	if opts.Log == nil {
+		opts.Log = zap.NewNop()
+	}
+
+	if opts.Size <= 0 {
+		opts.Size = 1024
+	}
+
+	if opts.VisibilityTimeout <= 0 {
+		opts.VisibilityTimeout = 30 * time.Second
+	}
+
+	if opts.WaitTime <= 0 {
+		opts.WaitTime = defaultWaitTime
+	}
+
+	return &MemoryQueue{
+		dedupIDs:          map[string]time.Time{},
+		inFlight:          map[string]*time.Timer{},
+		log:               opts.Log,
+		messages:          make(chan memoryEnvelope, opts.Size),
+		visibilityTimeout: opts.VisibilityTimeout,
+		waitTime:          opts.WaitTime,
+	}
+}
+
+func (q *MemoryQueue) Send(ctx context.Context, msg models.Message) error {
+	q.mutex.Lock()
+	if dedupID, ok := msg[DeduplicationIDKey]; ok {
+		now := time.Now()
+		for id, sentAt := range q.dedupIDs {
+			if now.Sub(sentAt) > memoryDeduplicationWindow {
+				delete(q.dedupIDs, id)
+			}
+		}
+
+		if _, ok := q.dedupIDs[dedupID]; ok {
+			q.mutex.Unlock()
+			return nil
+		}
+		q.dedupIDs[dedupID] = now
+	}
+	q.nextID++
+	id := strconv.FormatInt(q.nextID, 10)
+	q.mutex.Unlock()
+
+	return q.push(ctx, memoryEnvelope{id: id, msg: copyMessage(msg)})
+}
+
+func (q *MemoryQueue) push(ctx context.Context, envelope memoryEnvelope) error {
+	select {
+	case q.messages <- envelope:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		return errors.New("memory queue is full")
+	}
+}
+
+func (q *MemoryQueue) Receive(ctx context.Context) (*models.Message, string, error) {
+	timer := time.NewTimer(q.waitTime)
+	defer timer.Stop()
+
+	select {
+	case envelope := <-q.messages:
+		return q.receive(envelope)
+	default:
+	}
+
+	select {
+	case envelope := <-q.messages:
+		return q.receive(envelope)
+	case <-ctx.Done():
+		return nil, "", nil
+	case <-timer.C:
+		return nil, "", nil
+	}
+}
+
+func (q *MemoryQueue) receive(envelope memoryEnvelope) (*models.Message, string, error) {
+	q.mutex.Lock()
+	q.inFlight[envelope.id] = time.AfterFunc(q.visibilityTimeout, func() {
+		q.requeue(envelope)
+	})
+	q.mutex.Unlock()
+
+	msg := copyMessage(envelope.msg)
+	msg[MessageIDKey] = envelope.id
+	return &msg, envelope.id, nil
+}
+
+// requeue makes an in-flight message visible again once its visibility timeout has expired.
+func (q *MemoryQueue) requeue(envelope memoryEnvelope) {
+	q.mutex.Lock()
+	_, ok := q.inFlight[envelope.id]
+	delete(q.inFlight, envelope.id)
+	q.mutex.Unlock()
+
+	if !ok {
+		return
+	}
+
+	if err := q.push(context.Background(), envelope); err != nil {
+		q.log.Info("Error requeuing message", zap.String("id", envelope.id), zap.Error(err))
+	}
+}
+
+func (q *MemoryQueue) Delete(ctx context.Context, receiptID string) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	timer, ok := q.inFlight[receiptID]
+	if !ok {
+		return errors.New("no in-flight message with this receipt id")
+	}
+	timer.Stop()
+	delete(q.inFlight, receiptID)
+
+	return nil
+}
+
+func copyMessage(msg models.Message) models.Message {
+	c := make(models.Message, len(msg))
+	for k, v := range msg {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,118 @@
+package messaging
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cyberix.fr/frcc/models"
+)
+
+func newTestMemoryQueue() *MemoryQueue {
+	return NewMemoryQueue(NewMemoryQueueOptions{
+		VisibilityTimeout: 20 * time.Millisecond,
+		WaitTime:          50 * time.Millisecond,
+	})
+}
+
+func receive(t *testing.T, q Queue) (*models.Message, string) {
+	t.Helper()
+
+	m, receiptID, err := q.Receive(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, receiptID
+}
+
+func TestMemoryQueueSendsReceivesAndDeletes(t *testing.T) {
+	q := newTestMemoryQueue()
+	ctx := context.Background()
+
+	if err := q.Send(ctx, models.Message{"job": "test"}); err != nil {
+		t.Fatal(err)
+	}
+
+	m, receiptID := receive(t, q)
+	if m == nil || (*m)["job"] != "test" || (*m)[MessageIDKey] != receiptID {
+		t.Fatalf("expected the message with its ID, got %v", m)
+	}
+
+	if err := q.Delete(ctx, receiptID); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if m, _ := receive(t, q); m != nil {
+		t.Fatalf("expected the deleted message not to be received again, got %v", m)
+	}
+
+	if err := q.Delete(ctx, receiptID); err == nil {
+		t.Fatal("expected deleting twice to fail")
+	}
+}
+
+func TestMemoryQueueRedeliversAfterVisibilityTimeout(t *testing.T) {
+	q := newTestMemoryQueue()
+
+	if err := q.Send(context.Background(), models.Message{"job": "test"}); err != nil {
+		t.Fatal(err)
+	}
+
+	first, firstReceiptID := receive(t, q)
+	second, secondReceiptID := receive(t, q)
+	if first == nil || second == nil {
+		t.Fatal("expected the message to be received again once its visibility timeout expired")
+	}
+	if (*second)[MessageIDKey] != (*first)[MessageIDKey] || secondReceiptID != firstReceiptID {
+		t.Fatalf("expected the same message ID on every delivery, got %v and %v", first, second)
+	}
+}
+
+func TestMemoryQueueDropsDuplicates(t *testing.T) {
+	q := newTestMemoryQueue()
+	ctx := context.Background()
+
+	for range 2 {
+		if err := q.Send(ctx, models.Message{"job": "test", DeduplicationIDKey: "1"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.Send(ctx, models.Message{"job": "test", DeduplicationIDKey: "2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	received := 0
+	for {
+		m, receiptID := receive(t, q)
+		if m == nil {
+			break
+		}
+		received++
+		if err := q.Delete(ctx, receiptID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if received != 2 {
+		t.Fatalf("expected the duplicate to be dropped, received %v messages", received)
+	}
+}
+
+func TestMemoryQueueDefaultsWaitTime(t *testing.T) {
+	q := NewMemoryQueue(NewMemoryQueueOptions{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	before := time.Now()
+	m, _, err := q.Receive(ctx)
+	if err != nil || m != nil {
+		t.Fatalf("expected no message, got %v, %v", m, err)
+	}
+
+	// without a default, an empty queue would be returned from at once
+	if elapsed := time.Since(before); elapsed < 40*time.Millisecond {
+		t.Fatalf("expected Receive to wait for a message, returned after %v", elapsed)
+	}
+}
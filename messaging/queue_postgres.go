@@ -0,0 +1,211 @@
+package messaging
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"cyberix.fr/frcc/models"
+	"go.uber.org/zap"
+)
+
+var _ Queue = (*PostgresQueue)(nil)
+
+// PostgresQueue is a Queue stored in the queue_messages table.
+// Concurrent receivers never get the same message thanks to SELECT ... FOR UPDATE SKIP LOCKED.
+type PostgresQueue struct {
+	db                *sql.DB
+	log               *zap.Logger
+	name              string
+	pollInterval      time.Duration
+	visibilityTimeout time.Duration
+	waitTime          time.Duration
+}
+
+type NewPostgresQueueOptions struct {
+	DB                *sql.DB
+	Log               *zap.Logger
+	Name              string
+	PollInterval      time.Duration
+	VisibilityTimeout time.Duration
+	WaitTime          time.Duration
+}
+
+func NewPostgresQueue(opts NewPostgresQueueOptions) *PostgresQueue {
+	if opts.Log == nil {
+		opts.Log = zap.NewNop()
+	}
+
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+
+	if opts.VisibilityTimeout <= 0 {
+		opts.VisibilityTimeout = 30 * time.Second
+	}
+
+	if opts.WaitTime <= 0 {
+		opts.WaitTime = defaultWaitTime
+	}
+
+	return &PostgresQueue{
+		db:                opts.DB,
+		log:               opts.Log,
+		name:              opts.Name,
+		pollInterval:      opts.PollInterval,
+		visibilityTimeout: opts.VisibilityTimeout,
+		waitTime:          opts.WaitTime,
+	}
+}
+
+func (q *PostgresQueue) Check(ctx context.Context) error {
+	return q.db.PingContext(ctx)
+}
+
+// postgresDeduplicationWindow mirrors the SQS FIFO deduplication interval.
+const postgresDeduplicationWindow = 5 * time.Minute
+
+const expireQueueMessageDedupID = `
+UPDATE queue_messages
+SET dedup_id = NULL
+WHERE queue = $1 AND dedup_id = $2 AND created_at <= NOW() - $3 * INTERVAL '1 millisecond'
+`
+
+const sendQueueMessage = `
+INSERT INTO queue_messages(queue, body, dedup_id)
+VALUES ($1, $2, $3)
+ON CONFLICT (queue, dedup_id) DO NOTHING
+`
+
+// Send drops a message whose deduplication ID is held by a message of the queue sent within the
+// deduplication window. The ID is released when that message is deleted or the window elapses, so
+// that a later resend is delivered.
+func (q *PostgresQueue) Send(ctx context.Context, msg models.Message) error {
+	messageAsBytes, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	var dedupID *string
+	if id, ok := msg[DeduplicationIDKey]; ok {
+		dedupID = &id
+
+		_, err = q.db.ExecContext(ctx, expireQueueMessageDedupID, q.name, id, postgresDeduplicationWindow.Milliseconds())
+		if err != nil {
+			return fmt.Errorf("error expiring deduplication id: %w", err)
+		}
+	}
+
+	_, err = q.db.ExecContext(ctx, sendQueueMessage, q.name, string(messageAsBytes), dedupID)
+	return err
+}
+
+const receiveQueueMessage = `
+UPDATE queue_messages
+SET
+  receive_count = receive_count + 1,
+  visible_at = NOW() + $2 * INTERVAL '1 millisecond'
+WHERE id = (
+  SELECT id
+  FROM queue_messages
+  WHERE queue = $1 AND visible_at <= NOW()
+  ORDER BY id
+  FOR UPDATE SKIP LOCKED
+  LIMIT 1
+)
+RETURNING id, body, receive_count
+`
+
+// Receive polls the table until a message is visible or the wait time has elapsed.
+func (q *PostgresQueue) Receive(ctx context.Context) (*models.Message, string, error) {
+	deadline := time.Now().Add(q.waitTime)
+
+	for {
+		msg, receiptID, err := q.receiveOnce(ctx)
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				return nil, "", nil
+			}
+			return nil, "", err
+		}
+
+		if msg != nil || !time.Now().Add(q.pollInterval).Before(deadline) {
+			return msg, receiptID, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, "", nil
+		case <-time.After(q.pollInterval):
+		}
+	}
+}
+
+func (q *PostgresQueue) receiveOnce(ctx context.Context) (*models.Message, string, error) {
+	var (
+		id           int64
+		body         string
+		receiveCount int
+	)
+
+	row := q.db.QueryRowContext(ctx, receiveQueueMessage, q.name, q.visibilityTimeout.Milliseconds())
+	if err := row.Scan(&id, &body, &receiveCount); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, "", nil
+		}
+		return nil, "", err
+	}
+
+	var msg models.Message
+	if err := json.Unmarshal([]byte(body), &msg); err != nil {
+		return nil, "", err
+	}
+
+	msg[MessageIDKey] = strconv.FormatInt(id, 10)
+
+	return &msg, fmt.Sprintf("%d.%d", id, receiveCount), nil
+}
+
+const deleteQueueMessage = `
+DELETE FROM queue_messages
+WHERE id = $1 AND receive_count = $2
+`
+
+// Delete removes the message only if it has not been received again since,
+// the same way an SQS receipt handle expires.
+func (q *PostgresQueue) Delete(ctx context.Context, receiptID string) error {
+	idAsString, receiveCountAsString, ok := strings.Cut(receiptID, ".")
+	if !ok {
+		return fmt.Errorf("invalid receipt id %q", receiptID)
+	}
+
+	id, err := strconv.ParseInt(idAsString, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid receipt id %q: %w", receiptID, err)
+	}
+
+	receiveCount, err := strconv.Atoi(receiveCountAsString)
+	if err != nil {
+		return fmt.Errorf("invalid receipt id %q: %w", receiptID, err)
+	}
+
+	result, err := q.db.ExecContext(ctx, deleteQueueMessage, id, receiveCount)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errors.New("message was already deleted or received again")
+	}
+
+	return nil
+}
@@ -0,0 +1,179 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"cyberix.fr/frcc/models"
+	"cyberix.fr/frcc/tracing"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"go.uber.org/zap"
+)
+
+var _ Queue = (*SQSQueue)(nil)
+
+type SQSQueue struct {
+	Client   *sqs.Client
+	log      *zap.Logger
+	mutex    sync.Mutex
+	name     string
+	url      *string
+	waitTime time.Duration
+}
+
+type NewSQSQueueOptions struct {
+	Config   aws.Config
+	Log      *zap.Logger
+	Name     string
+	WaitTime time.Duration
+}
+
+func NewSQSQueue(opts NewSQSQueueOptions) *SQSQueue {
+	if opts.Log == nil {
+		opts.Log = zap.NewNop()
+	}
+
+	// 20 seconds is also the longest poll SQS allows
+	if opts.WaitTime <= 0 {
+		opts.WaitTime = defaultWaitTime
+	}
+
+	return &SQSQueue{
+		Client:   sqs.NewFromConfig(opts.Config),
+		log:      opts.Log,
+		name:     opts.Name,
+		waitTime: opts.WaitTime,
+	}
+}
+
+func (q *SQSQueue) getQueueURL(ctx context.Context) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.url != nil {
+		return nil
+	}
+
+	output, err := q.Client.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{
+		QueueName: &q.name,
+	})
+	if err != nil {
+		return err
+	}
+	q.url = output.QueueUrl
+
+	return nil
+}
+
+// Check looks the queue up again, which fails when SQS is unreachable or the queue is missing.
+func (q *SQSQueue) Check(ctx context.Context) error {
+	_, err := q.Client.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{
+		QueueName: &q.name,
+	})
+	return err
+}
+
+func (q *SQSQueue) Send(ctx context.Context, msg models.Message) error {
+	if q.url == nil {
+		if err := q.getQueueURL(ctx); err != nil {
+			return err
+		}
+	}
+
+	// the trace context travels in message attributes, where SQS integrations expect it
+	body := make(models.Message, len(msg))
+	attributes := map[string]types.MessageAttributeValue{}
+	for k, v := range msg {
+		if isTraceKey(k) {
+			attributes[k] = types.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(v)}
+			continue
+		}
+		body[k] = v
+	}
+
+	messageAsBytes, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	messageAsString := string(messageAsBytes)
+
+	input := &sqs.SendMessageInput{
+		MessageBody: &messageAsString,
+		QueueUrl:    q.url,
+	}
+	if len(attributes) > 0 {
+		input.MessageAttributes = attributes
+	}
+
+	// Deduplication is only supported by FIFO queues, standard queues reject the parameters and
+	// duplicates are then dropped by the job runner, which skips jobs whose run already succeeded.
+	// Each message gets its own group, as the jobs need no ordering and a group shared by every
+	// message of a job would only let one of them be in flight at a time.
+	if dedupID, ok := msg[DeduplicationIDKey]; ok && strings.HasSuffix(q.name, ".fifo") {
+		input.MessageDeduplicationId = &dedupID
+		input.MessageGroupId = &dedupID
+	}
+
+	_, err = q.Client.SendMessage(ctx, input)
+	return err
+}
+
+func (q *SQSQueue) Receive(ctx context.Context) (*models.Message, string, error) {
+	if q.url == nil {
+		if err := q.getQueueURL(ctx); err != nil {
+			return nil, "", err
+		}
+	}
+
+	output, err := q.Client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:              q.url,
+		WaitTimeSeconds:       int32(q.waitTime.Seconds()),
+		MessageAttributeNames: tracing.Keys,
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "context canceled") {
+			return nil, "", nil
+		}
+		return nil, "", err
+	}
+
+	if len(output.Messages) == 0 {
+		return nil, "", nil
+	}
+
+	var msg models.Message
+	if err := json.Unmarshal([]byte(*output.Messages[0].Body), &msg); err != nil {
+		return nil, "", err
+	}
+
+	for k, v := range output.Messages[0].MessageAttributes {
+		if isTraceKey(k) && v.StringValue != nil {
+			msg[k] = *v.StringValue
+		}
+	}
+
+	if output.Messages[0].MessageId != nil {
+		msg[MessageIDKey] = *output.Messages[0].MessageId
+	}
+
+	return &msg, *output.Messages[0].ReceiptHandle, nil
+}
+
+func (q *SQSQueue) Delete(ctx context.Context, receiptID string) error {
+	if q.url == nil {
+		if err := q.getQueueURL(ctx); err != nil {
+			return err
+		}
+	}
+
+	_, err := q.Client.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      q.url,
+		ReceiptHandle: &receiptID,
+	})
+	return err
+}
@@ -0,0 +1,282 @@
+package messaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"cyberix.fr/frcc/models"
+)
+
+// EventInfo describes the event in every email.
+type EventInfo struct {
+	Name     string
+	Location string
+	StartsAt time.Time
+	EndsAt   time.Time
+	Website  string
+}
+
+// EmailData holds the fields shared by every email template.
+type EmailData struct {
+	Name  string
+	Email string
+	Event EventInfo
+}
+
+type OtpEmailData struct {
+	EmailData
+	Otp string
+}
+
+type WelcomeEmailData struct {
+	EmailData
+}
+
+type VerificationEmailData struct {
+	EmailData
+	ActionURL string
+	BaseURL   string
+}
+
+type EventReminderEmailData struct {
+	EmailData
+	DaysLeft int
+}
+
+type RegistrationReminderEmailData struct {
+	EmailData
+}
+
+// CampaignEmailData is the data of campaign templates, the body being split in paragraphs on blank lines.
+type CampaignEmailData struct {
+	EmailData
+	Subject string
+	Body    string
+	// PreferencesURL is the page where the recipient unsubscribes.
+	PreferencesURL string
+}
+
+// campaignTemplates are the templates campaigns can be created from.
+var campaignTemplates = map[string]bool{
+	"campaign_email": true,
+}
+
+// IsCampaignTemplate reports whether campaigns can be created from the named template.
+func IsCampaignTemplate(name string) bool {
+	return campaignTemplates[name]
+}
+
+// emailSamples lists every email template with sample data of the type it is rendered with.
+// Each template is rendered with its sample when parsed, so that a typo or a missing field
+// fails at boot instead of when the email is sent.
+var emailSamples = map[string]func(EmailData) interface{}{
+	"campaign_email": func(d EmailData) interface{} {
+		return CampaignEmailData{EmailData: d, Subject: "Programme du forum", Body: "Le programme est en ligne.\n\nÀ bientôt.", PreferencesURL: "https://example.com/preferences?token=token"}
+	},
+	"confirmation_email": func(d EmailData) interface{} {
+		return WelcomeEmailData{EmailData: d}
+	},
+	"event_reminder_email": func(d EmailData) interface{} {
+		return EventReminderEmailData{EmailData: d, DaysLeft: 7}
+	},
+	"otp_email": func(d EmailData) interface{} {
+		return OtpEmailData{EmailData: d, Otp: "123456"}
+	},
+	"registration_reminder_email": func(d EmailData) interface{} {
+		return RegistrationReminderEmailData{EmailData: d}
+	},
+	"verification_email": func(d EmailData) interface{} {
+		return VerificationEmailData{EmailData: d, ActionURL: "https://example.com/register/confirm/token", BaseURL: "https://example.com"}
+	},
+}
+
+// templateFuncs returns the template functions formatting dates in locale.
+func templateFuncs(locale models.Locale) map[string]interface{} {
+	date, dateRange := formatFrenchDate, formatFrenchDateRange
+	if locale == models.LocaleEnglish {
+		date, dateRange = formatEnglishDate, formatEnglishDateRange
+	}
+
+	return map[string]interface{}{
+		"date":       date,
+		"dateRange":  dateRange,
+		"paragraphs": paragraphs,
+		"year": func() int {
+			return time.Now().Year()
+		},
+	}
+}
+
+var ErrTemplateNotFound = errors.New("email template not found")
+
+type emailTemplate struct {
+	html *htmltemplate.Template
+	text *texttemplate.Template
+}
+
+// RenderedEmail is an email template rendered for one recipient.
+type RenderedEmail struct {
+	Subject  string `json:"subject"`
+	HtmlBody string `json:"html_body"`
+	TextBody string `json:"text_body"`
+}
+
+// Templates are the email templates of every locale, parsed once with their shared layouts and partials.
+type Templates struct {
+	templates map[models.Locale]map[string]emailTemplate
+}
+
+// ParseTemplates parses every email template of emailSamples from the directory of each
+// locale in fsys, and checks that each one renders with its sample data.
+func ParseTemplates(fsys fs.FS) (*Templates, error) {
+	t := &Templates{templates: map[models.Locale]map[string]emailTemplate{}}
+
+	for _, locale := range models.Locales {
+		localeFS, err := fs.Sub(fsys, locale.String())
+		if err != nil {
+			return nil, fmt.Errorf("error opening %v templates: %w", locale, err)
+		}
+
+		t.templates[locale] = map[string]emailTemplate{}
+		for name := range emailSamples {
+			html, err := htmltemplate.New(name).
+				Funcs(templateFuncs(locale)).
+				Option("missingkey=error").
+				ParseFS(localeFS, "layouts/*.html", "partials/*.html", name+".html")
+			if err != nil {
+				return nil, fmt.Errorf("error parsing %v %v html template: %w", locale, name, err)
+			}
+
+			text, err := texttemplate.New(name).
+				Funcs(templateFuncs(locale)).
+				Option("missingkey=error").
+				ParseFS(localeFS, "layouts/*.txt", "partials/*.txt", name+".txt")
+			if err != nil {
+				return nil, fmt.Errorf("error parsing %v %v text template: %w", locale, name, err)
+			}
+
+			t.templates[locale][name] = emailTemplate{html: html, text: text}
+		}
+	}
+
+	sample := EmailData{
+		Name:  "Jane Doe",
+		Email: "jane.doe@example.com",
+		Event: EventInfo{
+			Name:     "Forum",
+			StartsAt: time.Date(2025, time.March, 5, 8, 0, 0, 0, time.UTC),
+			EndsAt:   time.Date(2025, time.March, 7, 18, 0, 0, 0, time.UTC),
+			Website:  "https://example.com",
+		},
+	}
+	for _, locale := range models.Locales {
+		for name, data := range emailSamples {
+			if _, err := t.Render(locale, name, data(sample)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return t, nil
+}
+
+// Render renders the subject, HTML and text bodies of the named email in locale,
+// falling back to the default locale when locale is not supported.
+func (t *Templates) Render(locale models.Locale, name string, data interface{}) (*RenderedEmail, error) {
+	if !locale.IsValid() {
+		locale = models.DefaultLocale
+	}
+
+	tmpl, ok := t.templates[locale][name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", ErrTemplateNotFound, name)
+	}
+
+	var subject bytes.Buffer
+	if err := tmpl.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, fmt.Errorf("error rendering %v %v subject: %w", locale, name, err)
+	}
+
+	var html bytes.Buffer
+	if err := tmpl.html.ExecuteTemplate(&html, "layout", data); err != nil {
+		return nil, fmt.Errorf("error rendering %v %v html template: %w", locale, name, err)
+	}
+
+	var text bytes.Buffer
+	if err := tmpl.text.ExecuteTemplate(&text, "layout", data); err != nil {
+		return nil, fmt.Errorf("error rendering %v %v text template: %w", locale, name, err)
+	}
+
+	return &RenderedEmail{
+		Subject:  strings.TrimSpace(subject.String()),
+		HtmlBody: html.String(),
+		TextBody: text.String(),
+	}, nil
+}
+
+// Names returns the names of the email templates, sorted.
+func (t *Templates) Names() []string {
+	names := make([]string, 0, len(emailSamples))
+	for name := range emailSamples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var frenchMonths = [...]string{
+	"janvier", "février", "mars", "avril", "mai", "juin",
+	"juillet", "août", "septembre", "octobre", "novembre", "décembre",
+}
+
+func formatFrenchDate(t time.Time) string {
+	return fmt.Sprintf("%d %v %d", t.Day(), frenchMonths[t.Month()-1], t.Year())
+}
+
+// formatFrenchDateRange formats a range such as "5 au 7 mars 2025", only repeating the month
+// and year when they differ.
+func formatFrenchDateRange(from, to time.Time) string {
+	switch {
+	case from.Year() != to.Year():
+		return fmt.Sprintf("%v au %v", formatFrenchDate(from), formatFrenchDate(to))
+	case from.Month() != to.Month():
+		return fmt.Sprintf("%d %v au %v", from.Day(), frenchMonths[from.Month()-1], formatFrenchDate(to))
+	default:
+		return fmt.Sprintf("%d au %v", from.Day(), formatFrenchDate(to))
+	}
+}
+
+func formatEnglishDate(t time.Time) string {
+	return t.Format("January 2, 2006")
+}
+
+// formatEnglishDateRange formats a range such as "March 5 to 7, 2025", only repeating the month
+// and year when they differ.
+func formatEnglishDateRange(from, to time.Time) string {
+	switch {
+	case from.Year() != to.Year():
+		return fmt.Sprintf("%v to %v", formatEnglishDate(from), formatEnglishDate(to))
+	case from.Month() != to.Month():
+		return fmt.Sprintf("%v to %v", from.Format("January 2"), formatEnglishDate(to))
+	default:
+		return fmt.Sprintf("%v to %v", from.Format("January 2"), to.Format("2, 2006"))
+	}
+}
+
+// paragraphs splits text on blank lines.
+func paragraphs(text string) []string {
+	var ps []string
+	for _, p := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n\n") {
+		if p = strings.TrimSpace(p); p != "" {
+			ps = append(ps, p)
+		}
+	}
+	return ps
+}
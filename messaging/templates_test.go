@@ -0,0 +1,202 @@
+package messaging
+
+import (
+	"errors"
+	"io/fs"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"cyberix.fr/frcc/models"
+)
+
+func parseTestTemplates(t *testing.T) *Templates {
+	t.Helper()
+
+	templates, err := ParseTemplates(EmailTemplatesFS())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return templates
+}
+
+func otpEmailData() OtpEmailData {
+	return OtpEmailData{
+		EmailData: EmailData{
+			Name:  "Jane Doe",
+			Email: "jane@example.com",
+			Event: EventInfo{
+				Name:     "FRCC",
+				StartsAt: time.Date(2026, time.June, 1, 9, 0, 0, 0, time.UTC),
+				EndsAt:   time.Date(2026, time.June, 3, 18, 0, 0, 0, time.UTC),
+				Website:  "https://frcc.example.com",
+			},
+		},
+		Otp: "424242",
+	}
+}
+
+func TestRenderEveryTemplate(t *testing.T) {
+	templates := parseTestTemplates(t)
+
+	for _, locale := range models.Locales {
+		for _, name := range templates.Names() {
+			t.Run(locale.String()+"/"+name, func(t *testing.T) {
+				email, err := templates.Render(locale, name, emailSamples[name](otpEmailData().EmailData))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if email.Subject == "" || strings.Contains(email.Subject, "\n") {
+					t.Errorf("expected a single line subject, got %q", email.Subject)
+				}
+				if !strings.Contains(email.HtmlBody, "Jane Doe") || !strings.Contains(email.TextBody, "Jane Doe") {
+					t.Errorf("expected the bodies to greet the recipient, got %q and %q", email.HtmlBody, email.TextBody)
+				}
+			})
+		}
+	}
+}
+
+func TestRenderLocales(t *testing.T) {
+	templates := parseTestTemplates(t)
+
+	tests := map[models.Locale]struct {
+		subject string
+		dates   string
+	}{
+		models.LocaleFrench:  {subject: "Votre code OTP", dates: "1 au 3 juin 2026"},
+		models.LocaleEnglish: {subject: "Your OTP code", dates: "June 1 to 3, 2026"},
+		// unsupported locales fall back to the default one
+		"de": {subject: "Votre code OTP", dates: "1 au 3 juin 2026"},
+	}
+
+	for locale, test := range tests {
+		t.Run(locale.String(), func(t *testing.T) {
+			email, err := templates.Render(locale, "otp_email", otpEmailData())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !strings.HasPrefix(email.Subject, test.subject) {
+				t.Errorf("expected the subject to start with %q, got %q", test.subject, email.Subject)
+			}
+			for _, body := range []string{email.HtmlBody, email.TextBody} {
+				if !strings.Contains(body, "424242") || !strings.Contains(body, test.dates) {
+					t.Errorf("expected the body to contain the otp and %q, got %q", test.dates, body)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderEscapesHTML(t *testing.T) {
+	templates := parseTestTemplates(t)
+
+	data := otpEmailData()
+	data.Event.Name = "<b>FRCC</b>"
+
+	email, err := templates.Render(models.LocaleEnglish, "otp_email", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(email.HtmlBody, "<b>FRCC</b>") || !strings.Contains(email.HtmlBody, "&lt;b&gt;FRCC&lt;/b&gt;") {
+		t.Errorf("expected the html body to escape the event name, got %q", email.HtmlBody)
+	}
+	if !strings.Contains(email.TextBody, "<b>FRCC</b>") {
+		t.Errorf("expected the text body not to escape the event name, got %q", email.TextBody)
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	templates := parseTestTemplates(t)
+
+	if _, err := templates.Render(models.LocaleFrench, "unknown_email", otpEmailData()); !errors.Is(err, ErrTemplateNotFound) {
+		t.Errorf("expected ErrTemplateNotFound, got %v", err)
+	}
+
+	// the otp email needs the otp field
+	if _, err := templates.Render(models.LocaleFrench, "otp_email", WelcomeEmailData{EmailData: otpEmailData().EmailData}); err == nil {
+		t.Error("expected rendering with the wrong data to fail")
+	}
+}
+
+func TestParseTemplatesChecksSamples(t *testing.T) {
+	fsys := templateFiles(t)
+	fsys["en/otp_email.txt"] = &fstest.MapFile{
+		Data: []byte(`{{define "subject"}}Code{{end}}{{define "content"}}{{.Code}}{{end}}`),
+	}
+
+	if _, err := ParseTemplates(fsys); err == nil || !strings.Contains(err.Error(), "otp_email") {
+		t.Fatalf("expected the template using a missing field to be rejected, got %v", err)
+	}
+}
+
+// templateFiles copies the embedded email templates.
+func templateFiles(t *testing.T) fstest.MapFS {
+	t.Helper()
+
+	files := fstest.MapFS{}
+	templates := EmailTemplatesFS()
+	err := fs.WalkDir(templates, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		data, err := fs.ReadFile(templates, path)
+		if err != nil {
+			return err
+		}
+		files[path] = &fstest.MapFile{Data: data}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestFormatDateRange(t *testing.T) {
+	day := func(year int, month time.Month, d int) time.Time {
+		return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	tests := map[string]struct {
+		from, to time.Time
+		french   string
+		english  string
+	}{
+		"same month": {
+			from: day(2025, time.March, 5), to: day(2025, time.March, 7),
+			french: "5 au 7 mars 2025", english: "March 5 to 7, 2025",
+		},
+		"other month": {
+			from: day(2025, time.March, 30), to: day(2025, time.April, 2),
+			french: "30 mars au 2 avril 2025", english: "March 30 to April 2, 2025",
+		},
+		"other year": {
+			from: day(2025, time.December, 31), to: day(2026, time.January, 2),
+			french: "31 décembre 2025 au 2 janvier 2026", english: "December 31, 2025 to January 2, 2026",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := formatFrenchDateRange(test.from, test.to); got != test.french {
+				t.Errorf("expected %q, got %q", test.french, got)
+			}
+			if got := formatEnglishDateRange(test.from, test.to); got != test.english {
+				t.Errorf("expected %q, got %q", test.english, got)
+			}
+		})
+	}
+}
+
+func TestParagraphs(t *testing.T) {
+	got := paragraphs("First line\nsame paragraph.\r\n\r\n\n\n  Second.  \n\n")
+	expected := []string{"First line\nsame paragraph.", "Second."}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+}
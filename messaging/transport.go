@@ -0,0 +1,48 @@
+package messaging
+
+import (
+	"context"
+)
+
+// Mail is an email ready to be handed to a Transport.
+type Mail struct {
+	// ID is the Message-ID of the email, reported back by the provider in delivery webhooks.
+	ID string `json:"-"`
+	// Tag groups emails by template in the provider dashboards.
+	Tag           string `json:",omitempty"`
+	MessageStream string
+	From          nameAndEmail
+	To            nameAndEmail
+	Subject       string
+	HtmlBody      string
+	TextBody      string
+	Attachments   []Attachment `json:",omitempty"`
+	// Headers are extra headers, such as List-Unsubscribe.
+	Headers map[string]string `json:"-"`
+}
+
+// Attachment is a file attached to a Mail, its content being base64 encoded in JSON as Postmark expects.
+type Attachment struct {
+	Name        string
+	Content     []byte
+	ContentType string
+}
+
+// Transport delivers rendered emails, through an email provider API, an SMTP relay or a local sink.
+type Transport interface {
+	Send(ctx context.Context, mail Mail) error
+}
+
+// PermanentError is returned by a Transport when the email itself is rejected, such as an
+// invalid or inactive recipient, so that sending it through another provider cannot help.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,202 @@
+package messaging
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var _ Transport = (*MailboxTransport)(nil)
+
+// MailboxTransport is a development sink writing every email as an .eml file in a directory,
+// where it can be read back through the local mailbox UI instead of being delivered.
+type MailboxTransport struct {
+	dir string
+	log *zap.Logger
+}
+
+type NewMailboxTransportOptions struct {
+	Dir string
+	Log *zap.Logger
+}
+
+func NewMailboxTransport(opts NewMailboxTransportOptions) *MailboxTransport {
+	if opts.Log == nil {
+		opts.Log = zap.NewNop()
+	}
+
+	return &MailboxTransport{
+		dir: opts.Dir,
+		log: opts.Log,
+	}
+}
+
+// Check creates the mailbox directory, failing when it cannot be written to.
+func (t *MailboxTransport) Check(ctx context.Context) error {
+	return os.MkdirAll(t.dir, 0o755)
+}
+
+func (t *MailboxTransport) Send(ctx context.Context, m Mail) error {
+	now := time.Now()
+
+	message, err := buildMIME(m, now)
+	if err != nil {
+		return fmt.Errorf("error building email: %w", err)
+	}
+
+	if err := os.MkdirAll(t.dir, 0o755); err != nil {
+		return fmt.Errorf("error creating mailbox directory: %w", err)
+	}
+
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	name := fmt.Sprintf("%s-%s.eml", now.UTC().Format("20060102T150405.000000000"), hex.EncodeToString(suffix))
+
+	if err := os.WriteFile(filepath.Join(t.dir, name), message, 0o644); err != nil {
+		return fmt.Errorf("error writing email to mailbox: %w", err)
+	}
+
+	t.log.Info("Email written to mailbox", zap.String("file", name), zap.String("subject", m.Subject))
+	return nil
+}
+
+type MailboxEntry struct {
+	ID      string    `json:"id"`
+	From    string    `json:"from"`
+	To      string    `json:"to"`
+	Subject string    `json:"subject"`
+	Date    time.Time `json:"date"`
+}
+
+type MailboxMessage struct {
+	MailboxEntry
+	HtmlBody    string   `json:"html_body"`
+	TextBody    string   `json:"text_body"`
+	Attachments []string `json:"attachments"`
+}
+
+// List returns the emails in the mailbox, most recent first.
+func (t *MailboxTransport) List() ([]MailboxEntry, error) {
+	files, err := filepath.Glob(filepath.Join(t.dir, "*.eml"))
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []MailboxEntry{}
+	for _, file := range files {
+		message, err := t.Get(strings.TrimSuffix(filepath.Base(file), ".eml"))
+		if err != nil {
+			t.log.Info("Error reading mailbox email", zap.String("file", file), zap.Error(err))
+			continue
+		}
+		entries = append(entries, message.MailboxEntry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ID > entries[j].ID
+	})
+
+	return entries, nil
+}
+
+// Get reads back the email with the given ID.
+func (t *MailboxTransport) Get(id string) (*MailboxMessage, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.Contains(id, "..") {
+		return nil, errors.New("invalid mailbox email id")
+	}
+
+	raw, err := os.ReadFile(filepath.Join(t.dir, id+".eml"))
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := new(mime.WordDecoder)
+	subject, err := decoder.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+	from, _ := decoder.DecodeHeader(msg.Header.Get("From"))
+	to, _ := decoder.DecodeHeader(msg.Header.Get("To"))
+	date, _ := msg.Header.Date()
+
+	message := &MailboxMessage{
+		MailboxEntry: MailboxEntry{
+			ID:      id,
+			From:    from,
+			To:      to,
+			Subject: subject,
+			Date:    date,
+		},
+	}
+
+	if err := readParts(message, msg.Header.Get("Content-Type"), msg.Body); err != nil {
+		return nil, err
+	}
+
+	return message, nil
+}
+
+// readParts reads the bodies and attachment names of a multipart body into message,
+// descending into nested multipart parts.
+func readParts(message *MailboxMessage, contentType string, body io.Reader) error {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return err
+	}
+
+	reader := multipart.NewReader(body, params["boundary"])
+	for {
+		part, err := reader.NextRawPart()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		mediaType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		if strings.HasPrefix(mediaType, "multipart/") {
+			if err := readParts(message, part.Header.Get("Content-Type"), part); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if _, params, err := mime.ParseMediaType(part.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+			message.Attachments = append(message.Attachments, params["filename"])
+			continue
+		}
+
+		content, err := io.ReadAll(quotedprintable.NewReader(part))
+		if err != nil {
+			return err
+		}
+
+		switch mediaType {
+		case "text/plain":
+			message.TextBody = string(content)
+		case "text/html":
+			message.HtmlBody = string(content)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package messaging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var _ Transport = (*PostmarkTransport)(nil)
+
+// PostmarkMessageIDMetadata is the Postmark metadata key holding the Message-ID of an email.
+const PostmarkMessageIDMetadata = "message_id"
+
+type PostmarkTransport struct {
+	baseURL string
+	client  *http.Client
+	log     *zap.Logger
+	token   string
+}
+
+type NewPostmarkTransportOptions struct {
+	BaseURL string
+	Log     *zap.Logger
+	Timeout time.Duration
+	Token   string
+}
+
+func NewPostmarkTransport(opts NewPostmarkTransportOptions) *PostmarkTransport {
+	if opts.Log == nil {
+		opts.Log = zap.NewNop()
+	}
+
+	if opts.BaseURL == "" {
+		opts.BaseURL = "https://api.postmarkapp.com"
+	}
+
+	if opts.Timeout <= 0 {
+		opts.Timeout = 3 * time.Second
+	}
+
+	return &PostmarkTransport{
+		baseURL: strings.TrimSuffix(opts.BaseURL, "/"),
+		client:  &http.Client{Timeout: opts.Timeout},
+		log:     opts.Log,
+		token:   opts.Token,
+	}
+}
+
+// Check verifies the configuration, without calling Postmark so that no quota is used.
+func (t *PostmarkTransport) Check(ctx context.Context) error {
+	if t.token == "" {
+		return errors.New("postmark token is not set")
+	}
+	return nil
+}
+
+// postmarkEmail is the email sent to Postmark, its metadata being reported back in webhooks.
+type postmarkEmail struct {
+	Mail
+	Headers  []postmarkHeader  `json:",omitempty"`
+	Metadata map[string]string `json:",omitempty"`
+}
+
+type postmarkHeader struct {
+	Name  string
+	Value string
+}
+
+func (t *PostmarkTransport) Send(ctx context.Context, mail Mail) error {
+	email := postmarkEmail{Mail: mail}
+	if mail.ID != "" {
+		email.Metadata = map[string]string{PostmarkMessageIDMetadata: mail.ID}
+	}
+
+	for _, name := range sortedHeaderNames(mail.Headers) {
+		email.Headers = append(email.Headers, postmarkHeader{Name: name, Value: mail.Headers[name]})
+	}
+
+	bodyAsBytes, err := json.Marshal(email)
+	if err != nil {
+		return fmt.Errorf("error marshalling request body to json: %w", err)
+	}
+
+	request, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		t.baseURL+"/email",
+		bytes.NewReader(bodyAsBytes),
+	)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+
+	request.Header.Set("Accept", "application/json")
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Postmark-Server-Token", t.token)
+
+	response, err := t.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("error making request: %w", err)
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	bodyAsBytes, err = io.ReadAll(response.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response body: %w", err)
+	}
+	if response.StatusCode > 299 {
+		t.log.Info(
+			"Error sending email",
+			zap.Int("status", response.StatusCode),
+			zap.String("response", string(bodyAsBytes)),
+		)
+		err := fmt.Errorf("error sending email, got status %v", response.StatusCode)
+		if response.StatusCode == http.StatusUnprocessableEntity {
+			var postmarkErr postmarkError
+			_ = json.Unmarshal(bodyAsBytes, &postmarkErr)
+			err = fmt.Errorf("error sending email, got status %v and error code %v: %v", response.StatusCode, postmarkErr.ErrorCode, postmarkErr.Message)
+
+			// Postmark answers 422 for any refused request, most of them about the account or the
+			// server token, for which another provider is tried, but a few about the email itself.
+			if slices.Contains(postmarkPermanentErrorCodes, postmarkErr.ErrorCode) {
+				return &PermanentError{Err: err}
+			}
+		}
+		return err
+	}
+
+	return nil
+}
+
+// postmarkPermanentErrorCodes are the error codes of the emails Postmark will never accept:
+// 300 for an invalid email address and 406 for an inactive recipient.
+var postmarkPermanentErrorCodes = []int{300, 406}
+
+// postmarkError is the body of the Postmark error responses.
+type postmarkError struct {
+	ErrorCode int
+	Message   string
+}
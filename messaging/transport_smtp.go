@@ -0,0 +1,163 @@
+package messaging
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var _ Transport = (*SMTPTransport)(nil)
+
+// SMTPTransport sends emails through an SMTP relay.
+// The connection is always upgraded with STARTTLS before authenticating, unless explicitly disabled.
+type SMTPTransport struct {
+	address       string
+	host          string
+	insecureNoTLS bool
+	log           *zap.Logger
+	password      string
+	timeout       time.Duration
+	username      string
+}
+
+type NewSMTPTransportOptions struct {
+	Host     string
+	Log      *zap.Logger
+	Password string
+	Port     int
+	Timeout  time.Duration
+	Username string
+	// InsecureNoTLS skips STARTTLS, only meant for a local relay such as MailHog.
+	InsecureNoTLS bool
+}
+
+func NewSMTPTransport(opts NewSMTPTransportOptions) *SMTPTransport {
+	if opts.Log == nil {
+		opts.Log = zap.NewNop()
+	}
+
+	if opts.Port == 0 {
+		opts.Port = 587
+	}
+
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+
+	return &SMTPTransport{
+		address:       net.JoinHostPort(opts.Host, strconv.Itoa(opts.Port)),
+		host:          opts.Host,
+		insecureNoTLS: opts.InsecureNoTLS,
+		log:           opts.Log,
+		password:      opts.Password,
+		timeout:       opts.Timeout,
+		username:      opts.Username,
+	}
+}
+
+// Check verifies the configuration, without connecting to the relay.
+func (t *SMTPTransport) Check(ctx context.Context) error {
+	if t.host == "" {
+		return errors.New("smtp host is not set")
+	}
+
+	if t.username != "" && t.password == "" {
+		return errors.New("smtp password is not set")
+	}
+
+	return nil
+}
+
+func (t *SMTPTransport) Send(ctx context.Context, m Mail) error {
+	message, err := buildMIME(m, time.Now())
+	if err != nil {
+		return fmt.Errorf("error building email: %w", err)
+	}
+
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return fmt.Errorf("error parsing from address: %w", err)
+	}
+
+	to, err := mail.ParseAddress(m.To)
+	if err != nil {
+		return fmt.Errorf("error parsing to address: %w", err)
+	}
+
+	deadline := time.Now().Add(t.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+
+	dialer := net.Dialer{Deadline: deadline}
+	conn, err := dialer.DialContext(ctx, "tcp", t.address)
+	if err != nil {
+		return fmt.Errorf("error connecting to smtp server: %w", err)
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		_ = conn.Close()
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, t.host)
+	if err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("error creating smtp client: %w", err)
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+
+	if !t.insecureNoTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("smtp server does not support STARTTLS")
+		}
+
+		if err := client.StartTLS(&tls.Config{ServerName: t.host, MinVersion: tls.VersionTLS12}); err != nil {
+			return fmt.Errorf("error starting tls: %w", err)
+		}
+	}
+
+	if t.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", t.username, t.password, t.host)); err != nil {
+			return fmt.Errorf("error authenticating to smtp server: %w", err)
+		}
+	}
+
+	if err := client.Mail(from.Address); err != nil {
+		return fmt.Errorf("error setting sender: %w", err)
+	}
+
+	if err := client.Rcpt(to.Address); err != nil {
+		// 5xx replies reject the recipient for good, 4xx ones are transient.
+		var protocolErr *textproto.Error
+		if errors.As(err, &protocolErr) && protocolErr.Code >= 500 {
+			return &PermanentError{Err: fmt.Errorf("error setting recipient: %w", err)}
+		}
+		return fmt.Errorf("error setting recipient: %w", err)
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("error starting data: %w", err)
+	}
+
+	if _, err := writer.Write(message); err != nil {
+		return fmt.Errorf("error writing email: %w", err)
+	}
+
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("error sending email: %w", err)
+	}
+
+	return client.Quit()
+}
@@ -0,0 +1,67 @@
+package messaging
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UnsubscribeTokenLifetime is how long the unsubscribe and preferences links of campaign emails
+// work, long enough for emails which stay in mailboxes.
+const UnsubscribeTokenLifetime = 365 * 24 * time.Hour
+
+// unsubscribeTokenPurpose prefixes the signed input, so that no other token signed with the same
+// key can be taken for an unsubscribe token.
+const unsubscribeTokenPurpose = "frcc.unsubscribe.v1"
+
+// CreateUnsubscribeToken creates the token identifying the recipient in the unsubscribe and
+// preferences links of campaign emails, valid for UnsubscribeTokenLifetime.
+func CreateUnsubscribeToken(key []byte, email string) string {
+	return createUnsubscribeToken(key, email, time.Now().Add(UnsubscribeTokenLifetime))
+}
+
+func createUnsubscribeToken(key []byte, email string, expiresAt time.Time) string {
+	encodedEmail := base64.RawURLEncoding.EncodeToString([]byte(email))
+	expiry := strconv.FormatInt(expiresAt.Unix(), 10)
+	return encodedEmail + "." + expiry + "." + unsubscribeTokenSignature(key, email, expiry)
+}
+
+// ParseUnsubscribeToken returns the email of an unexpired token created by CreateUnsubscribeToken
+// with key.
+func ParseUnsubscribeToken(key []byte, token string) (string, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", false
+	}
+	encodedEmail, expiry, signature := parts[0], parts[1], parts[2]
+
+	email, err := base64.RawURLEncoding.DecodeString(encodedEmail)
+	if err != nil {
+		return "", false
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(unsubscribeTokenSignature(key, string(email), expiry))) {
+		return "", false
+	}
+
+	expiresAt, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || time.Now().Unix() >= expiresAt {
+		return "", false
+	}
+
+	return string(email), true
+}
+
+func unsubscribeTokenSignature(key []byte, email, expiry string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(unsubscribeTokenPurpose))
+	mac.Write([]byte{0})
+	mac.Write([]byte(expiry))
+	mac.Write([]byte{0})
+	mac.Write([]byte(email))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,41 @@
+package messaging
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseUnsubscribeToken(t *testing.T) {
+	key := []byte("unsubscribe key")
+	token := CreateUnsubscribeToken(key, "jane@example.com")
+
+	email, ok := ParseUnsubscribeToken(key, token)
+	if !ok || email != "jane@example.com" {
+		t.Fatalf("expected jane@example.com, got %q, %v", email, ok)
+	}
+
+	encodedEmail, rest, _ := strings.Cut(token, ".")
+	otherToken := CreateUnsubscribeToken(key, "john@example.com")
+	_, otherRest, _ := strings.Cut(otherToken, ".")
+
+	tests := map[string]string{
+		"empty":           "",
+		"no signature":    encodedEmail,
+		"no expiry":       encodedEmail + "." + rest[strings.Index(rest, ".")+1:],
+		"other key":       CreateUnsubscribeToken([]byte("other key"), "jane@example.com"),
+		"other email":     encodedEmail + "." + otherRest,
+		"tampered expiry": encodedEmail + ".9999999999." + rest[strings.Index(rest, ".")+1:],
+		"invalid base64":  "!!!." + rest,
+		"expired":         createUnsubscribeToken(key, "jane@example.com", time.Now().Add(-time.Minute)),
+		"extra part":      token + ".extra",
+	}
+
+	for name, token := range tests {
+		t.Run(name, func(t *testing.T) {
+			if email, ok := ParseUnsubscribeToken(key, token); ok {
+				t.Fatalf("expected the token to be rejected, got %q", email)
+			}
+		})
+	}
+}
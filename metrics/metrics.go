@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "frcc"
+
+// Registry holds the metrics of the API, with the Go runtime and process ones.
+var Registry = prometheus.NewRegistry()
+
+var (
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route pattern, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latencies by route pattern and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	QueueOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "queue_operations_total",
+		Help:      "Queue operations by queue, operation (send, receive, delete) and result (ok, error).",
+	}, []string{"queue", "operation", "result"})
+
+	JobRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "job_runs_total",
+		Help:      "Job runs by job name and status (succeeded, retrying, failed, duplicate).",
+	}, []string{"name", "status"})
+
+	JobDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "job_duration_seconds",
+		Help:      "Job run durations by job name.",
+		Buckets:   []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"name"})
+
+	EmailsSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "emails_sent_total",
+		Help:      "Emails handed to a provider by template and provider.",
+	}, []string{"template", "provider"})
+
+	RegistrationFunnel = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "registration_funnel_total",
+		Help:      "Users reaching each step of the registration funnel.",
+	}, []string{"step"})
+)
+
+// Steps of the registration funnel, in order.
+const (
+	FunnelRegistered = "registered"
+	FunnelOtpSent    = "otp_sent"
+	FunnelConfirmed  = "confirmed"
+	FunnelLoggedIn   = "logged_in"
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPRequestDuration,
+		QueueOperations,
+		JobRuns,
+		JobDuration,
+		EmailsSent,
+		RegistrationFunnel,
+	)
+
+	// the funnel steps are exported from zero, so that rates work before the first registration
+	for _, step := range []string{FunnelRegistered, FunnelOtpSent, FunnelConfirmed, FunnelLoggedIn} {
+		RegistrationFunnel.WithLabelValues(step)
+	}
+}
+
+// RegisterDB exports the connection pool stats of db.
+func RegisterDB(db *sql.DB, name string) {
+	Registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
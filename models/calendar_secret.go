@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// CalendarSecret is signed into the calendar feed URL of the user, so that replacing it revokes
+// the URL.
+type CalendarSecret struct {
+	UserID int32  `db:"user_id" json:"user_id"`
+	Secret string `db:"secret" json:"secret"`
+
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
@@ -0,0 +1,100 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type CampaignStatus = string
+
+const (
+	CampaignStatusDraft     CampaignStatus = "draft"
+	CampaignStatusScheduled CampaignStatus = "scheduled"
+	CampaignStatusSending   CampaignStatus = "sending"
+	CampaignStatusSent      CampaignStatus = "sent"
+	CampaignStatusCancelled CampaignStatus = "cancelled"
+)
+
+// CampaignAudience filters the users a campaign is sent to. Empty filters match every user.
+type CampaignAudience struct {
+	// Organization and Quality match case-insensitively anywhere in the field.
+	Organization string `json:"organization,omitempty"`
+	Quality      string `json:"quality,omitempty"`
+	// PhonePrefix matches the start of the phone number, such as +241 for Gabon.
+	PhonePrefix string `json:"phone_prefix,omitempty"`
+	Locale      Locale `json:"locale,omitempty"`
+	// IncludeUnconfirmed also targets users who did not confirm their registration.
+	IncludeUnconfirmed bool `json:"include_unconfirmed,omitempty"`
+}
+
+// Value stores the audience as JSON in the audience column of campaigns.
+func (a CampaignAudience) Value() (driver.Value, error) {
+	return json.Marshal(a)
+}
+
+func (a *CampaignAudience) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case []byte:
+		return json.Unmarshal(src, a)
+	case string:
+		return json.Unmarshal([]byte(src), a)
+	default:
+		return fmt.Errorf("error scanning campaign audience from %T", src)
+	}
+}
+
+// Campaign is a marketing email sent to an audience of users.
+type Campaign struct {
+	ID       int64            `db:"id" json:"id"`
+	Name     string           `db:"name" json:"name"`
+	Template string           `db:"template" json:"template"`
+	Subject  string           `db:"subject" json:"subject"`
+	Body     string           `db:"body" json:"body"`
+	Audience CampaignAudience `db:"audience" json:"audience"`
+	Status   CampaignStatus   `db:"status" json:"status"`
+	SendAt   *time.Time       `db:"send_at" json:"send_at"`
+
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+type CampaignRecipientStatus = string
+
+const (
+	CampaignRecipientStatusPending CampaignRecipientStatus = "pending"
+	CampaignRecipientStatusQueued  CampaignRecipientStatus = "queued"
+	// CampaignRecipientStatusSending is a recipient claimed by a job about to send the email,
+	// left as is when the job could not record the outcome, so that the email is not sent twice,
+	// until the claim expires as failed.
+	CampaignRecipientStatusSending CampaignRecipientStatus = "sending"
+	CampaignRecipientStatusSent    CampaignRecipientStatus = "sent"
+	CampaignRecipientStatusFailed  CampaignRecipientStatus = "failed"
+	// CampaignRecipientStatusSkipped is an opted out or suppressed recipient.
+	CampaignRecipientStatusSkipped CampaignRecipientStatus = "skipped"
+)
+
+// CampaignRecipient is a user of the audience of a campaign, snapshot when the campaign starts.
+type CampaignRecipient struct {
+	ID         int64                   `db:"id" json:"id"`
+	CampaignID int64                   `db:"campaign_id" json:"campaign_id"`
+	UserID     int32                   `db:"user_id" json:"user_id"`
+	Email      string                  `db:"email" json:"email"`
+	Name       string                  `db:"name" json:"name"`
+	Locale     Locale                  `db:"locale" json:"locale"`
+	Status     CampaignRecipientStatus `db:"status" json:"status"`
+	LastError  *string                 `db:"last_error" json:"last_error"`
+
+	CreatedAt time.Time  `db:"created_at" json:"created_at"`
+	SentAt    *time.Time `db:"sent_at" json:"sent_at"`
+	ClaimedAt *time.Time `db:"claimed_at" json:"claimed_at"`
+}
+
+// MarketingOptOut is an address which no longer receives campaigns.
+type MarketingOptOut struct {
+	Email      string `db:"email" json:"email"`
+	CampaignID *int64 `db:"campaign_id" json:"campaign_id"`
+
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+)
+
+type EmailDeliveryStatus = string
+
+const (
+	EmailDeliveryStatusSent       EmailDeliveryStatus = "sent"
+	EmailDeliveryStatusDelivered  EmailDeliveryStatus = "delivered"
+	EmailDeliveryStatusSoftBounce EmailDeliveryStatus = "soft_bounced"
+	EmailDeliveryStatusBounced    EmailDeliveryStatus = "bounced"
+	EmailDeliveryStatusComplained EmailDeliveryStatus = "complained"
+)
+
+// EmailDelivery tracks one email from its sending to the delivery events reported by the provider.
+type EmailDelivery struct {
+	ID        int64               `db:"id" json:"id"`
+	MessageID string              `db:"message_id" json:"message_id"`
+	Provider  string              `db:"provider" json:"provider"`
+	Recipient string              `db:"recipient" json:"recipient"`
+	Tag       string              `db:"tag" json:"tag"`
+	Status    EmailDeliveryStatus `db:"status" json:"status"`
+	Detail    string              `db:"detail" json:"detail"`
+
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+type EmailSuppressionReason = string
+
+const (
+	EmailSuppressionReasonHardBounce    EmailSuppressionReason = "hard_bounce"
+	EmailSuppressionReasonSpamComplaint EmailSuppressionReason = "spam_complaint"
+)
+
+// EmailSuppression is an address no email is sent to anymore.
+type EmailSuppression struct {
+	Email  string                 `db:"email" json:"email"`
+	Reason EmailSuppressionReason `db:"reason" json:"reason"`
+	Detail string                 `db:"detail" json:"detail"`
+
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
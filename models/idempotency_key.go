@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+// IdempotencyKey is the stored outcome of a request sent with an Idempotency-Key header.
+// StatusCode stays nil while the first request is still being handled.
+type IdempotencyKey struct {
+	Key          string  `db:"key" json:"key"`
+	Fingerprint  string  `db:"fingerprint" json:"fingerprint"`
+	StatusCode   *int32  `db:"status_code" json:"status_code"`
+	ContentType  *string `db:"content_type" json:"content_type"`
+	ResponseBody []byte  `db:"response_body" json:"response_body"`
+
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
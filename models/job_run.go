@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+)
+
+type JobRunStatus = string
+
+const (
+	JobRunStatusQueued    JobRunStatus = "queued"
+	JobRunStatusRunning   JobRunStatus = "running"
+	JobRunStatusRetrying  JobRunStatus = "retrying"
+	JobRunStatusSucceeded JobRunStatus = "succeeded"
+	JobRunStatusFailed    JobRunStatus = "failed"
+)
+
+type JobRun struct {
+	ID          int64        `db:"id" json:"id"`
+	JobID       string       `db:"job_id" json:"job_id"`
+	Name        string       `db:"name" json:"name"`
+	Payload     Message      `db:"payload" json:"-"`
+	PayloadHash string       `db:"payload_hash" json:"payload_hash"`
+	Status      JobRunStatus `db:"status" json:"status"`
+	Attempts    int32        `db:"attempts" json:"attempts"`
+	DurationMs  *int64       `db:"duration_ms" json:"duration_ms"`
+	LastError   *string      `db:"last_error" json:"last_error"`
+
+	CreatedAt  time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt  time.Time  `db:"updated_at" json:"updated_at"`
+	FinishedAt *time.Time `db:"finished_at" json:"finished_at"`
+}
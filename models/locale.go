@@ -0,0 +1,87 @@
+package models
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Locale is the language emails and API messages are written in.
+type Locale string
+
+const (
+	LocaleEnglish Locale = "en"
+	LocaleFrench  Locale = "fr"
+
+	// DefaultLocale is used when no supported locale is asked for.
+	DefaultLocale = LocaleFrench
+)
+
+// Locales are the supported locales.
+var Locales = []Locale{LocaleFrench, LocaleEnglish}
+
+func (l Locale) IsValid() bool {
+	for _, locale := range Locales {
+		if l == locale {
+			return true
+		}
+	}
+	return false
+}
+
+func (l Locale) String() string {
+	return string(l)
+}
+
+// ParseLocale returns the supported locale of a language tag such as "en-GB", or DefaultLocale.
+func ParseLocale(tag string) Locale {
+	primary, _, _ := strings.Cut(strings.TrimSpace(tag), "-")
+	locale := Locale(strings.ToLower(primary))
+	if locale.IsValid() {
+		return locale
+	}
+	return DefaultLocale
+}
+
+// ParseAcceptLanguage returns the supported locale preferred by an Accept-Language header
+// such as "en-US,en;q=0.9,fr;q=0.8", or DefaultLocale.
+func ParseAcceptLanguage(header string) Locale {
+	type weightedTag struct {
+		tag    string
+		weight float64
+	}
+
+	var tags []weightedTag
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" {
+			continue
+		}
+
+		weight := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			w, err := strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+			weight = w
+		}
+
+		if weight > 0 {
+			tags = append(tags, weightedTag{tag: tag, weight: weight})
+		}
+	}
+
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].weight > tags[j].weight
+	})
+
+	for _, t := range tags {
+		primary, _, _ := strings.Cut(t.tag, "-")
+		if locale := Locale(strings.ToLower(primary)); locale.IsValid() {
+			return locale
+		}
+	}
+
+	return DefaultLocale
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+)
+
+type MarketingConsentSource = string
+
+const (
+	MarketingConsentSourceRegistration MarketingConsentSource = "registration"
+	MarketingConsentSourcePreferences  MarketingConsentSource = "preferences"
+	// MarketingConsentSourceUnsubscribe is a withdrawal through the link of a campaign email.
+	MarketingConsentSourceUnsubscribe MarketingConsentSource = "unsubscribe"
+)
+
+// MarketingConsent is a decision of a user about receiving campaigns, the last one being in effect.
+type MarketingConsent struct {
+	ID      int64                  `db:"id" json:"id"`
+	UserID  int32                  `db:"user_id" json:"user_id"`
+	Granted bool                   `db:"granted" json:"granted"`
+	Source  MarketingConsentSource `db:"source" json:"source"`
+	// TextVersion identifies the consent text shown to the user when granted.
+	TextVersion string `db:"text_version" json:"text_version"`
+
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+type OutboxMessage struct {
+	ID       int64   `db:"id" json:"id"`
+	DedupID  string  `db:"dedup_id" json:"dedup_id"`
+	Payload  Message `db:"payload" json:"payload"`
+	Attempts int32   `db:"attempts" json:"attempts"`
+
+	LastError *string `db:"last_error" json:"last_error"`
+
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`
+	PublishedAt *time.Time `db:"published_at" json:"published_at"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+)
+
+type ScheduledJob struct {
+	ID      int64     `db:"id" json:"id"`
+	Key     *string   `db:"key" json:"key"`
+	Payload Message   `db:"payload" json:"payload"`
+	RunAt   time.Time `db:"run_at" json:"run_at"`
+
+	CreatedAt  time.Time  `db:"created_at" json:"created_at"`
+	EnqueuedAt *time.Time `db:"enqueued_at" json:"enqueued_at"`
+}
@@ -4,6 +4,7 @@ import (
 	"time"
 )
 
+// User has the columns of the users table in order, as it is converted from the generated row.
 type User struct {
 	ID           int32  `db:"id" json:"id"`
 	FirstName    string `db:"first_name" json:"first_name"`
@@ -13,12 +14,12 @@ type User struct {
 	Phone        string `db:"phone" json:"phone"`
 	Organization string `db:"organization" json:"organization"`
 
-	ConfirmationToken string `db:"confirmation_token" json:"confirmation_token"`
-	ConfirmedAccount  bool   `db:"confirmed_account" json:"confirmed_account"`
-
 	CreatedAt time.Time `db:"created_at" json:"created_at"`
 	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
 
+	ConfirmationToken      string     `db:"confirmation_token" json:"confirmation_token"`
 	CurrentOtp             *string    `db:"current_otp" json:"current_otp"`
 	CurrentOtpValidityTime *time.Time `db:"current_otp_validity_time" json:"current_otp_validity_time"`
+	ConfirmedAccount       bool       `db:"confirmed_account" json:"confirmed_account"`
+	Locale                 Locale     `db:"locale" json:"locale"`
 }
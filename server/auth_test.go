@@ -0,0 +1,152 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cyberix.fr/frcc/handlers"
+	"cyberix.fr/frcc/messaging"
+	"cyberix.fr/frcc/storage"
+)
+
+// TestAuthFlow registers, confirms and logs in a user, reading the otps from the emails queued
+// through the outbox, as the jobs would.
+func TestAuthFlow(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	payloadCipher, err := messaging.NewPayloadCipher(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := storage.NewMemoryStorage()
+	queue := messaging.NewMemoryQueue(messaging.NewMemoryQueueOptions{WaitTime: 2 * time.Second})
+
+	relay := messaging.NewOutboxRelay(messaging.NewOutboxRelayOptions{
+		DB:       store,
+		Interval: 10 * time.Millisecond,
+		Queue:    queue,
+	})
+	go relay.Start(ctx)
+
+	s := New(Options{
+		JWTKey:        []byte("0123456789abcdef0123456789abcdef"),
+		PayloadCipher: payloadCipher,
+		Queue:         queue,
+		Security: SecurityOptions{
+			AllowedOrigins: []string{"http://localhost:3000"},
+			Cookie:         handlers.SessionCookie{Lifetime: time.Hour, SameSite: http.SameSiteLaxMode},
+		},
+		Storage: store,
+	})
+	s.setupRoutes()
+
+	server := httptest.NewServer(s.mux)
+	defer server.Close()
+
+	const email = "jane@example.com"
+
+	response := post(t, server.URL+"/auth/register", map[string]any{
+		"first_name": "Jane",
+		"last_name":  "Doe",
+		"email":      email,
+		"phone":      "+237600000000",
+	})
+	expectStatus(t, response, http.StatusCreated)
+
+	otp := receiveOtp(t, ctx, queue, payloadCipher, email)
+	response = post(t, server.URL+"/auth/register/confirm", map[string]any{"email": email, "otp": otp})
+	expectStatus(t, response, http.StatusCreated)
+
+	response = post(t, server.URL+"/auth/otp", map[string]any{"email": email, "otp": "000000"})
+	expectStatus(t, response, http.StatusBadRequest)
+
+	response = post(t, server.URL+"/auth/login", map[string]any{"email": email})
+	expectStatus(t, response, http.StatusCreated)
+
+	otp = receiveOtp(t, ctx, queue, payloadCipher, email)
+	response = post(t, server.URL+"/auth/otp", map[string]any{"email": email, "otp": otp})
+	expectStatus(t, response, http.StatusCreated)
+
+	var session *http.Cookie
+	for _, cookie := range response.Cookies() {
+		if cookie.Name == handlers.SessionCookieName {
+			session = cookie
+		}
+	}
+	if session == nil || session.Value == "" {
+		t.Fatal("expected a session cookie")
+	}
+	if !session.HttpOnly {
+		t.Error("expected the session cookie to be HttpOnly")
+	}
+}
+
+func post(t *testing.T, url string, body any) *http.Response {
+	t.Helper()
+
+	bodyAsBytes, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := http.Post(url, "application/json", bytes.NewReader(bodyAsBytes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = response.Body.Close()
+	})
+
+	return response
+}
+
+func expectStatus(t *testing.T, response *http.Response, status int) {
+	t.Helper()
+
+	if response.StatusCode != status {
+		t.Fatalf("expected status %v for %v, got %v", status, response.Request.URL.Path, response.StatusCode)
+	}
+}
+
+// receiveOtp receives the messages of the queue up to the next otp email, checking that the otp
+// was sealed.
+func receiveOtp(t *testing.T, ctx context.Context, queue messaging.Queue, payloadCipher *messaging.PayloadCipher, email string) string {
+	t.Helper()
+
+	for {
+		m, receiptID, err := queue.Receive(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m == nil {
+			t.Fatal("expected an otp email in the queue")
+		}
+		if err := queue.Delete(ctx, receiptID); err != nil {
+			t.Fatal(err)
+		}
+
+		if (*m)["job"] != "otp_email" {
+			continue
+		}
+		if (*m)["email"] != email {
+			t.Fatalf("expected an otp email to %v, got %v", email, (*m)["email"])
+		}
+
+		otp, ok, err := payloadCipher.Open(*m, "otp")
+		if err != nil || !ok {
+			t.Fatalf("error opening otp: %v", err)
+		}
+		if otp == (*m)["otp"] {
+			t.Fatal("expected the otp to be sealed in the queue")
+		}
+
+		return otp
+	}
+}
@@ -0,0 +1,197 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"cyberix.fr/frcc/handlers"
+	"cyberix.fr/frcc/models"
+	"cyberix.fr/frcc/storage"
+	"go.uber.org/zap"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	idempotencyKeyTTL    = 24 * time.Hour
+	maxIdempotencyKeyLen = 255
+)
+
+type iIdempotencyStore interface {
+	CreateIdempotencyKey(ctx context.Context, arg storage.CreateIdempotencyKeyParams) (*models.IdempotencyKey, error)
+	GetIdempotencyKey(ctx context.Context, key string) (*models.IdempotencyKey, error)
+	SaveIdempotencyKeyResponse(ctx context.Context, arg storage.SaveIdempotencyKeyResponseParams) error
+	DeleteIdempotencyKey(ctx context.Context, key string) error
+}
+
+// idempotency makes POST requests carrying an Idempotency-Key header safe to retry.
+// The first request is handled and its response stored, retries with the same key and
+// the same body get the stored response replayed, a different body is rejected.
+// Server errors are not stored so that the client can retry them for real.
+// Keys are scoped to the route, and to the session when there is one. Anonymous keys are not
+// scoped to the IP, so that a client retrying from another network still gets the replay, the
+// fingerprint keeping anyone else from replaying a response with a different body.
+func idempotency(store iIdempotencyStore, log *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(idempotencyKeyHeader)
+			if r.Method != http.MethodPost || key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if len(key) > maxIdempotencyKeyLen {
+				http.Error(w, "error idempotency key is too long", http.StatusBadRequest)
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1048576))
+			if err != nil {
+				http.Error(w, "error reading request body", http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			ctx := r.Context()
+			key = scopeIdempotencyKey(r, key)
+			fingerprint := fingerprintRequest(r, body)
+
+			claimed, err := store.CreateIdempotencyKey(ctx, storage.CreateIdempotencyKeyParams{
+				Key:         key,
+				Fingerprint: fingerprint,
+				TTL:         idempotencyKeyTTL,
+			})
+			if err != nil {
+				log.Info("Error creating idempotency key", zap.Error(err))
+				http.Error(w, "error checking idempotency key", http.StatusInternalServerError)
+				return
+			}
+
+			if claimed == nil {
+				replayIdempotentResponse(ctx, w, store, key, fingerprint, log)
+				return
+			}
+
+			// The request context may be canceled by now, the outcome must be stored regardless.
+			release := func() {
+				deleteCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+				defer cancel()
+				if err := store.DeleteIdempotencyKey(deleteCtx, key); err != nil {
+					log.Info("Error deleting idempotency key", zap.Error(err))
+				}
+			}
+
+			// a panicking handler must not leave the key claimed, as the retries would never be served
+			defer func() {
+				if rec := recover(); rec != nil {
+					release()
+					panic(rec)
+				}
+			}()
+
+			recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(recorder, r)
+
+			if recorder.status >= http.StatusInternalServerError {
+				release()
+				return
+			}
+
+			saveCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			err = store.SaveIdempotencyKeyResponse(saveCtx, storage.SaveIdempotencyKeyResponseParams{
+				Key:          key,
+				StatusCode:   int32(recorder.status),
+				ContentType:  recorder.Header().Get("Content-Type"),
+				ResponseBody: recorder.body.Bytes(),
+			})
+			if err != nil {
+				log.Info("Error saving idempotency key response", zap.Error(err))
+			}
+		})
+	}
+}
+
+func replayIdempotentResponse(ctx context.Context, w http.ResponseWriter, store iIdempotencyStore, key, fingerprint string, log *zap.Logger) {
+	stored, err := store.GetIdempotencyKey(ctx, key)
+	if err != nil {
+		log.Info("Error getting idempotency key", zap.Error(err))
+		http.Error(w, "error checking idempotency key", http.StatusInternalServerError)
+		return
+	}
+
+	switch {
+	// the key was deleted in between, after a server error
+	case stored == nil:
+		http.Error(w, "error request with this idempotency key failed, retry it", http.StatusConflict)
+	case stored.Fingerprint != fingerprint:
+		http.Error(w, "error idempotency key already used for a different request", http.StatusUnprocessableEntity)
+	case stored.StatusCode == nil:
+		http.Error(w, "error request with this idempotency key is still in progress", http.StatusConflict)
+	default:
+		if stored.ContentType != nil && *stored.ContentType != "" {
+			w.Header().Set("Content-Type", *stored.ContentType)
+		}
+		w.Header().Set("Idempotent-Replayed", "true")
+		w.WriteHeader(int(*stored.StatusCode))
+		_, _ = w.Write(stored.ResponseBody)
+	}
+}
+
+// scopeIdempotencyKey hashes the key with the route, and with the session when there is one.
+func scopeIdempotencyKey(r *http.Request, key string) string {
+	client := "anonymous"
+	if cookie, err := r.Cookie(handlers.SessionCookieName); err == nil && cookie.Value != "" {
+		client = "session:" + cookie.Value
+	}
+
+	h := sha256.New()
+	h.Write([]byte(r.Method))
+	h.Write([]byte{0})
+	h.Write([]byte(r.URL.Path))
+	h.Write([]byte{0})
+	h.Write([]byte(client))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// fingerprintRequest identifies a request by its method, path and body.
+func fingerprintRequest(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method))
+	h.Write([]byte{0})
+	h.Write([]byte(r.URL.Path))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// responseRecorder passes the response through while keeping a copy of its status and body.
+type responseRecorder struct {
+	http.ResponseWriter
+	body        bytes.Buffer
+	status      int
+	wroteHeader bool
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	if !rr.wroteHeader {
+		rr.status = status
+		rr.wroteHeader = true
+	}
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	if !rr.wroteHeader {
+		rr.WriteHeader(http.StatusOK)
+	}
+	rr.body.Write(b)
+	return rr.ResponseWriter.Write(b)
+}
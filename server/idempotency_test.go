@@ -0,0 +1,148 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"cyberix.fr/frcc/handlers"
+	"cyberix.fr/frcc/storage"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// newIdempotentMux serves /a and /b behind the idempotency middleware with handle, counting the
+// calls which were not replayed.
+func newIdempotentMux(handle func(w http.ResponseWriter, calls int)) (http.Handler, *int) {
+	calls := 0
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		handle(w, calls)
+	}
+
+	mux := chi.NewMux()
+	idempotent := mux.With(idempotency(storage.NewMemoryStorage(), zap.NewNop()))
+	idempotent.Post("/a", handler)
+	idempotent.Post("/b", handler)
+
+	return mux, &calls
+}
+
+func created(w http.ResponseWriter, calls int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_, _ = fmt.Fprintf(w, `{"call":%v}`, calls)
+}
+
+type idempotentRequest struct {
+	path, key, body, remoteAddr, session string
+}
+
+func serveIdempotent(mux http.Handler, req idempotentRequest) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, req.path, strings.NewReader(req.body))
+	if req.key != "" {
+		r.Header.Set(idempotencyKeyHeader, req.key)
+	}
+	if req.remoteAddr != "" {
+		r.RemoteAddr = req.remoteAddr
+	}
+	if req.session != "" {
+		r.AddCookie(&http.Cookie{Name: handlers.SessionCookieName, Value: req.session})
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	return w
+}
+
+func TestIdempotencyReplaysFromAnotherAddress(t *testing.T) {
+	mux, calls := newIdempotentMux(created)
+
+	first := serveIdempotent(mux, idempotentRequest{path: "/a", key: "k", body: `{"x":1}`, remoteAddr: "192.0.2.1:1234"})
+	retry := serveIdempotent(mux, idempotentRequest{path: "/a", key: "k", body: `{"x":1}`, remoteAddr: "198.51.100.7:4321"})
+
+	if *calls != 1 {
+		t.Fatalf("expected the handler to run once, ran %v times", *calls)
+	}
+	if retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() {
+		t.Fatalf("expected the response to be replayed, got %v %q", retry.Code, retry.Body.String())
+	}
+	if retry.Header().Get("Idempotent-Replayed") != "true" || retry.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("expected the replay headers, got %v", retry.Header())
+	}
+}
+
+func TestIdempotencyRejectsAnotherBody(t *testing.T) {
+	mux, calls := newIdempotentMux(created)
+
+	serveIdempotent(mux, idempotentRequest{path: "/a", key: "k", body: `{"x":1}`})
+	w := serveIdempotent(mux, idempotentRequest{path: "/a", key: "k", body: `{"x":2}`})
+
+	if w.Code != http.StatusUnprocessableEntity || *calls != 1 {
+		t.Fatalf("expected the reuse with another body to be rejected, got %v after %v calls", w.Code, *calls)
+	}
+}
+
+func TestIdempotencyScopes(t *testing.T) {
+	tests := map[string]idempotentRequest{
+		"other route":   {path: "/b", key: "k", body: `{}`},
+		"other session": {path: "/a", key: "k", body: `{}`, session: "other"},
+		"other key":     {path: "/a", key: "other", body: `{}`},
+		"no key":        {path: "/a", body: `{}`},
+	}
+
+	for name, req := range tests {
+		t.Run(name, func(t *testing.T) {
+			mux, calls := newIdempotentMux(created)
+
+			serveIdempotent(mux, idempotentRequest{path: "/a", key: "k", body: `{}`, session: "session"})
+			w := serveIdempotent(mux, req)
+
+			if *calls != 2 || w.Header().Get("Idempotent-Replayed") != "" {
+				t.Fatalf("expected the handler to run again, ran %v times", *calls)
+			}
+		})
+	}
+}
+
+func TestIdempotencyReleasesKeyOnServerError(t *testing.T) {
+	mux, calls := newIdempotentMux(func(w http.ResponseWriter, calls int) {
+		if calls == 1 {
+			http.Error(w, "error", http.StatusInternalServerError)
+			return
+		}
+		created(w, calls)
+	})
+
+	serveIdempotent(mux, idempotentRequest{path: "/a", key: "k", body: `{}`})
+	w := serveIdempotent(mux, idempotentRequest{path: "/a", key: "k", body: `{}`})
+
+	if w.Code != http.StatusCreated || *calls != 2 {
+		t.Fatalf("expected the retry to run the handler, got %v after %v calls", w.Code, *calls)
+	}
+}
+
+func TestIdempotencyReleasesKeyOnPanic(t *testing.T) {
+	mux, calls := newIdempotentMux(func(w http.ResponseWriter, calls int) {
+		if calls == 1 {
+			panic("boom")
+		}
+		created(w, calls)
+	})
+
+	func() {
+		defer func() {
+			if rec := recover(); rec != "boom" {
+				t.Fatalf("expected the panic to be passed on, got %v", rec)
+			}
+		}()
+		serveIdempotent(mux, idempotentRequest{path: "/a", key: "k", body: `{}`})
+	}()
+
+	w := serveIdempotent(mux, idempotentRequest{path: "/a", key: "k", body: `{}`})
+	if w.Code != http.StatusCreated || *calls != 2 {
+		t.Fatalf("expected the retry to run the handler, got %v after %v calls", w.Code, *calls)
+	}
+}
@@ -0,0 +1,241 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"cyberix.fr/frcc/handlers"
+	"cyberix.fr/frcc/logging"
+	"cyberix.fr/frcc/metrics"
+	"cyberix.fr/frcc/tracing"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// requireAdminToken only lets through requests carrying the admin token as a bearer token.
+// Admin routes are disabled altogether when no token is configured.
+func requireAdminToken(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token == "" {
+				http.Error(w, "error admin routes are disabled", http.StatusForbidden)
+				return
+			}
+
+			given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				http.Error(w, "error invalid admin token", http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requireWebhookAuth checks the credentials of email provider webhooks: basic auth, as set in the
+// webhook URL on Postmark, and an HMAC-SHA256 signature of the body in the X-Webhook-Signature header.
+// Every configured check must pass, and webhooks are disabled when none is configured.
+func requireWebhookAuth(username, password, secret string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if username == "" && secret == "" {
+				http.Error(w, "error webhooks are disabled", http.StatusForbidden)
+				return
+			}
+
+			if username != "" {
+				givenUsername, givenPassword, ok := r.BasicAuth()
+				if !ok ||
+					subtle.ConstantTimeCompare([]byte(givenUsername), []byte(username)) != 1 ||
+					subtle.ConstantTimeCompare([]byte(givenPassword), []byte(password)) != 1 {
+					http.Error(w, "error invalid webhook credentials", http.StatusUnauthorized)
+					return
+				}
+			}
+
+			if secret != "" {
+				body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1048576))
+				if err != nil {
+					http.Error(w, "error reading webhook payload", http.StatusBadRequest)
+					return
+				}
+				r.Body = io.NopCloser(bytes.NewReader(body))
+
+				mac := hmac.New(sha256.New, []byte(secret))
+				mac.Write(body)
+				expected := hex.EncodeToString(mac.Sum(nil))
+
+				if !hmac.Equal([]byte(r.Header.Get("X-Webhook-Signature")), []byte(expected)) {
+					http.Error(w, "error invalid webhook signature", http.StatusUnauthorized)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requireTrustedOrigin protects the session cookie against cross-site request forgery: a mutating
+// request carrying the cookie must come from an allowed origin, given by the Origin header or, for
+// the browsers which leave it out, by the Referer. Requests without the cookie are not concerned.
+func requireTrustedOrigin(allowedOrigins []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if _, err := r.Cookie(handlers.SessionCookieName); err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				if referer, err := url.Parse(r.Referer()); err == nil && referer.Host != "" {
+					origin = referer.Scheme + "://" + referer.Host
+				}
+			}
+
+			if origin == "" || !slices.Contains(allowedOrigins, origin) {
+				http.Error(w, "error request origin is not allowed", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// instrument counts requests and measures their latency per route pattern, so that paths with
+// parameters such as /admin/jobs/{id}/retry are aggregated, and traces them, continuing the
+// trace of the caller given in the traceparent header.
+func instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		before := time.Now()
+
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracing.Tracer().Start(ctx, r.Method, trace.WithSpanKind(trace.SpanKindServer))
+		defer span.End()
+
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		route := chi.RouteContext(r.Context()).RoutePattern()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		span.SetName(r.Method + " " + route)
+		span.SetAttributes(
+			attribute.String("http.request.method", r.Method),
+			attribute.String("http.route", route),
+			attribute.Int("http.response.status_code", responseStatus(ww)),
+		)
+		if responseStatus(ww) >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(responseStatus(ww)))
+		}
+
+		metrics.HTTPRequests.WithLabelValues(route, r.Method, strconv.Itoa(responseStatus(ww))).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(route, r.Method).Observe(time.Since(before).Seconds())
+	})
+}
+
+const requestIDHeader = "X-Request-ID"
+
+// requestIDPattern bounds the request IDs accepted from callers, as they end up in every log line.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// requestLogger assigns each request an ID, keeping the one given by the caller or a proxy in the
+// X-Request-ID header, puts a logger carrying it in the request context for the handlers, and logs
+// the request once served.
+func requestLogger(log *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestID := r.Header.Get(requestIDHeader)
+			if !requestIDPattern.MatchString(requestID) {
+				requestID = newRequestID()
+			}
+			w.Header().Set(requestIDHeader, requestID)
+
+			requestLog := log.With(zap.String("request_id", requestID))
+			if spanContext := trace.SpanContextFromContext(r.Context()); spanContext.IsValid() {
+				requestLog = requestLog.With(zap.String("trace_id", spanContext.TraceID().String()))
+			}
+
+			info := &logging.RequestInfo{}
+			ctx := logging.WithLogger(r.Context(), requestLog)
+			ctx = logging.WithRequestInfo(ctx, info)
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			before := time.Now()
+
+			next.ServeHTTP(ww, r.WithContext(ctx))
+
+			route := chi.RouteContext(r.Context()).RoutePattern()
+			if route == "" {
+				route = "unmatched"
+			}
+
+			fields := []zap.Field{
+				zap.String("method", r.Method),
+				zap.String("route", route),
+				zap.Int("status", responseStatus(ww)),
+				zap.Duration("latency", time.Since(before)),
+				zap.String("ip", clientIP(r)),
+			}
+			if userID := info.UserID(); userID != "" {
+				fields = append(fields, zap.String("user_id", userID))
+			}
+
+			requestLog.Info("Request", fields...)
+		})
+	}
+}
+
+// responseStatus returns the status code written, which is 200 when the handler wrote nothing.
+func responseStatus(ww middleware.WrapResponseWriter) int {
+	if ww.Status() == 0 {
+		return http.StatusOK
+	}
+	return ww.Status()
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// clientIP returns the IP of the peer, which chi's RealIP middleware would replace with the
+// forwarded one if the API is set behind a trusted proxy.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
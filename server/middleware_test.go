@@ -0,0 +1,70 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type webhookRequest struct {
+	username, password, signature string
+}
+
+func serveWebhook(username, password, secret string, req webhookRequest) (int, string) {
+	var body string
+	handler := requireWebhookAuth(username, password, secret)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+	}))
+
+	r := httptest.NewRequest(http.MethodPost, "/webhooks/email", strings.NewReader(`{"RecordType":"Delivery"}`))
+	if req.username != "" {
+		r.SetBasicAuth(req.username, req.password)
+	}
+	if req.signature != "" {
+		r.Header.Set("X-Webhook-Signature", req.signature)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w.Code, body
+}
+
+func TestRequireWebhookAuth(t *testing.T) {
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(`{"RecordType":"Delivery"}`))
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	tests := map[string]struct {
+		username, secret string
+		req              webhookRequest
+		expected         int
+	}{
+		"disabled":           {req: webhookRequest{username: "postmark", password: "password"}, expected: http.StatusForbidden},
+		"basic auth":         {username: "postmark", req: webhookRequest{username: "postmark", password: "password"}, expected: http.StatusOK},
+		"wrong password":     {username: "postmark", req: webhookRequest{username: "postmark", password: "wrong"}, expected: http.StatusUnauthorized},
+		"missing basic auth": {username: "postmark", expected: http.StatusUnauthorized},
+		"signature":          {secret: "secret", req: webhookRequest{signature: signature}, expected: http.StatusOK},
+		"wrong signature":    {secret: "secret", req: webhookRequest{signature: strings.Repeat("0", 64)}, expected: http.StatusUnauthorized},
+		"both required":      {username: "postmark", secret: "secret", req: webhookRequest{signature: signature}, expected: http.StatusUnauthorized},
+		"both given":         {username: "postmark", secret: "secret", req: webhookRequest{username: "postmark", password: "password", signature: signature}, expected: http.StatusOK},
+		"missing signature":  {secret: "secret", expected: http.StatusUnauthorized},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			code, body := serveWebhook(test.username, "password", test.secret, test.req)
+			if code != test.expected {
+				t.Fatalf("expected %v, got %v", test.expected, code)
+			}
+			if code == http.StatusOK && body != `{"RecordType":"Delivery"}` {
+				t.Fatalf("expected the body to be passed on, got %q", body)
+			}
+		})
+	}
+}
@@ -2,31 +2,92 @@ package server
 
 import (
 	"cyberix.fr/frcc/handlers"
+	"cyberix.fr/frcc/messaging"
+	"cyberix.fr/frcc/metrics"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/cors"
 )
 
 func (s *Server) setupRoutes() {
-	appHandler := handlers.NewAppHandler()
+	appHandler := handlers.NewAppHandler(handlers.NewAppHandlerOptions{
+		CalendarKey:    s.calendarKey,
+		JWTKey:         s.jwtKey,
+		PayloadCipher:  s.payloadCipher,
+		UnsubscribeKey: s.unsubscribeKey,
+	})
 
+	s.mux.Use(instrument)
+	s.mux.Use(requestLogger(s.log))
 	s.mux.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"*"},
+		AllowedOrigins:   s.security.AllowedOrigins,
 		AllowedMethods:   []string{"GET", "POST", "DELETE", "PUT", "PATCH"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "Idempotency-Key", "X-CSRF-Token", "X-Request-ID"},
+		ExposedHeaders:   []string{"Idempotent-Replayed", "Link", "X-Request-ID"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
+	s.mux.Use(requireTrustedOrigin(s.security.AllowedOrigins))
 
 	s.mux.Group(func(r chi.Router) {
-		appHandler.Health(s.mux)
+		appHandler.Health(s.mux, s.release, s.healthChecks())
+		// metrics expose the traffic and the job activity, scrapers send the admin token
+		r.With(requireAdminToken(s.adminToken)).Handle("/metrics", metrics.Handler())
+
+		if s.mailbox != nil {
+			appHandler.Mailbox(r, s.mailbox)
+		}
 
 		r.Route("/auth", func(r chi.Router) {
-			appHandler.Register(r, s.database.Storage, s.queue)
-			appHandler.RegisterConfirm(r, s.database.Storage, s.queue)
-			appHandler.Login(r, s.database.Storage, s.queue)
-			appHandler.Otp(r, s.database.Storage)
+			// otp is left out, its response sets the session cookie which must not be stored
+			idempotent := r.With(idempotency(s.storage, s.log))
+
+			appHandler.Register(idempotent, s.storage)
+			appHandler.RegisterConfirm(idempotent, s.storage)
+			appHandler.Login(idempotent, s.storage)
+			appHandler.Otp(r, s.storage, s.security.Cookie)
+		})
+
+		appHandler.Calendar(r, s.storage, s.event)
+		appHandler.Preferences(r, s.storage)
+		appHandler.Unsubscribe(r, s.storage)
+
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(requireAdminToken(s.adminToken))
+
+			appHandler.ListJobRuns(r, s.storage)
+			appHandler.RetryJobRun(r, s.storage, s.queue)
+			appHandler.EmailProviders(r, s.emailer)
+			appHandler.EmailTemplates(r, s.emailer)
+			appHandler.PreviewEmail(r, s.storage, s.emailer)
+			appHandler.SendTestEmail(r, s.storage, s.emailer)
+			appHandler.EmailDeliveries(r, s.storage)
+			appHandler.EmailSuppressions(r, s.storage)
+			appHandler.Campaigns(r, s.storage)
+			appHandler.ScheduleCampaign(r, s.storage)
+			appHandler.MarketingOptOuts(r, s.storage)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(requireWebhookAuth(s.webhooks.Username, s.webhooks.Password, s.webhooks.Secret))
+
+			appHandler.DeliveryWebhook(r, s.storage, s.log)
 		})
 
 	})
 }
+
+// healthChecks are the dependencies checked by the readiness endpoint.
+func (s *Server) healthChecks() []handlers.HealthCheck {
+	var checks []handlers.HealthCheck
+	if s.database != nil {
+		checks = append(checks, handlers.HealthCheck{Name: "postgres", ComponentType: "datastore", Check: s.database.Ping})
+	}
+
+	if checker, ok := s.queue.(messaging.Checker); ok {
+		checks = append(checks, handlers.HealthCheck{Name: "queue", ComponentType: "component", Check: checker.Check})
+	}
+
+	checks = append(checks, handlers.HealthCheck{Name: "email", ComponentType: "component", Check: s.emailer.Check})
+
+	return checks
+}
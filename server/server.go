@@ -9,6 +9,7 @@ import (
 	"strconv"
 	"time"
 
+	"cyberix.fr/frcc/handlers"
 	"cyberix.fr/frcc/messaging"
 	"cyberix.fr/frcc/storage"
 	"github.com/go-chi/chi/v5"
@@ -16,20 +17,64 @@ import (
 )
 
 type Server struct {
-	address  string
-	database *storage.Database
-	log      *zap.Logger
-	mux      chi.Router
-	queue    *messaging.Queue
-	server   *http.Server
+	address        string
+	adminToken     string
+	calendarKey    []byte
+	database       *storage.Database
+	emailer        *messaging.Emailer
+	event          messaging.EventInfo
+	jwtKey         []byte
+	log            *zap.Logger
+	mailbox        *messaging.MailboxTransport
+	mux            chi.Router
+	payloadCipher  *messaging.PayloadCipher
+	queue          messaging.Queue
+	release        string
+	security       SecurityOptions
+	server         *http.Server
+	storage        storage.Storage
+	unsubscribeKey []byte
+	webhooks       WebhookOptions
+}
+
+// WebhookOptions are the credentials expected from email provider webhooks.
+type WebhookOptions struct {
+	Username string
+	Password string
+	Secret   string
+}
+
+// SecurityOptions are the policies the browsers are held to: the origins allowed to call the api
+// with credentials, and the session cookie.
+type SecurityOptions struct {
+	// AllowedOrigins are the origins allowed by CORS, and the only ones allowed to send mutating
+	// requests authenticated by the session cookie.
+	AllowedOrigins []string
+	Cookie         handlers.SessionCookie
 }
 
 type Options struct {
-	Database *storage.Database
-	Host     string
-	Log      *zap.Logger
-	Port     int
-	Queue    *messaging.Queue
+	AdminToken string
+	// CalendarKey signs the calendar feed tokens.
+	CalendarKey []byte
+	Database    *storage.Database
+	Emailer     *messaging.Emailer
+	Event       messaging.EventInfo
+	Host        string
+	JWTKey      []byte
+	Log         *zap.Logger
+	Mailbox     *messaging.MailboxTransport
+	// PayloadCipher seals the otps written to the outbox.
+	PayloadCipher *messaging.PayloadCipher
+	Port          int
+	Queue         messaging.Queue
+	// Release is the build reported by the health endpoints.
+	Release  string
+	Security SecurityOptions
+	Storage  storage.Storage
+	// UnsubscribeKey verifies the unsubscribe tokens of campaign emails.
+	UnsubscribeKey []byte
+	Webhooks       WebhookOptions
 }
 
 func New(opts Options) *Server {
@@ -41,11 +86,23 @@ func New(opts Options) *Server {
 	mux := chi.NewMux()
 
 	return &Server{
-		address:  address,
-		database: opts.Database,
-		log:      opts.Log,
-		mux:      mux,
-		queue:    opts.Queue,
+		address:        address,
+		adminToken:     opts.AdminToken,
+		calendarKey:    opts.CalendarKey,
+		database:       opts.Database,
+		emailer:        opts.Emailer,
+		event:          opts.Event,
+		jwtKey:         opts.JWTKey,
+		log:            opts.Log,
+		mailbox:        opts.Mailbox,
+		mux:            mux,
+		payloadCipher:  opts.PayloadCipher,
+		queue:          opts.Queue,
+		release:        opts.Release,
+		security:       opts.Security,
+		storage:        opts.Storage,
+		unsubscribeKey: opts.UnsubscribeKey,
+		webhooks:       opts.Webhooks,
 		server: &http.Server{
 			Addr:              address,
 			Handler:           mux,
@@ -58,8 +115,10 @@ func New(opts Options) *Server {
 }
 
 func (s *Server) Start() error {
-	if err := s.database.Connect(); err != nil {
-		return fmt.Errorf("error connection to database: %w", err)
+	if s.database != nil {
+		if err := s.database.Connect(); err != nil {
+			return fmt.Errorf("error connection to database: %w", err)
+		}
 	}
 
 	s.setupRoutes()
@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"cyberix.fr/frcc/models"
+	sqlcdb "cyberix.fr/frcc/storage/sqlc/db"
+)
+
+type CreateCalendarSecretParams = sqlcdb.CreateCalendarSecretParams
+
+// CreateCalendarSecret keeps the secret of the user when one already exists.
+func (q *Queries) CreateCalendarSecret(ctx context.Context, arg CreateCalendarSecretParams) error {
+	return q.q.CreateCalendarSecret(ctx, arg)
+}
+
+// GetCalendarSecret returns nil when the user has no calendar secret.
+func (q *Queries) GetCalendarSecret(ctx context.Context, userID int32) (*models.CalendarSecret, error) {
+	row, err := q.q.GetCalendarSecret(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	secret := models.CalendarSecret(*row)
+	return &secret, nil
+}
+
+type RotateCalendarSecretParams = sqlcdb.RotateCalendarSecretParams
+
+// RotateCalendarSecret replaces the secret of the user, or creates it.
+func (q *Queries) RotateCalendarSecret(ctx context.Context, arg RotateCalendarSecretParams) (*models.CalendarSecret, error) {
+	row, err := q.q.RotateCalendarSecret(ctx, arg)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := models.CalendarSecret(*row)
+	return &secret, nil
+}
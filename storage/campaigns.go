@@ -0,0 +1,217 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"cyberix.fr/frcc/models"
+	sqlcdb "cyberix.fr/frcc/storage/sqlc/db"
+)
+
+type CreateCampaignParams = sqlcdb.CreateCampaignParams
+
+func (q *Queries) CreateCampaign(ctx context.Context, arg CreateCampaignParams) (*models.Campaign, error) {
+	row, err := q.q.CreateCampaign(ctx, arg)
+	if err != nil {
+		return nil, err
+	}
+
+	campaign := models.Campaign(*row)
+	return &campaign, nil
+}
+
+func (q *Queries) GetCampaign(ctx context.Context, id int64) (*models.Campaign, error) {
+	return campaignOrNil(q.q.GetCampaign(ctx, id))
+}
+
+type ListCampaignsParams = sqlcdb.ListCampaignsParams
+
+func (q *Queries) ListCampaigns(ctx context.Context, arg ListCampaignsParams) ([]*models.Campaign, error) {
+	rows, err := q.q.ListCampaigns(ctx, arg)
+	if err != nil {
+		return nil, err
+	}
+
+	campaigns := make([]*models.Campaign, 0, len(rows))
+	for _, row := range rows {
+		campaign := models.Campaign(*row)
+		campaigns = append(campaigns, &campaign)
+	}
+
+	return campaigns, nil
+}
+
+type ScheduleCampaignParams struct {
+	ID     int64     `db:"id" json:"id"`
+	SendAt time.Time `db:"send_at" json:"send_at"`
+}
+
+// ScheduleCampaign returns nil when the campaign does not exist or already started.
+func (q *Queries) ScheduleCampaign(ctx context.Context, arg ScheduleCampaignParams) (*models.Campaign, error) {
+	sendAt := arg.SendAt.UTC()
+	return campaignOrNil(q.q.ScheduleCampaign(ctx, sqlcdb.ScheduleCampaignParams{
+		ID:     arg.ID,
+		SendAt: &sendAt,
+	}))
+}
+
+// StartCampaign returns nil when the campaign is not scheduled anymore.
+func (q *Queries) StartCampaign(ctx context.Context, id int64) (*models.Campaign, error) {
+	return campaignOrNil(q.q.StartCampaign(ctx, id))
+}
+
+// CancelCampaign returns nil when the campaign does not exist or is already over.
+func (q *Queries) CancelCampaign(ctx context.Context, id int64) (*models.Campaign, error) {
+	return campaignOrNil(q.q.CancelCampaign(ctx, id))
+}
+
+func (q *Queries) FinishCampaign(ctx context.Context, id int64) error {
+	return q.q.FinishCampaign(ctx, id)
+}
+
+func campaignOrNil(row *sqlcdb.Campaign, err error) (*models.Campaign, error) {
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	campaign := models.Campaign(*row)
+	return &campaign, nil
+}
+
+// CountCampaignAudience counts the users of the audience among those whose last marketing consent
+// is granted, leaving out opted out and suppressed addresses.
+func (q *Queries) CountCampaignAudience(ctx context.Context, audience models.CampaignAudience) (int64, error) {
+	return q.q.CountCampaignAudience(ctx, sqlcdb.CountCampaignAudienceParams{
+		IncludeUnconfirmed: audience.IncludeUnconfirmed,
+		Organization:       audience.Organization,
+		Quality:            audience.Quality,
+		PhonePrefix:        strings.ReplaceAll(audience.PhonePrefix, " ", ""),
+		Locale:             audience.Locale.String(),
+	})
+}
+
+type CreateCampaignRecipientsParams struct {
+	CampaignID int64                   `db:"campaign_id" json:"campaign_id"`
+	Audience   models.CampaignAudience `db:"audience" json:"audience"`
+}
+
+// CreateCampaignRecipients snapshots the audience of the campaign, and returns its size.
+func (q *Queries) CreateCampaignRecipients(ctx context.Context, arg CreateCampaignRecipientsParams) (int64, error) {
+	return q.q.CreateCampaignRecipients(ctx, sqlcdb.CreateCampaignRecipientsParams{
+		CampaignID:         arg.CampaignID,
+		IncludeUnconfirmed: arg.Audience.IncludeUnconfirmed,
+		Organization:       arg.Audience.Organization,
+		Quality:            arg.Audience.Quality,
+		PhonePrefix:        strings.ReplaceAll(arg.Audience.PhonePrefix, " ", ""),
+		Locale:             arg.Audience.Locale.String(),
+	})
+}
+
+type GetPendingCampaignRecipientsForUpdateParams = sqlcdb.GetPendingCampaignRecipientsForUpdateParams
+
+func (q *Queries) GetPendingCampaignRecipientsForUpdate(ctx context.Context, arg GetPendingCampaignRecipientsForUpdateParams) ([]*models.CampaignRecipient, error) {
+	rows, err := q.q.GetPendingCampaignRecipientsForUpdate(ctx, arg)
+	if err != nil {
+		return nil, err
+	}
+
+	recipients := make([]*models.CampaignRecipient, 0, len(rows))
+	for _, row := range rows {
+		recipient := models.CampaignRecipient(*row)
+		recipients = append(recipients, &recipient)
+	}
+
+	return recipients, nil
+}
+
+func (q *Queries) MarkCampaignRecipientQueued(ctx context.Context, id int64) error {
+	return q.q.MarkCampaignRecipientQueued(ctx, id)
+}
+
+func (q *Queries) GetCampaignRecipient(ctx context.Context, id int64) (*models.CampaignRecipient, error) {
+	row, err := q.q.GetCampaignRecipient(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	recipient := models.CampaignRecipient(*row)
+	return &recipient, nil
+}
+
+// ClaimCampaignRecipient marks a queued or failed recipient as sending, and returns nil when the
+// recipient is in any other status, such as sending after an attempt whose outcome is unknown.
+func (q *Queries) ClaimCampaignRecipient(ctx context.Context, id int64) (*models.CampaignRecipient, error) {
+	row, err := q.q.ClaimCampaignRecipient(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	recipient := models.CampaignRecipient(*row)
+	return &recipient, nil
+}
+
+type ExpireCampaignRecipientClaimsParams = sqlcdb.ExpireCampaignRecipientClaimsParams
+
+// ExpireCampaignRecipientClaims fails the recipients of the campaign claimed before ClaimedBefore
+// and still sending, whose job stopped without recording the outcome, and returns how many.
+func (q *Queries) ExpireCampaignRecipientClaims(ctx context.Context, arg ExpireCampaignRecipientClaimsParams) (int64, error) {
+	return q.q.ExpireCampaignRecipientClaims(ctx, arg)
+}
+
+type FinishCampaignRecipientParams = sqlcdb.FinishCampaignRecipientParams
+
+func (q *Queries) FinishCampaignRecipient(ctx context.Context, arg FinishCampaignRecipientParams) error {
+	return q.q.FinishCampaignRecipient(ctx, arg)
+}
+
+// CountCampaignRecipients returns the number of recipients of the campaign by status.
+func (q *Queries) CountCampaignRecipients(ctx context.Context, campaignID int64) (map[models.CampaignRecipientStatus]int64, error) {
+	rows, err := q.q.CountCampaignRecipients(ctx, campaignID)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := map[models.CampaignRecipientStatus]int64{}
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+
+	return counts, nil
+}
+
+type CreateMarketingOptOutParams = sqlcdb.CreateMarketingOptOutParams
+
+func (q *Queries) CreateMarketingOptOut(ctx context.Context, arg CreateMarketingOptOutParams) error {
+	arg.Email = strings.ToLower(arg.Email)
+	return q.q.CreateMarketingOptOut(ctx, arg)
+}
+
+// GetMarketingOptOut returns nil when the email did not opt out.
+func (q *Queries) GetMarketingOptOut(ctx context.Context, email string) (*models.MarketingOptOut, error) {
+	row, err := q.q.GetMarketingOptOut(ctx, strings.ToLower(email))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	optOut := models.MarketingOptOut(*row)
+	return &optOut, nil
+}
+
+func (q *Queries) DeleteMarketingOptOut(ctx context.Context, email string) error {
+	return q.q.DeleteMarketingOptOut(ctx, strings.ToLower(email))
+}
@@ -4,9 +4,9 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"os"
 	"time"
 
+	"cyberix.fr/frcc/logging"
 	_ "github.com/lib/pq"
 	"go.uber.org/zap"
 )
@@ -19,6 +19,7 @@ type Database struct {
 	user                  string
 	password              string
 	name                  string
+	sslMode               string
 	maxOpenConnections    int
 	maxIdleConnections    int
 	connectionMaxLifetime time.Duration
@@ -32,6 +33,7 @@ type NewDatabaseOptions struct {
 	User                   string
 	Password               string
 	Name                   string
+	SSLMode                string
 	MaxOpenConnections     int
 	MaxIdleConnections     int
 	ConnectionMaxLifetime  time.Duration
@@ -50,6 +52,7 @@ func NewDatabase(opts NewDatabaseOptions) *Database {
 		user:               opts.User,
 		password:           opts.Password,
 		name:               opts.Name,
+		sslMode:            opts.SSLMode,
 		maxOpenConnections: opts.MaxOpenConnections,
 		maxIdleConnections: opts.MaxIdleConnections,
 		log:                opts.Log,
@@ -57,20 +60,27 @@ func NewDatabase(opts NewDatabaseOptions) *Database {
 }
 
 func (d *Database) dsn() string {
-	appEnv := os.Getenv("APP_ENV")
+	return d.dsnWithPassword(d.password)
+}
+
+func (d *Database) dsnWithPassword(password string) string {
 	ssl := ""
-	if appEnv == "" || appEnv == "local" || appEnv == "development" {
-		ssl = "sslmode=disable"
+	if d.sslMode != "" {
+		ssl = "sslmode=" + d.sslMode
 	}
 
 	return fmt.Sprintf(
 		"host=%s port=%d user=%s password=%s dbname=%s %s", // sslmode=disable",
-		d.host, d.port, d.user, d.password, d.name, ssl,
+		d.host, d.port, d.user, password, d.name, ssl,
 	)
 }
 
 func (d *Database) Connect() error {
-	d.log.Info("Connecting to database", zap.String("url", d.dsn()))
+	if d.db != nil {
+		return nil
+	}
+
+	d.log.Info("Connecting to database", zap.String("url", d.dsnWithPassword(logging.Secret(d.password).String())))
 
 	var err error
 	d.db, err = sql.Open("postgres", d.dsn())
@@ -96,6 +106,11 @@ func (d *Database) Connect() error {
 	return nil
 }
 
+// DB returns the underlying connection pool, nil until Connect has been called.
+func (d *Database) DB() *sql.DB {
+	return d.db
+}
+
 func (d *Database) Ping(ctx context.Context) error {
 	ctx, cancel := context.WithTimeout(ctx, time.Second)
 	defer cancel()
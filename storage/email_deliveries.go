@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"cyberix.fr/frcc/models"
+	sqlcdb "cyberix.fr/frcc/storage/sqlc/db"
+)
+
+type CreateEmailDeliveryParams = sqlcdb.CreateEmailDeliveryParams
+
+func (q *Queries) CreateEmailDelivery(ctx context.Context, arg CreateEmailDeliveryParams) error {
+	arg.Recipient = strings.ToLower(arg.Recipient)
+	return q.q.CreateEmailDelivery(ctx, arg)
+}
+
+type UpdateEmailDeliveryStatusParams = sqlcdb.UpdateEmailDeliveryStatusParams
+
+// UpdateEmailDeliveryStatus returns nil when no email was sent with the message ID.
+func (q *Queries) UpdateEmailDeliveryStatus(ctx context.Context, arg UpdateEmailDeliveryStatusParams) (*models.EmailDelivery, error) {
+	row, err := q.q.UpdateEmailDeliveryStatus(ctx, arg)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	delivery := models.EmailDelivery(*row)
+	return &delivery, nil
+}
+
+type ListEmailDeliveriesParams = sqlcdb.ListEmailDeliveriesParams
+
+func (q *Queries) ListEmailDeliveries(ctx context.Context, arg ListEmailDeliveriesParams) ([]*models.EmailDelivery, error) {
+	arg.Recipient = strings.ToLower(arg.Recipient)
+	rows, err := q.q.ListEmailDeliveries(ctx, arg)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]*models.EmailDelivery, 0, len(rows))
+	for _, row := range rows {
+		delivery := models.EmailDelivery(*row)
+		deliveries = append(deliveries, &delivery)
+	}
+
+	return deliveries, nil
+}
+
+type CreateEmailSuppressionParams = sqlcdb.CreateEmailSuppressionParams
+
+func (q *Queries) CreateEmailSuppression(ctx context.Context, arg CreateEmailSuppressionParams) error {
+	arg.Email = strings.ToLower(arg.Email)
+	return q.q.CreateEmailSuppression(ctx, arg)
+}
+
+// GetEmailSuppression returns nil when the email is not suppressed.
+func (q *Queries) GetEmailSuppression(ctx context.Context, email string) (*models.EmailSuppression, error) {
+	row, err := q.q.GetEmailSuppression(ctx, strings.ToLower(email))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	suppression := models.EmailSuppression(*row)
+	return &suppression, nil
+}
+
+type ListEmailSuppressionsParams = sqlcdb.ListEmailSuppressionsParams
+
+func (q *Queries) ListEmailSuppressions(ctx context.Context, arg ListEmailSuppressionsParams) ([]*models.EmailSuppression, error) {
+	rows, err := q.q.ListEmailSuppressions(ctx, arg)
+	if err != nil {
+		return nil, err
+	}
+
+	suppressions := make([]*models.EmailSuppression, 0, len(rows))
+	for _, row := range rows {
+		suppression := models.EmailSuppression(*row)
+		suppressions = append(suppressions, &suppression)
+	}
+
+	return suppressions, nil
+}
+
+func (q *Queries) DeleteEmailSuppression(ctx context.Context, email string) error {
+	return q.q.DeleteEmailSuppression(ctx, strings.ToLower(email))
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"cyberix.fr/frcc/models"
+	sqlcdb "cyberix.fr/frcc/storage/sqlc/db"
+)
+
+type CreateIdempotencyKeyParams struct {
+	Key         string        `db:"key" json:"key"`
+	Fingerprint string        `db:"fingerprint" json:"fingerprint"`
+	TTL         time.Duration `db:"ttl" json:"ttl"`
+}
+
+// CreateIdempotencyKey claims the key, replacing it when older than the TTL.
+// It returns nil when the key is already claimed by a live request.
+func (q *Queries) CreateIdempotencyKey(ctx context.Context, arg CreateIdempotencyKeyParams) (*models.IdempotencyKey, error) {
+	row, err := q.q.CreateIdempotencyKey(ctx, sqlcdb.CreateIdempotencyKeyParams{
+		Key:         arg.Key,
+		Fingerprint: arg.Fingerprint,
+		TtlSeconds:  int32(arg.TTL.Seconds()),
+	})
+	return idempotencyKeyOrNil(row, err)
+}
+
+func (q *Queries) GetIdempotencyKey(ctx context.Context, key string) (*models.IdempotencyKey, error) {
+	return idempotencyKeyOrNil(q.q.GetIdempotencyKey(ctx, key))
+}
+
+type SaveIdempotencyKeyResponseParams struct {
+	Key          string `db:"key" json:"key"`
+	StatusCode   int32  `db:"status_code" json:"status_code"`
+	ContentType  string `db:"content_type" json:"content_type"`
+	ResponseBody []byte `db:"response_body" json:"response_body"`
+}
+
+func (q *Queries) SaveIdempotencyKeyResponse(ctx context.Context, arg SaveIdempotencyKeyResponseParams) error {
+	return q.q.SaveIdempotencyKeyResponse(ctx, sqlcdb.SaveIdempotencyKeyResponseParams{
+		Key:          arg.Key,
+		StatusCode:   &arg.StatusCode,
+		ContentType:  &arg.ContentType,
+		ResponseBody: arg.ResponseBody,
+	})
+}
+
+func (q *Queries) DeleteIdempotencyKey(ctx context.Context, key string) error {
+	return q.q.DeleteIdempotencyKey(ctx, key)
+}
+
+func idempotencyKeyOrNil(row *sqlcdb.IdempotencyKey, err error) (*models.IdempotencyKey, error) {
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	key := models.IdempotencyKey(*row)
+	return &key, nil
+}
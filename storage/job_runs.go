@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"cyberix.fr/frcc/models"
+	sqlcdb "cyberix.fr/frcc/storage/sqlc/db"
+)
+
+type StartJobRunParams struct {
+	JobID       string         `db:"job_id" json:"job_id"`
+	Name        string         `db:"name" json:"name"`
+	Payload     models.Message `db:"payload" json:"payload"`
+	PayloadHash string         `db:"payload_hash" json:"payload_hash"`
+}
+
+// StartJobRun records an attempt of the job, returning nil when a run with the same job ID
+// already succeeded, the message being a duplicate delivery.
+func (q *Queries) StartJobRun(ctx context.Context, arg StartJobRunParams) (*models.JobRun, error) {
+	payloadAsBytes, err := json.Marshal(arg.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	row, err := q.q.StartJobRun(ctx, sqlcdb.StartJobRunParams{
+		JobID:       arg.JobID,
+		Name:        arg.Name,
+		Payload:     payloadAsBytes,
+		PayloadHash: arg.PayloadHash,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return jobRunFromRow(row)
+}
+
+type FinishJobRunParams struct {
+	JobID      string              `db:"job_id" json:"job_id"`
+	Status     models.JobRunStatus `db:"status" json:"status"`
+	DurationMs int64               `db:"duration_ms" json:"duration_ms"`
+	LastError  *string             `db:"last_error" json:"last_error"`
+}
+
+func (q *Queries) FinishJobRun(ctx context.Context, arg FinishJobRunParams) error {
+	return q.q.FinishJobRun(ctx, sqlcdb.FinishJobRunParams{
+		JobID:      arg.JobID,
+		Status:     arg.Status,
+		DurationMs: &arg.DurationMs,
+		LastError:  arg.LastError,
+	})
+}
+
+type ListJobRunsParams = sqlcdb.ListJobRunsParams
+
+func (q *Queries) ListJobRuns(ctx context.Context, arg ListJobRunsParams) ([]*models.JobRun, error) {
+	rows, err := q.q.ListJobRuns(ctx, arg)
+	if err != nil {
+		return nil, err
+	}
+
+	runs := make([]*models.JobRun, 0, len(rows))
+	for _, row := range rows {
+		run, err := jobRunFromRow(row)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+
+	return runs, nil
+}
+
+func (q *Queries) GetJobRun(ctx context.Context, id int64) (*models.JobRun, error) {
+	row, err := q.q.GetJobRun(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return jobRunFromRow(row)
+}
+
+func (q *Queries) RequeueJobRun(ctx context.Context, id int64) error {
+	return q.q.RequeueJobRun(ctx, id)
+}
+
+func jobRunFromRow(row *sqlcdb.JobRun) (*models.JobRun, error) {
+	run := models.JobRun{
+		ID:          row.ID,
+		JobID:       row.JobID,
+		Name:        row.Name,
+		PayloadHash: row.PayloadHash,
+		Status:      row.Status,
+		Attempts:    row.Attempts,
+		DurationMs:  row.DurationMs,
+		LastError:   row.LastError,
+		CreatedAt:   row.CreatedAt,
+		UpdatedAt:   row.UpdatedAt,
+		FinishedAt:  row.FinishedAt,
+	}
+
+	if err := json.Unmarshal(row.Payload, &run.Payload); err != nil {
+		return nil, err
+	}
+
+	return &run, nil
+}
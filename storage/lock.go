@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+)
+
+// AdvisoryLock is a Postgres session-level advisory lock.
+// It is held as long as its dedicated connection stays open.
+type AdvisoryLock struct {
+	conn *sql.Conn
+	key  int64
+}
+
+// TryAdvisoryLock takes the advisory lock identified by key without waiting.
+// It returns nil when another session already holds the lock.
+func (d *Database) TryAdvisoryLock(ctx context.Context, key int64) (*AdvisoryLock, error) {
+	conn, err := d.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, key).Scan(&locked); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	if !locked {
+		_ = conn.Close()
+		return nil, nil
+	}
+
+	return &AdvisoryLock{conn: conn, key: key}, nil
+}
+
+// Ping checks that the session holding the lock is still alive.
+func (l *AdvisoryLock) Ping(ctx context.Context) error {
+	return l.conn.PingContext(ctx)
+}
+
+func (l *AdvisoryLock) Release(ctx context.Context) error {
+	defer func() {
+		_ = l.conn.Close()
+	}()
+
+	_, err := l.conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, l.key)
+	return err
+}
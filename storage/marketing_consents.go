@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"cyberix.fr/frcc/models"
+	sqlcdb "cyberix.fr/frcc/storage/sqlc/db"
+)
+
+type CreateMarketingConsentParams = sqlcdb.CreateMarketingConsentParams
+
+func (q *Queries) CreateMarketingConsent(ctx context.Context, arg CreateMarketingConsentParams) (*models.MarketingConsent, error) {
+	row, err := q.q.CreateMarketingConsent(ctx, arg)
+	if err != nil {
+		return nil, err
+	}
+
+	consent := models.MarketingConsent(*row)
+	return &consent, nil
+}
+
+// GetMarketingConsent returns the consent in effect for the user, or nil when never asked.
+func (q *Queries) GetMarketingConsent(ctx context.Context, userID int32) (*models.MarketingConsent, error) {
+	row, err := q.q.GetMarketingConsent(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	consent := models.MarketingConsent(*row)
+	return &consent, nil
+}
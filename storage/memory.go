@@ -0,0 +1,1025 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cyberix.fr/frcc/models"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+var _ Storage = (*MemoryStorage)(nil)
+
+// MemoryStorage is a Storage kept in memory, enforcing the unique and foreign key constraints of
+// the database. It is meant for tests and the demo mode, data is lost on restart.
+type MemoryStorage struct {
+	mutex sync.Mutex
+	data  *memoryData
+	*memoryQueries
+	txFlows
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	s := &MemoryStorage{
+		data: &memoryData{
+			idempotencyKeys:   map[string]models.IdempotencyKey{},
+			emailSuppressions: map[string]models.EmailSuppression{},
+			marketingOptOuts:  map[string]models.MarketingOptOut{},
+			calendarSecrets:   map[int32]models.CalendarSecret{},
+		},
+	}
+	s.memoryQueries = &memoryQueries{storage: s}
+	s.txFlows = txFlows{storage: s}
+	return s
+}
+
+// ExecTx runs fn inside a transaction, committed only if fn returns no error.
+func (s *MemoryStorage) ExecTx(ctx context.Context, fn func(Querier) error) error {
+	return s.ExecTxWithOptions(ctx, DefaultTxOptions, fn)
+}
+
+// ExecTxWithOptions runs fn on a copy of the data, which replaces it if fn returns no error.
+// Transactions hold the lock of the storage until they end, so they are serializable whatever
+// the options, and are never retried. fn must only use the Querier it is given.
+func (s *MemoryStorage) ExecTxWithOptions(ctx context.Context, opts TxOptions, fn func(Querier) error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	tx := s.data.clone()
+	if err := fn(&memoryQueries{tx: tx}); err != nil {
+		return err
+	}
+
+	// the transaction is rolled back if ctx is done before it commits, as with the database
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if !opts.ReadOnly {
+		s.data = tx
+	}
+	return nil
+}
+
+// memoryData holds the tables. Rows are identified by their index in the slices plus one, as the
+// tables they are kept in never have rows deleted.
+type memoryData struct {
+	users              []models.User
+	outbox             []models.OutboxMessage
+	scheduledJobs      []models.ScheduledJob
+	jobRuns            []models.JobRun
+	idempotencyKeys    map[string]models.IdempotencyKey
+	emailDeliveries    []models.EmailDelivery
+	emailSuppressions  map[string]models.EmailSuppression
+	campaigns          []models.Campaign
+	campaignRecipients []models.CampaignRecipient
+	marketingOptOuts   map[string]models.MarketingOptOut
+	marketingConsents  []models.MarketingConsent
+	calendarSecrets    map[int32]models.CalendarSecret
+}
+
+// clone copies the tables. Rows are copied by value, and their pointer and map fields are never
+// modified in place, so they can be shared.
+func (d *memoryData) clone() *memoryData {
+	return &memoryData{
+		users:              slices.Clone(d.users),
+		outbox:             slices.Clone(d.outbox),
+		scheduledJobs:      slices.Clone(d.scheduledJobs),
+		jobRuns:            slices.Clone(d.jobRuns),
+		idempotencyKeys:    maps.Clone(d.idempotencyKeys),
+		emailDeliveries:    slices.Clone(d.emailDeliveries),
+		emailSuppressions:  maps.Clone(d.emailSuppressions),
+		campaigns:          slices.Clone(d.campaigns),
+		campaignRecipients: slices.Clone(d.campaignRecipients),
+		marketingOptOuts:   maps.Clone(d.marketingOptOuts),
+		marketingConsents:  slices.Clone(d.marketingConsents),
+		calendarSecrets:    maps.Clone(d.calendarSecrets),
+	}
+}
+
+// memoryQueries implements Querier on the data of the storage, holding its lock for every query,
+// or on the copy of the data of a transaction, whose lock is already held.
+type memoryQueries struct {
+	storage *MemoryStorage
+	tx      *memoryData
+}
+
+func (q *memoryQueries) lock() (*memoryData, func()) {
+	if q.tx != nil {
+		return q.tx, func() {}
+	}
+
+	q.storage.mutex.Lock()
+	return q.storage.data, q.storage.mutex.Unlock
+}
+
+// uniqueViolation returns the error of the database when an insert breaks a unique constraint.
+func uniqueViolation(constraint string) error {
+	return &pq.Error{
+		Severity:   "ERROR",
+		Code:       "23505",
+		Message:    fmt.Sprintf("duplicate key value violates unique constraint %q", constraint),
+		Constraint: constraint,
+	}
+}
+
+// foreignKeyViolation returns the error of the database when an insert references a missing row.
+func foreignKeyViolation(table, constraint string) error {
+	return &pq.Error{
+		Severity:   "ERROR",
+		Code:       "23503",
+		Message:    fmt.Sprintf("insert or update on table %q violates foreign key constraint %q", table, constraint),
+		Table:      table,
+		Constraint: constraint,
+	}
+}
+
+func memoryNow() time.Time {
+	return time.Now().UTC()
+}
+
+// page returns the rows of a LIMIT and OFFSET clause.
+func page[T any](rows []T, limit, offset int32) []T {
+	if offset < 0 || limit < 0 {
+		return []T{}
+	}
+
+	start := min(int(offset), len(rows))
+	end := min(start+int(limit), len(rows))
+	return rows[start:end]
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func (q *memoryQueries) CreateUser(ctx context.Context, arg CreateUserParams) (*models.User, error) {
+	d, unlock := q.lock()
+	defer unlock()
+
+	for _, u := range d.users {
+		if u.Email == arg.Email {
+			return nil, uniqueViolation("users_email_key")
+		}
+		if u.Phone == arg.Phone {
+			return nil, uniqueViolation("users_phone_key")
+		}
+	}
+
+	now := memoryNow()
+	user := models.User{
+		ID:                     int32(len(d.users) + 1),
+		FirstName:              arg.FirstName,
+		LastName:               arg.LastName,
+		Email:                  arg.Email,
+		Quality:                arg.Quality,
+		Phone:                  arg.Phone,
+		Organization:           arg.Organization,
+		CreatedAt:              now,
+		UpdatedAt:              now,
+		ConfirmationToken:      arg.ConfirmationToken,
+		CurrentOtpValidityTime: ptr(now.Add(2 * time.Minute)),
+		Locale:                 arg.Locale,
+	}
+	d.users = append(d.users, user)
+
+	return &user, nil
+}
+
+func (q *memoryQueries) ConfirmRegister(ctx context.Context, confirmationToken string) (*models.User, error) {
+	d, unlock := q.lock()
+	defer unlock()
+
+	for i := range d.users {
+		if d.users[i].ConfirmationToken == confirmationToken {
+			d.users[i].ConfirmedAccount = true
+			user := d.users[i]
+			return &user, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (q *memoryQueries) GetUserByEmailOrPhone(ctx context.Context, arg GetUserByEmailOrPhoneParams) (*models.User, error) {
+	d, unlock := q.lock()
+	defer unlock()
+
+	for _, u := range d.users {
+		if u.Email == arg.Email || u.Phone == arg.Phone {
+			return &u, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (q *memoryQueries) GetConfirmedUsers(ctx context.Context) ([]*models.User, error) {
+	d, unlock := q.lock()
+	defer unlock()
+
+	users := []*models.User{}
+	for _, u := range d.users {
+		if u.ConfirmedAccount {
+			users = append(users, &u)
+		}
+	}
+
+	return users, nil
+}
+
+func (q *memoryQueries) SetCurrentOtp(ctx context.Context, arg SetCurrentOtpParams) error {
+	d, unlock := q.lock()
+	defer unlock()
+
+	for i := range d.users {
+		if d.users[i].Email == arg.Email {
+			d.users[i].CurrentOtp = ptr(arg.CurrentOtp)
+			d.users[i].CurrentOtpValidityTime = ptr(arg.CurrentOtpValidityTime)
+		}
+	}
+
+	return nil
+}
+
+func (q *memoryQueries) CreateOutboxMessage(ctx context.Context, payload models.Message) (*models.OutboxMessage, error) {
+	d, unlock := q.lock()
+	defer unlock()
+
+	message := models.OutboxMessage{
+		ID:        int64(len(d.outbox) + 1),
+		DedupID:   uuid.NewString(),
+		Payload:   tracedPayload(ctx, payload),
+		CreatedAt: memoryNow(),
+	}
+	d.outbox = append(d.outbox, message)
+
+	return &message, nil
+}
+
+func (q *memoryQueries) GetUnpublishedOutboxMessagesForUpdate(ctx context.Context, limit int32) ([]*models.OutboxMessage, error) {
+	d, unlock := q.lock()
+	defer unlock()
+
+	messages := []*models.OutboxMessage{}
+	for _, m := range d.outbox {
+		if len(messages) >= int(limit) {
+			break
+		}
+		if m.PublishedAt == nil {
+			messages = append(messages, &m)
+		}
+	}
+
+	return messages, nil
+}
+
+func (q *memoryQueries) MarkOutboxMessagePublished(ctx context.Context, id int64) error {
+	d, unlock := q.lock()
+	defer unlock()
+
+	if id < 1 || id > int64(len(d.outbox)) {
+		return nil
+	}
+
+	m := &d.outbox[id-1]
+	m.Attempts++
+	m.LastError = nil
+	m.PublishedAt = ptr(memoryNow())
+	return nil
+}
+
+func (q *memoryQueries) MarkOutboxMessageFailed(ctx context.Context, arg MarkOutboxMessageFailedParams) error {
+	d, unlock := q.lock()
+	defer unlock()
+
+	if arg.ID < 1 || arg.ID > int64(len(d.outbox)) {
+		return nil
+	}
+
+	m := &d.outbox[arg.ID-1]
+	m.Attempts++
+	m.LastError = ptr(arg.LastError)
+	return nil
+}
+
+func (q *memoryQueries) CreateScheduledJob(ctx context.Context, arg CreateScheduledJobParams) error {
+	d, unlock := q.lock()
+	defer unlock()
+
+	if arg.Key != nil {
+		for _, job := range d.scheduledJobs {
+			if job.Key != nil && *job.Key == *arg.Key {
+				return nil
+			}
+		}
+	}
+
+	d.scheduledJobs = append(d.scheduledJobs, models.ScheduledJob{
+		ID:        int64(len(d.scheduledJobs) + 1),
+		Key:       arg.Key,
+		Payload:   maps.Clone(arg.Payload),
+		RunAt:     arg.RunAt,
+		CreatedAt: memoryNow(),
+	})
+	return nil
+}
+
+func (q *memoryQueries) GetDueScheduledJobsForUpdate(ctx context.Context, limit int32) ([]*models.ScheduledJob, error) {
+	d, unlock := q.lock()
+	defer unlock()
+
+	now := memoryNow()
+	due := []*models.ScheduledJob{}
+	for _, job := range d.scheduledJobs {
+		if job.EnqueuedAt == nil && !job.RunAt.After(now) {
+			due = append(due, &job)
+		}
+	}
+
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].RunAt.Before(due[j].RunAt)
+	})
+
+	return page(due, limit, 0), nil
+}
+
+func (q *memoryQueries) MarkScheduledJobEnqueued(ctx context.Context, id int64) error {
+	d, unlock := q.lock()
+	defer unlock()
+
+	if id >= 1 && id <= int64(len(d.scheduledJobs)) {
+		d.scheduledJobs[id-1].EnqueuedAt = ptr(memoryNow())
+	}
+	return nil
+}
+
+func (q *memoryQueries) StartJobRun(ctx context.Context, arg StartJobRunParams) (*models.JobRun, error) {
+	d, unlock := q.lock()
+	defer unlock()
+
+	now := memoryNow()
+	for i := range d.jobRuns {
+		if d.jobRuns[i].JobID == arg.JobID {
+			run := &d.jobRuns[i]
+			if run.Status == models.JobRunStatusSucceeded {
+				return nil, nil
+			}
+			run.Attempts++
+			run.Status = models.JobRunStatusRunning
+			run.UpdatedAt = now
+
+			started := *run
+			return &started, nil
+		}
+	}
+
+	run := models.JobRun{
+		ID:          int64(len(d.jobRuns) + 1),
+		JobID:       arg.JobID,
+		Name:        arg.Name,
+		Payload:     maps.Clone(arg.Payload),
+		PayloadHash: arg.PayloadHash,
+		Status:      models.JobRunStatusRunning,
+		Attempts:    1,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	d.jobRuns = append(d.jobRuns, run)
+
+	return &run, nil
+}
+
+func (q *memoryQueries) FinishJobRun(ctx context.Context, arg FinishJobRunParams) error {
+	d, unlock := q.lock()
+	defer unlock()
+
+	now := memoryNow()
+	for i := range d.jobRuns {
+		if d.jobRuns[i].JobID == arg.JobID {
+			run := &d.jobRuns[i]
+			run.Status = arg.Status
+			run.DurationMs = ptr(arg.DurationMs)
+			run.LastError = arg.LastError
+			run.UpdatedAt = now
+			run.FinishedAt = ptr(now)
+		}
+	}
+
+	return nil
+}
+
+func (q *memoryQueries) ListJobRuns(ctx context.Context, arg ListJobRunsParams) ([]*models.JobRun, error) {
+	d, unlock := q.lock()
+	defer unlock()
+
+	runs := []*models.JobRun{}
+	for i := len(d.jobRuns) - 1; i >= 0; i-- {
+		run := d.jobRuns[i]
+		if (arg.Status == "" || run.Status == arg.Status) && (arg.Name == "" || run.Name == arg.Name) {
+			runs = append(runs, &run)
+		}
+	}
+
+	return page(runs, arg.Limit, arg.Offset), nil
+}
+
+func (q *memoryQueries) GetJobRun(ctx context.Context, id int64) (*models.JobRun, error) {
+	d, unlock := q.lock()
+	defer unlock()
+
+	if id < 1 || id > int64(len(d.jobRuns)) {
+		return nil, nil
+	}
+
+	run := d.jobRuns[id-1]
+	return &run, nil
+}
+
+func (q *memoryQueries) RequeueJobRun(ctx context.Context, id int64) error {
+	d, unlock := q.lock()
+	defer unlock()
+
+	if id >= 1 && id <= int64(len(d.jobRuns)) {
+		run := &d.jobRuns[id-1]
+		run.Status = models.JobRunStatusQueued
+		run.Attempts = 0
+		run.UpdatedAt = memoryNow()
+	}
+	return nil
+}
+
+func (q *memoryQueries) CreateIdempotencyKey(ctx context.Context, arg CreateIdempotencyKeyParams) (*models.IdempotencyKey, error) {
+	d, unlock := q.lock()
+	defer unlock()
+
+	now := memoryNow()
+	if existing, ok := d.idempotencyKeys[arg.Key]; ok && !existing.CreatedAt.Before(now.Add(-arg.TTL)) {
+		return nil, nil
+	}
+
+	key := models.IdempotencyKey{
+		Key:         arg.Key,
+		Fingerprint: arg.Fingerprint,
+		CreatedAt:   now,
+	}
+	d.idempotencyKeys[arg.Key] = key
+
+	return &key, nil
+}
+
+func (q *memoryQueries) GetIdempotencyKey(ctx context.Context, key string) (*models.IdempotencyKey, error) {
+	d, unlock := q.lock()
+	defer unlock()
+
+	if k, ok := d.idempotencyKeys[key]; ok {
+		return &k, nil
+	}
+	return nil, nil
+}
+
+func (q *memoryQueries) SaveIdempotencyKeyResponse(ctx context.Context, arg SaveIdempotencyKeyResponseParams) error {
+	d, unlock := q.lock()
+	defer unlock()
+
+	if k, ok := d.idempotencyKeys[arg.Key]; ok {
+		k.StatusCode = ptr(arg.StatusCode)
+		k.ContentType = ptr(arg.ContentType)
+		k.ResponseBody = slices.Clone(arg.ResponseBody)
+		d.idempotencyKeys[arg.Key] = k
+	}
+	return nil
+}
+
+func (q *memoryQueries) DeleteIdempotencyKey(ctx context.Context, key string) error {
+	d, unlock := q.lock()
+	defer unlock()
+
+	delete(d.idempotencyKeys, key)
+	return nil
+}
+
+func (q *memoryQueries) CreateEmailDelivery(ctx context.Context, arg CreateEmailDeliveryParams) error {
+	d, unlock := q.lock()
+	defer unlock()
+
+	for _, delivery := range d.emailDeliveries {
+		if delivery.MessageID == arg.MessageID {
+			return nil
+		}
+	}
+
+	now := memoryNow()
+	d.emailDeliveries = append(d.emailDeliveries, models.EmailDelivery{
+		ID:        int64(len(d.emailDeliveries) + 1),
+		MessageID: arg.MessageID,
+		Provider:  arg.Provider,
+		Recipient: strings.ToLower(arg.Recipient),
+		Tag:       arg.Tag,
+		Status:    arg.Status,
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	return nil
+}
+
+func (q *memoryQueries) UpdateEmailDeliveryStatus(ctx context.Context, arg UpdateEmailDeliveryStatusParams) (*models.EmailDelivery, error) {
+	d, unlock := q.lock()
+	defer unlock()
+
+	for i := range d.emailDeliveries {
+		if d.emailDeliveries[i].MessageID == arg.MessageID {
+			delivery := &d.emailDeliveries[i]
+			delivery.Status = arg.Status
+			delivery.Detail = arg.Detail
+			delivery.UpdatedAt = memoryNow()
+
+			updated := *delivery
+			return &updated, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (q *memoryQueries) ListEmailDeliveries(ctx context.Context, arg ListEmailDeliveriesParams) ([]*models.EmailDelivery, error) {
+	d, unlock := q.lock()
+	defer unlock()
+
+	recipient := strings.ToLower(arg.Recipient)
+	deliveries := []*models.EmailDelivery{}
+	for i := len(d.emailDeliveries) - 1; i >= 0; i-- {
+		delivery := d.emailDeliveries[i]
+		if (recipient == "" || delivery.Recipient == recipient) && (arg.Status == "" || delivery.Status == arg.Status) {
+			deliveries = append(deliveries, &delivery)
+		}
+	}
+
+	return page(deliveries, arg.Limit, arg.Offset), nil
+}
+
+func (q *memoryQueries) CreateEmailSuppression(ctx context.Context, arg CreateEmailSuppressionParams) error {
+	d, unlock := q.lock()
+	defer unlock()
+
+	email := strings.ToLower(arg.Email)
+	if _, ok := d.emailSuppressions[email]; ok {
+		return nil
+	}
+
+	d.emailSuppressions[email] = models.EmailSuppression{
+		Email:     email,
+		Reason:    arg.Reason,
+		Detail:    arg.Detail,
+		CreatedAt: memoryNow(),
+	}
+	return nil
+}
+
+func (q *memoryQueries) GetEmailSuppression(ctx context.Context, email string) (*models.EmailSuppression, error) {
+	d, unlock := q.lock()
+	defer unlock()
+
+	if suppression, ok := d.emailSuppressions[strings.ToLower(email)]; ok {
+		return &suppression, nil
+	}
+	return nil, nil
+}
+
+func (q *memoryQueries) ListEmailSuppressions(ctx context.Context, arg ListEmailSuppressionsParams) ([]*models.EmailSuppression, error) {
+	d, unlock := q.lock()
+	defer unlock()
+
+	suppressions := []*models.EmailSuppression{}
+	for _, suppression := range d.emailSuppressions {
+		suppressions = append(suppressions, &suppression)
+	}
+
+	sort.Slice(suppressions, func(i, j int) bool {
+		return suppressions[i].CreatedAt.After(suppressions[j].CreatedAt)
+	})
+
+	return page(suppressions, arg.Limit, arg.Offset), nil
+}
+
+func (q *memoryQueries) DeleteEmailSuppression(ctx context.Context, email string) error {
+	d, unlock := q.lock()
+	defer unlock()
+
+	delete(d.emailSuppressions, strings.ToLower(email))
+	return nil
+}
+
+func (q *memoryQueries) CreateCampaign(ctx context.Context, arg CreateCampaignParams) (*models.Campaign, error) {
+	d, unlock := q.lock()
+	defer unlock()
+
+	now := memoryNow()
+	campaign := models.Campaign{
+		ID:        int64(len(d.campaigns) + 1),
+		Name:      arg.Name,
+		Template:  arg.Template,
+		Subject:   arg.Subject,
+		Body:      arg.Body,
+		Audience:  arg.Audience,
+		Status:    models.CampaignStatusDraft,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	d.campaigns = append(d.campaigns, campaign)
+
+	return &campaign, nil
+}
+
+func (q *memoryQueries) GetCampaign(ctx context.Context, id int64) (*models.Campaign, error) {
+	d, unlock := q.lock()
+	defer unlock()
+
+	if id < 1 || id > int64(len(d.campaigns)) {
+		return nil, nil
+	}
+
+	campaign := d.campaigns[id-1]
+	return &campaign, nil
+}
+
+func (q *memoryQueries) ListCampaigns(ctx context.Context, arg ListCampaignsParams) ([]*models.Campaign, error) {
+	d, unlock := q.lock()
+	defer unlock()
+
+	campaigns := []*models.Campaign{}
+	for i := len(d.campaigns) - 1; i >= 0; i-- {
+		campaign := d.campaigns[i]
+		campaigns = append(campaigns, &campaign)
+	}
+
+	return page(campaigns, arg.Limit, arg.Offset), nil
+}
+
+// updateCampaign applies update to the campaign if its status is one of from, returning nil otherwise.
+func (d *memoryData) updateCampaign(id int64, from []models.CampaignStatus, update func(*models.Campaign)) *models.Campaign {
+	if id < 1 || id > int64(len(d.campaigns)) {
+		return nil
+	}
+
+	campaign := &d.campaigns[id-1]
+	if !slices.Contains(from, campaign.Status) {
+		return nil
+	}
+
+	update(campaign)
+	campaign.UpdatedAt = memoryNow()
+
+	updated := *campaign
+	return &updated
+}
+
+func (q *memoryQueries) ScheduleCampaign(ctx context.Context, arg ScheduleCampaignParams) (*models.Campaign, error) {
+	d, unlock := q.lock()
+	defer unlock()
+
+	from := []models.CampaignStatus{models.CampaignStatusDraft, models.CampaignStatusScheduled}
+	return d.updateCampaign(arg.ID, from, func(c *models.Campaign) {
+		c.Status = models.CampaignStatusScheduled
+		c.SendAt = ptr(arg.SendAt.UTC())
+	}), nil
+}
+
+func (q *memoryQueries) StartCampaign(ctx context.Context, id int64) (*models.Campaign, error) {
+	d, unlock := q.lock()
+	defer unlock()
+
+	from := []models.CampaignStatus{models.CampaignStatusScheduled}
+	return d.updateCampaign(id, from, func(c *models.Campaign) {
+		c.Status = models.CampaignStatusSending
+	}), nil
+}
+
+func (q *memoryQueries) CancelCampaign(ctx context.Context, id int64) (*models.Campaign, error) {
+	d, unlock := q.lock()
+	defer unlock()
+
+	from := []models.CampaignStatus{models.CampaignStatusDraft, models.CampaignStatusScheduled, models.CampaignStatusSending}
+	return d.updateCampaign(id, from, func(c *models.Campaign) {
+		c.Status = models.CampaignStatusCancelled
+	}), nil
+}
+
+func (q *memoryQueries) FinishCampaign(ctx context.Context, id int64) error {
+	d, unlock := q.lock()
+	defer unlock()
+
+	from := []models.CampaignStatus{models.CampaignStatusSending}
+	d.updateCampaign(id, from, func(c *models.Campaign) {
+		c.Status = models.CampaignStatusSent
+	})
+	return nil
+}
+
+// audience returns the users of the audience among those whose last marketing consent is granted,
+// leaving out opted out and suppressed addresses.
+func (d *memoryData) audience(audience models.CampaignAudience) []models.User {
+	containsFold := func(s, substr string) bool {
+		return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+	}
+
+	granted := map[int32]bool{}
+	for _, consent := range d.marketingConsents {
+		granted[consent.UserID] = consent.Granted
+	}
+
+	phonePrefix := strings.ReplaceAll(audience.PhonePrefix, " ", "")
+
+	var users []models.User
+	for _, u := range d.users {
+		email := strings.ToLower(u.Email)
+		_, optedOut := d.marketingOptOuts[email]
+		_, suppressed := d.emailSuppressions[email]
+
+		if (audience.IncludeUnconfirmed || u.ConfirmedAccount) &&
+			(audience.Organization == "" || containsFold(u.Organization, audience.Organization)) &&
+			(audience.Quality == "" || containsFold(u.Quality, audience.Quality)) &&
+			strings.HasPrefix(u.Phone, phonePrefix) &&
+			(audience.Locale == "" || u.Locale == audience.Locale) &&
+			granted[u.ID] && !optedOut && !suppressed {
+			users = append(users, u)
+		}
+	}
+
+	return users
+}
+
+func (q *memoryQueries) CountCampaignAudience(ctx context.Context, audience models.CampaignAudience) (int64, error) {
+	d, unlock := q.lock()
+	defer unlock()
+
+	return int64(len(d.audience(audience))), nil
+}
+
+func (q *memoryQueries) CreateCampaignRecipients(ctx context.Context, arg CreateCampaignRecipientsParams) (int64, error) {
+	d, unlock := q.lock()
+	defer unlock()
+
+	if arg.CampaignID < 1 || arg.CampaignID > int64(len(d.campaigns)) {
+		return 0, foreignKeyViolation("campaign_recipients", "campaign_recipients_campaign_id_fkey")
+	}
+
+	existing := map[int32]bool{}
+	for _, r := range d.campaignRecipients {
+		if r.CampaignID == arg.CampaignID {
+			existing[r.UserID] = true
+		}
+	}
+
+	created := int64(0)
+	for _, u := range d.audience(arg.Audience) {
+		if existing[u.ID] {
+			continue
+		}
+
+		d.campaignRecipients = append(d.campaignRecipients, models.CampaignRecipient{
+			ID:         int64(len(d.campaignRecipients) + 1),
+			CampaignID: arg.CampaignID,
+			UserID:     u.ID,
+			Email:      u.Email,
+			Name:       u.FirstName + " " + u.LastName,
+			Locale:     u.Locale,
+			Status:     models.CampaignRecipientStatusPending,
+			CreatedAt:  memoryNow(),
+		})
+		created++
+	}
+
+	return created, nil
+}
+
+func (q *memoryQueries) GetPendingCampaignRecipientsForUpdate(ctx context.Context, arg GetPendingCampaignRecipientsForUpdateParams) ([]*models.CampaignRecipient, error) {
+	d, unlock := q.lock()
+	defer unlock()
+
+	recipients := []*models.CampaignRecipient{}
+	for _, r := range d.campaignRecipients {
+		if len(recipients) >= int(arg.Limit) {
+			break
+		}
+		if r.CampaignID == arg.CampaignID && r.Status == models.CampaignRecipientStatusPending {
+			recipients = append(recipients, &r)
+		}
+	}
+
+	return recipients, nil
+}
+
+func (q *memoryQueries) MarkCampaignRecipientQueued(ctx context.Context, id int64) error {
+	d, unlock := q.lock()
+	defer unlock()
+
+	if id >= 1 && id <= int64(len(d.campaignRecipients)) {
+		d.campaignRecipients[id-1].Status = models.CampaignRecipientStatusQueued
+	}
+	return nil
+}
+
+func (q *memoryQueries) GetCampaignRecipient(ctx context.Context, id int64) (*models.CampaignRecipient, error) {
+	d, unlock := q.lock()
+	defer unlock()
+
+	if id < 1 || id > int64(len(d.campaignRecipients)) {
+		return nil, nil
+	}
+
+	recipient := d.campaignRecipients[id-1]
+	return &recipient, nil
+}
+
+func (q *memoryQueries) ClaimCampaignRecipient(ctx context.Context, id int64) (*models.CampaignRecipient, error) {
+	d, unlock := q.lock()
+	defer unlock()
+
+	if id < 1 || id > int64(len(d.campaignRecipients)) {
+		return nil, nil
+	}
+
+	r := &d.campaignRecipients[id-1]
+	if r.Status != models.CampaignRecipientStatusQueued && r.Status != models.CampaignRecipientStatusFailed {
+		return nil, nil
+	}
+	r.Status = models.CampaignRecipientStatusSending
+	r.ClaimedAt = ptr(memoryNow())
+
+	recipient := *r
+	return &recipient, nil
+}
+
+func (q *memoryQueries) ExpireCampaignRecipientClaims(ctx context.Context, arg ExpireCampaignRecipientClaimsParams) (int64, error) {
+	d, unlock := q.lock()
+	defer unlock()
+
+	var expired int64
+	for i := range d.campaignRecipients {
+		r := &d.campaignRecipients[i]
+		if r.CampaignID == arg.CampaignID && r.Status == models.CampaignRecipientStatusSending && r.ClaimedAt != nil && r.ClaimedAt.Before(arg.ClaimedBefore) {
+			r.Status = models.CampaignRecipientStatusFailed
+			r.LastError = ptr("sending was interrupted, the email may or may not have been sent")
+			expired++
+		}
+	}
+	return expired, nil
+}
+
+func (q *memoryQueries) FinishCampaignRecipient(ctx context.Context, arg FinishCampaignRecipientParams) error {
+	d, unlock := q.lock()
+	defer unlock()
+
+	if arg.ID < 1 || arg.ID > int64(len(d.campaignRecipients)) {
+		return nil
+	}
+
+	r := &d.campaignRecipients[arg.ID-1]
+	r.Status = arg.Status
+	r.LastError = arg.LastError
+	if arg.Status == models.CampaignRecipientStatusSent {
+		r.SentAt = ptr(memoryNow())
+	}
+	return nil
+}
+
+func (q *memoryQueries) CountCampaignRecipients(ctx context.Context, campaignID int64) (map[models.CampaignRecipientStatus]int64, error) {
+	d, unlock := q.lock()
+	defer unlock()
+
+	counts := map[models.CampaignRecipientStatus]int64{}
+	for _, r := range d.campaignRecipients {
+		if r.CampaignID == campaignID {
+			counts[r.Status]++
+		}
+	}
+
+	return counts, nil
+}
+
+func (q *memoryQueries) CreateMarketingOptOut(ctx context.Context, arg CreateMarketingOptOutParams) error {
+	d, unlock := q.lock()
+	defer unlock()
+
+	email := strings.ToLower(arg.Email)
+	if _, ok := d.marketingOptOuts[email]; ok {
+		return nil
+	}
+
+	// the campaign is kept as a reference, the database setting it to null when deleted
+	if arg.CampaignID != nil && (*arg.CampaignID < 1 || *arg.CampaignID > int64(len(d.campaigns))) {
+		return foreignKeyViolation("marketing_opt_outs", "marketing_opt_outs_campaign_id_fkey")
+	}
+
+	d.marketingOptOuts[email] = models.MarketingOptOut{
+		Email:      email,
+		CampaignID: arg.CampaignID,
+		CreatedAt:  memoryNow(),
+	}
+	return nil
+}
+
+func (q *memoryQueries) GetMarketingOptOut(ctx context.Context, email string) (*models.MarketingOptOut, error) {
+	d, unlock := q.lock()
+	defer unlock()
+
+	if optOut, ok := d.marketingOptOuts[strings.ToLower(email)]; ok {
+		return &optOut, nil
+	}
+	return nil, nil
+}
+
+func (q *memoryQueries) DeleteMarketingOptOut(ctx context.Context, email string) error {
+	d, unlock := q.lock()
+	defer unlock()
+
+	delete(d.marketingOptOuts, strings.ToLower(email))
+	return nil
+}
+
+func (q *memoryQueries) CreateMarketingConsent(ctx context.Context, arg CreateMarketingConsentParams) (*models.MarketingConsent, error) {
+	d, unlock := q.lock()
+	defer unlock()
+
+	if arg.UserID < 1 || arg.UserID > int32(len(d.users)) {
+		return nil, foreignKeyViolation("marketing_consents", "marketing_consents_user_id_fkey")
+	}
+
+	consent := models.MarketingConsent{
+		ID:          int64(len(d.marketingConsents) + 1),
+		UserID:      arg.UserID,
+		Granted:     arg.Granted,
+		Source:      arg.Source,
+		TextVersion: arg.TextVersion,
+		CreatedAt:   memoryNow(),
+	}
+	d.marketingConsents = append(d.marketingConsents, consent)
+
+	return &consent, nil
+}
+
+func (q *memoryQueries) GetMarketingConsent(ctx context.Context, userID int32) (*models.MarketingConsent, error) {
+	d, unlock := q.lock()
+	defer unlock()
+
+	for i := len(d.marketingConsents) - 1; i >= 0; i-- {
+		if d.marketingConsents[i].UserID == userID {
+			consent := d.marketingConsents[i]
+			return &consent, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (q *memoryQueries) CreateCalendarSecret(ctx context.Context, arg CreateCalendarSecretParams) error {
+	d, unlock := q.lock()
+	defer unlock()
+
+	if _, ok := d.calendarSecrets[arg.UserID]; ok {
+		return nil
+	}
+
+	d.calendarSecrets[arg.UserID] = models.CalendarSecret{
+		UserID:    arg.UserID,
+		Secret:    arg.Secret,
+		CreatedAt: memoryNow(),
+	}
+	return nil
+}
+
+func (q *memoryQueries) GetCalendarSecret(ctx context.Context, userID int32) (*models.CalendarSecret, error) {
+	d, unlock := q.lock()
+	defer unlock()
+
+	secret, ok := d.calendarSecrets[userID]
+	if !ok {
+		return nil, nil
+	}
+	return &secret, nil
+}
+
+func (q *memoryQueries) RotateCalendarSecret(ctx context.Context, arg RotateCalendarSecretParams) (*models.CalendarSecret, error) {
+	d, unlock := q.lock()
+	defer unlock()
+
+	secret := models.CalendarSecret{
+		UserID:    arg.UserID,
+		Secret:    arg.Secret,
+		CreatedAt: memoryNow(),
+	}
+	d.calendarSecrets[arg.UserID] = secret
+	return &secret, nil
+}
@@ -0,0 +1,294 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// migrationLockKey identifies the Postgres advisory lock held while migrating, so that two
+// instances starting together do not apply the same migration twice.
+const migrationLockKey int64 = 0x6d696772
+
+// createSchemaMigrationsTable creates the table of the migrate tool the migrations used to be
+// applied with, so that databases migrated by hand carry on from their version.
+const createSchemaMigrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+  version BIGINT NOT NULL PRIMARY KEY,
+  dirty BOOLEAN NOT NULL
+)
+`
+
+type Migration struct {
+	Version int64
+	Name    string
+	up      string
+	down    string
+}
+
+// Migrations returns the migrations embedded in the binary, ordered by version.
+func Migrations() ([]Migration, error) {
+	files, err := fs.Glob(migrationsFS, "migrations/*.sql")
+	if err != nil {
+		return nil, fmt.Errorf("error listing migrations: %w", err)
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, file := range files {
+		// files are named {version}_{name}.{up|down}.sql
+		base := path.Base(file)
+		versionAsString, rest, ok := strings.Cut(base, "_")
+		name, direction, ok2 := strings.Cut(strings.TrimSuffix(rest, ".sql"), ".")
+		if !ok || !ok2 {
+			return nil, fmt.Errorf("error parsing migration file name %v", base)
+		}
+
+		version, err := strconv.ParseInt(versionAsString, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing migration version of %v: %w", base, err)
+		}
+
+		content, err := migrationsFS.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading migration %v: %w", base, err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+
+		switch direction {
+		case "up":
+			m.up = string(content)
+		case "down":
+			m.down = string(content)
+		default:
+			return nil, fmt.Errorf("error parsing migration direction of %v", base)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" {
+			return nil, fmt.Errorf("error migration %v has no up file", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// LatestMigrationVersion returns the schema version the code expects.
+func LatestMigrationVersion() (int64, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+
+	if len(migrations) == 0 {
+		return 0, nil
+	}
+	return migrations[len(migrations)-1].Version, nil
+}
+
+// SchemaVersion returns the version the database was migrated to, 0 when it never was, and
+// whether a migration failed halfway, in which case the schema must be repaired by hand.
+func (d *Database) SchemaVersion(ctx context.Context) (int64, bool, error) {
+	return schemaVersion(ctx, d.db)
+}
+
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func schemaVersion(ctx context.Context, db queryRower) (int64, bool, error) {
+	var exists bool
+	err := db.QueryRowContext(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists)
+	if err != nil {
+		return 0, false, fmt.Errorf("error checking migrations table: %w", err)
+	}
+
+	if !exists {
+		return 0, false, nil
+	}
+
+	var (
+		version int64
+		dirty   bool
+	)
+	err = db.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("error getting schema version: %w", err)
+	}
+
+	return version, dirty, nil
+}
+
+// CheckSchemaVersion returns an error unless the database is migrated to the latest version.
+func (d *Database) CheckSchemaVersion(ctx context.Context) error {
+	latest, err := LatestMigrationVersion()
+	if err != nil {
+		return err
+	}
+
+	version, dirty, err := d.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	if dirty {
+		return fmt.Errorf("error schema version %v is dirty, a migration failed and must be repaired", version)
+	}
+
+	if version != latest {
+		return fmt.Errorf("error schema version is %v but the code expects %v", version, latest)
+	}
+
+	return nil
+}
+
+// MigrateUp applies the pending migrations and returns them.
+func (d *Database) MigrateUp(ctx context.Context) ([]Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	err = d.migrate(ctx, func(conn *sql.Conn, version int64) error {
+		for _, m := range migrations {
+			if m.Version <= version {
+				continue
+			}
+
+			if err := applyMigration(ctx, conn, m.up, m.Version); err != nil {
+				return fmt.Errorf("error applying migration %v_%v: %w", m.Version, m.Name, err)
+			}
+			d.log.Info("Applied migration", zap.Int64("version", m.Version), zap.String("name", m.Name))
+			applied = append(applied, m)
+		}
+		return nil
+	})
+
+	return applied, err
+}
+
+// MigrateDown reverts the last steps applied migrations and returns them.
+func (d *Database) MigrateDown(ctx context.Context, steps int) ([]Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var reverted []Migration
+	err = d.migrate(ctx, func(conn *sql.Conn, version int64) error {
+		for i := len(migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			m := migrations[i]
+			if m.Version > version {
+				continue
+			}
+
+			if m.down == "" {
+				return fmt.Errorf("error migration %v_%v has no down file", m.Version, m.Name)
+			}
+
+			previous := int64(0)
+			if i > 0 {
+				previous = migrations[i-1].Version
+			}
+
+			if err := applyMigration(ctx, conn, m.down, previous); err != nil {
+				return fmt.Errorf("error reverting migration %v_%v: %w", m.Version, m.Name, err)
+			}
+			d.log.Info("Reverted migration", zap.Int64("version", m.Version), zap.String("name", m.Name))
+			reverted = append(reverted, m)
+		}
+		return nil
+	})
+
+	return reverted, err
+}
+
+// migrate runs fn with the current schema version, on a connection holding the migration lock.
+func (d *Database) migrate(ctx context.Context, fn func(conn *sql.Conn, version int64) error) error {
+	conn, err := d.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting connection: %w", err)
+	}
+
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockKey); err != nil {
+		return fmt.Errorf("error taking migration lock: %w", err)
+	}
+
+	defer func() {
+		_, _ = conn.ExecContext(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, migrationLockKey)
+	}()
+
+	if _, err := conn.ExecContext(ctx, createSchemaMigrationsTable); err != nil {
+		return fmt.Errorf("error creating migrations table: %w", err)
+	}
+
+	version, dirty, err := schemaVersion(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	if dirty {
+		return fmt.Errorf("error schema version %v is dirty, a migration failed and must be repaired", version)
+	}
+
+	return fn(conn, version)
+}
+
+// applyMigration runs a migration and records the version it leads to in a single transaction,
+// so that a failed migration leaves the schema as it was.
+func applyMigration(ctx context.Context, conn *sql.Conn, query string, version int64) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if _, err := tx.ExecContext(ctx, query); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations`); err != nil {
+		return err
+	}
+
+	if version > 0 {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, dirty) VALUES ($1, false)`, version); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS queue_messages (
+  id BIGINT Primary Key Generated Always as Identity,
+  queue TEXT NOT NULL,
+  body TEXT NOT NULL,
+  dedup_id TEXT,
+  receive_count INTEGER NOT NULL DEFAULT 0,
+  visible_at TIMESTAMP NOT NULL DEFAULT NOW(),
+
+  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS queue_messages_queue_visible_at_idx ON queue_messages (queue, visible_at);
+CREATE UNIQUE INDEX IF NOT EXISTS queue_messages_queue_dedup_id_idx ON queue_messages (queue, dedup_id);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS outbox (
+  id BIGINT Primary Key Generated Always as Identity,
+  dedup_id UUID UNIQUE NOT NULL DEFAULT gen_random_uuid(),
+  payload JSONB NOT NULL,
+  attempts INTEGER NOT NULL DEFAULT 0,
+  last_error TEXT,
+
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  published_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS outbox_unpublished_idx ON outbox (id) WHERE published_at IS NULL;
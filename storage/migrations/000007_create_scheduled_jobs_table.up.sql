@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS scheduled_jobs (
+  id BIGINT Primary Key Generated Always as Identity,
+  key TEXT UNIQUE,
+  payload JSONB NOT NULL,
+  run_at TIMESTAMP NOT NULL,
+
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  enqueued_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS scheduled_jobs_due_idx ON scheduled_jobs (run_at) WHERE enqueued_at IS NULL;
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS job_runs (
+  id BIGINT Primary Key Generated Always as Identity,
+  job_id TEXT UNIQUE NOT NULL,
+  name TEXT NOT NULL,
+  payload JSONB NOT NULL,
+  payload_hash TEXT NOT NULL,
+  status TEXT NOT NULL,
+  attempts INTEGER NOT NULL DEFAULT 0,
+  duration_ms BIGINT,
+  last_error TEXT,
+
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  finished_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS job_runs_status_name_idx ON job_runs (status, name);
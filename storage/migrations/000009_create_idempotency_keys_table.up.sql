@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+  key TEXT Primary Key,
+  fingerprint TEXT NOT NULL,
+  status_code INTEGER,
+  content_type TEXT,
+  response_body BYTEA,
+
+  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
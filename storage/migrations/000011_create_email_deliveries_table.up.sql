@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS email_deliveries (
+  id BIGINT Primary Key Generated Always as Identity,
+  message_id TEXT UNIQUE NOT NULL,
+  provider TEXT NOT NULL,
+  recipient TEXT NOT NULL,
+  tag TEXT NOT NULL DEFAULT '',
+  status TEXT NOT NULL,
+  detail TEXT NOT NULL DEFAULT '',
+
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS email_deliveries_recipient_idx ON email_deliveries (recipient);
+
+-- emails are stored lowercased
+CREATE TABLE IF NOT EXISTS email_suppressions (
+  email TEXT Primary Key,
+  reason TEXT NOT NULL,
+  detail TEXT NOT NULL DEFAULT '',
+
+  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
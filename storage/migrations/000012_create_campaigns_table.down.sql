@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS marketing_opt_outs;
+DROP TABLE IF EXISTS campaign_recipients;
+DROP TABLE IF EXISTS campaigns;
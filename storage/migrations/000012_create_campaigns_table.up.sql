@@ -0,0 +1,39 @@
+CREATE TABLE IF NOT EXISTS campaigns (
+  id BIGINT Primary Key Generated Always as Identity,
+  name TEXT NOT NULL,
+  template TEXT NOT NULL,
+  subject TEXT NOT NULL,
+  body TEXT NOT NULL,
+  audience JSONB NOT NULL DEFAULT '{}',
+  status TEXT NOT NULL DEFAULT 'draft',
+  send_at TIMESTAMP,
+
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS campaign_recipients (
+  id BIGINT Primary Key Generated Always as Identity,
+  campaign_id BIGINT NOT NULL REFERENCES campaigns (id) ON DELETE CASCADE,
+  user_id INTEGER NOT NULL,
+  email TEXT NOT NULL,
+  name TEXT NOT NULL,
+  locale TEXT NOT NULL,
+  status TEXT NOT NULL DEFAULT 'pending',
+  last_error TEXT,
+
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  sent_at TIMESTAMP,
+
+  UNIQUE (campaign_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS campaign_recipients_status_idx ON campaign_recipients (campaign_id, status);
+
+-- emails are stored lowercased
+CREATE TABLE IF NOT EXISTS marketing_opt_outs (
+  email TEXT Primary Key,
+  campaign_id BIGINT REFERENCES campaigns (id) ON DELETE SET NULL,
+
+  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,12 @@
+-- every consent decision is kept as proof, the last one of a user being in effect
+CREATE TABLE IF NOT EXISTS marketing_consents (
+  id BIGINT Primary Key Generated Always as Identity,
+  user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  granted BOOLEAN NOT NULL,
+  source TEXT NOT NULL,
+  text_version TEXT NOT NULL DEFAULT '',
+
+  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS marketing_consents_user_id_idx ON marketing_consents (user_id, id DESC);
@@ -0,0 +1,2 @@
+ALTER TABLE users
+ALTER COLUMN confirmed_account DROP NOT NULL;
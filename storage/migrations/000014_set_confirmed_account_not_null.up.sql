@@ -0,0 +1,6 @@
+UPDATE users
+SET confirmed_account = FALSE
+WHERE confirmed_account IS NULL;
+
+ALTER TABLE users
+ALTER COLUMN confirmed_account SET NOT NULL;
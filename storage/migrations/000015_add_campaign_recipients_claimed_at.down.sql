@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS campaign_recipients_claimed_at_idx;
+
+ALTER TABLE campaign_recipients
+DROP COLUMN IF EXISTS claimed_at;
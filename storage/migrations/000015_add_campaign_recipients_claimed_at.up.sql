@@ -0,0 +1,5 @@
+-- the time a campaign_email job claimed the recipient, after which an unfinished claim expires
+ALTER TABLE campaign_recipients
+ADD COLUMN IF NOT EXISTS claimed_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS campaign_recipients_claimed_at_idx ON campaign_recipients (campaign_id, claimed_at) WHERE status = 'sending';
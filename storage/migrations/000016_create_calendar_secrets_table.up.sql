@@ -0,0 +1,7 @@
+-- the secret signed into the calendar feed url of a user, replaced to revoke the url
+CREATE TABLE IF NOT EXISTS calendar_secrets (
+  user_id INTEGER Primary Key REFERENCES users (id) ON DELETE CASCADE,
+  secret TEXT NOT NULL,
+
+  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+
+	"cyberix.fr/frcc/models"
+	sqlcdb "cyberix.fr/frcc/storage/sqlc/db"
+	"cyberix.fr/frcc/tracing"
+)
+
+// CreateOutboxMessage stores the payload with the trace context of ctx, so that the job
+// traces back to the request which created it.
+func (q *Queries) CreateOutboxMessage(ctx context.Context, payload models.Message) (*models.OutboxMessage, error) {
+	payloadAsBytes, err := json.Marshal(tracedPayload(ctx, payload))
+	if err != nil {
+		return nil, err
+	}
+
+	row, err := q.q.CreateOutboxMessage(ctx, payloadAsBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return outboxMessageFromRow(row)
+}
+
+// tracedPayload returns a copy of payload with the trace context of ctx.
+func tracedPayload(ctx context.Context, payload models.Message) models.Message {
+	traced := make(models.Message, len(payload)+len(tracing.Keys))
+	for k, v := range payload {
+		traced[k] = v
+	}
+	tracing.Inject(ctx, traced)
+	return traced
+}
+
+func (q *Queries) GetUnpublishedOutboxMessagesForUpdate(ctx context.Context, limit int32) ([]*models.OutboxMessage, error) {
+	rows, err := q.q.GetUnpublishedOutboxMessagesForUpdate(ctx, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]*models.OutboxMessage, 0, len(rows))
+	for _, row := range rows {
+		message, err := outboxMessageFromRow(row)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+
+	return messages, nil
+}
+
+func (q *Queries) MarkOutboxMessagePublished(ctx context.Context, id int64) error {
+	return q.q.MarkOutboxMessagePublished(ctx, id)
+}
+
+type MarkOutboxMessageFailedParams struct {
+	ID        int64  `db:"id" json:"id"`
+	LastError string `db:"last_error" json:"last_error"`
+}
+
+func (q *Queries) MarkOutboxMessageFailed(ctx context.Context, arg MarkOutboxMessageFailedParams) error {
+	return q.q.MarkOutboxMessageFailed(ctx, sqlcdb.MarkOutboxMessageFailedParams{
+		ID:        arg.ID,
+		LastError: &arg.LastError,
+	})
+}
+
+func outboxMessageFromRow(row *sqlcdb.Outbox) (*models.OutboxMessage, error) {
+	message := models.OutboxMessage{
+		ID:          row.ID,
+		DedupID:     row.DedupID,
+		Attempts:    row.Attempts,
+		LastError:   row.LastError,
+		CreatedAt:   row.CreatedAt,
+		PublishedAt: row.PublishedAt,
+	}
+
+	if err := json.Unmarshal(row.Payload, &message.Payload); err != nil {
+		return nil, err
+	}
+
+	return &message, nil
+}
@@ -10,10 +10,77 @@ type Querier interface {
 	CreateUser(ctx context.Context, arg CreateUserParams) (*models.User, error)
 	ConfirmRegister(ctx context.Context, confirmationToken string) (*models.User, error)
 	GetUserByEmailOrPhone(ctx context.Context, arg GetUserByEmailOrPhoneParams) (*models.User, error)
+	GetConfirmedUsers(ctx context.Context) ([]*models.User, error)
 	SetCurrentOtp(ctx context.Context, arg SetCurrentOtpParams) error
+
+	CreateOutboxMessage(ctx context.Context, payload models.Message) (*models.OutboxMessage, error)
+	GetUnpublishedOutboxMessagesForUpdate(ctx context.Context, limit int32) ([]*models.OutboxMessage, error)
+	MarkOutboxMessagePublished(ctx context.Context, id int64) error
+	MarkOutboxMessageFailed(ctx context.Context, arg MarkOutboxMessageFailedParams) error
+
+	CreateScheduledJob(ctx context.Context, arg CreateScheduledJobParams) error
+	GetDueScheduledJobsForUpdate(ctx context.Context, limit int32) ([]*models.ScheduledJob, error)
+	MarkScheduledJobEnqueued(ctx context.Context, id int64) error
+
+	StartJobRun(ctx context.Context, arg StartJobRunParams) (*models.JobRun, error)
+	FinishJobRun(ctx context.Context, arg FinishJobRunParams) error
+	ListJobRuns(ctx context.Context, arg ListJobRunsParams) ([]*models.JobRun, error)
+	GetJobRun(ctx context.Context, id int64) (*models.JobRun, error)
+	RequeueJobRun(ctx context.Context, id int64) error
+
+	CreateIdempotencyKey(ctx context.Context, arg CreateIdempotencyKeyParams) (*models.IdempotencyKey, error)
+	GetIdempotencyKey(ctx context.Context, key string) (*models.IdempotencyKey, error)
+	SaveIdempotencyKeyResponse(ctx context.Context, arg SaveIdempotencyKeyResponseParams) error
+	DeleteIdempotencyKey(ctx context.Context, key string) error
+
+	CreateEmailDelivery(ctx context.Context, arg CreateEmailDeliveryParams) error
+	UpdateEmailDeliveryStatus(ctx context.Context, arg UpdateEmailDeliveryStatusParams) (*models.EmailDelivery, error)
+	ListEmailDeliveries(ctx context.Context, arg ListEmailDeliveriesParams) ([]*models.EmailDelivery, error)
+	CreateEmailSuppression(ctx context.Context, arg CreateEmailSuppressionParams) error
+	GetEmailSuppression(ctx context.Context, email string) (*models.EmailSuppression, error)
+	ListEmailSuppressions(ctx context.Context, arg ListEmailSuppressionsParams) ([]*models.EmailSuppression, error)
+	DeleteEmailSuppression(ctx context.Context, email string) error
+
+	CreateCampaign(ctx context.Context, arg CreateCampaignParams) (*models.Campaign, error)
+	GetCampaign(ctx context.Context, id int64) (*models.Campaign, error)
+	ListCampaigns(ctx context.Context, arg ListCampaignsParams) ([]*models.Campaign, error)
+	ScheduleCampaign(ctx context.Context, arg ScheduleCampaignParams) (*models.Campaign, error)
+	StartCampaign(ctx context.Context, id int64) (*models.Campaign, error)
+	CancelCampaign(ctx context.Context, id int64) (*models.Campaign, error)
+	FinishCampaign(ctx context.Context, id int64) error
+	CountCampaignAudience(ctx context.Context, audience models.CampaignAudience) (int64, error)
+	CreateCampaignRecipients(ctx context.Context, arg CreateCampaignRecipientsParams) (int64, error)
+	GetPendingCampaignRecipientsForUpdate(ctx context.Context, arg GetPendingCampaignRecipientsForUpdateParams) ([]*models.CampaignRecipient, error)
+	MarkCampaignRecipientQueued(ctx context.Context, id int64) error
+	GetCampaignRecipient(ctx context.Context, id int64) (*models.CampaignRecipient, error)
+	ClaimCampaignRecipient(ctx context.Context, id int64) (*models.CampaignRecipient, error)
+	ExpireCampaignRecipientClaims(ctx context.Context, arg ExpireCampaignRecipientClaimsParams) (int64, error)
+	FinishCampaignRecipient(ctx context.Context, arg FinishCampaignRecipientParams) error
+	CountCampaignRecipients(ctx context.Context, campaignID int64) (map[models.CampaignRecipientStatus]int64, error)
+	CreateMarketingOptOut(ctx context.Context, arg CreateMarketingOptOutParams) error
+	GetMarketingOptOut(ctx context.Context, email string) (*models.MarketingOptOut, error)
+	DeleteMarketingOptOut(ctx context.Context, email string) error
+
+	CreateMarketingConsent(ctx context.Context, arg CreateMarketingConsentParams) (*models.MarketingConsent, error)
+	GetMarketingConsent(ctx context.Context, userID int32) (*models.MarketingConsent, error)
+
+	CreateCalendarSecret(ctx context.Context, arg CreateCalendarSecretParams) error
+	GetCalendarSecret(ctx context.Context, userID int32) (*models.CalendarSecret, error)
+	RotateCalendarSecret(ctx context.Context, arg RotateCalendarSecretParams) (*models.CalendarSecret, error)
 }
 
 type QuerierTx interface {
+	ExecTx(ctx context.Context, fn func(Querier) error) error
+	ExecTxWithOptions(ctx context.Context, opts TxOptions, fn func(Querier) error) error
+	SetCurrentOtpTx(ctx context.Context, arg SetCurrentOtpTxParams) error
+	ConfirmRegisterTx(ctx context.Context, arg ConfirmRegisterTxParams) (*models.User, error)
+	PublishOutboxTx(ctx context.Context, limit int32, publish func(*models.OutboxMessage) error) (int, error)
+	EnqueueDueScheduledJobsTx(ctx context.Context, limit int32) (int, error)
+	ScheduleCampaignTx(ctx context.Context, arg ScheduleCampaignTxParams) (*models.Campaign, error)
+	StartCampaignTx(ctx context.Context, id int64) (*models.Campaign, int64, error)
+	QueueCampaignBatchTx(ctx context.Context, arg QueueCampaignBatchTxParams) (int, error)
+	UpdateMarketingConsentTx(ctx context.Context, arg UpdateMarketingConsentTxParams) (*models.MarketingConsent, error)
 }
 
 var _ Querier = (*Queries)(nil)
+var _ QuerierTx = (*SQLStorage)(nil)
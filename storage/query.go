@@ -1,27 +1,26 @@
 package storage
 
 import (
-	"context"
 	"database/sql"
+
+	sqlcdb "cyberix.fr/frcc/storage/sqlc/db"
 )
 
-type DBTX interface {
-	ExecContext(context.Context, string, ...interface{}) (sql.Result, error)
-	PrepareContext(context.Context, string) (*sql.Stmt, error)
-	QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error)
-	QueryRowContext(context.Context, string, ...interface{}) *sql.Row
-}
+//go:generate go run github.com/sqlc-dev/sqlc/cmd/sqlc@v1.26.0 generate -f ../sqlc.yaml
+
+type DBTX = sqlcdb.DBTX
 
 func NewQueries(db DBTX) *Queries {
-	return &Queries{db: db}
+	return &Queries{q: sqlcdb.New(tracedDB{db: db})}
 }
 
+// Queries runs the queries generated by sqlc from storage/sqlc, and maps their rows to models.
 type Queries struct {
-	db DBTX
+	q *sqlcdb.Queries
 }
 
 func (q *Queries) WithTx(tx *sql.Tx) *Queries {
 	return &Queries{
-		db: tx,
+		q: sqlcdb.New(tracedDB{db: tx}),
 	}
 }
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"cyberix.fr/frcc/models"
+	sqlcdb "cyberix.fr/frcc/storage/sqlc/db"
+)
+
+// CreateScheduledJobParams describes a job to enqueue at RunAt (UTC).
+// A job with the Key of an already scheduled job is ignored.
+type CreateScheduledJobParams struct {
+	Key     *string        `db:"key" json:"key"`
+	Payload models.Message `db:"payload" json:"payload"`
+	RunAt   time.Time      `db:"run_at" json:"run_at"`
+}
+
+func (q *Queries) CreateScheduledJob(ctx context.Context, arg CreateScheduledJobParams) error {
+	payloadAsBytes, err := json.Marshal(arg.Payload)
+	if err != nil {
+		return err
+	}
+
+	return q.q.CreateScheduledJob(ctx, sqlcdb.CreateScheduledJobParams{
+		Key:     arg.Key,
+		Payload: payloadAsBytes,
+		RunAt:   arg.RunAt,
+	})
+}
+
+func (q *Queries) GetDueScheduledJobsForUpdate(ctx context.Context, limit int32) ([]*models.ScheduledJob, error) {
+	rows, err := q.q.GetDueScheduledJobsForUpdate(ctx, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]*models.ScheduledJob, 0, len(rows))
+	for _, row := range rows {
+		job := models.ScheduledJob{
+			ID:         row.ID,
+			Key:        row.Key,
+			RunAt:      row.RunAt,
+			CreatedAt:  row.CreatedAt,
+			EnqueuedAt: row.EnqueuedAt,
+		}
+		if err := json.Unmarshal(row.Payload, &job.Payload); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, &job)
+	}
+
+	return jobs, nil
+}
+
+func (q *Queries) MarkScheduledJobEnqueued(ctx context.Context, id int64) error {
+	return q.q.MarkScheduledJobEnqueued(ctx, id)
+}
@@ -0,0 +1,18 @@
+-- name: CreateCalendarSecret :exec
+INSERT INTO calendar_secrets(user_id, secret)
+VALUES ($1, $2)
+ON CONFLICT (user_id) DO NOTHING;
+
+-- name: GetCalendarSecret :one
+SELECT *
+FROM calendar_secrets
+WHERE user_id = $1;
+
+-- name: RotateCalendarSecret :one
+INSERT INTO calendar_secrets(user_id, secret)
+VALUES ($1, $2)
+ON CONFLICT (user_id) DO UPDATE
+SET
+  secret = EXCLUDED.secret,
+  created_at = NOW()
+RETURNING *;
@@ -0,0 +1,145 @@
+-- name: CreateCampaign :one
+INSERT INTO campaigns(name, template, subject, body, audience)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING *;
+
+-- name: GetCampaign :one
+SELECT *
+FROM campaigns
+WHERE id = $1;
+
+-- name: ListCampaigns :many
+SELECT *
+FROM campaigns
+ORDER BY id DESC
+LIMIT $1
+OFFSET $2;
+
+-- name: ScheduleCampaign :one
+UPDATE campaigns
+SET
+  status = 'scheduled',
+  send_at = $2,
+  updated_at = NOW()
+WHERE
+  id = $1 AND status IN ('draft', 'scheduled')
+RETURNING *;
+
+-- name: StartCampaign :one
+UPDATE campaigns
+SET
+  status = 'sending',
+  updated_at = NOW()
+WHERE
+  id = $1 AND status = 'scheduled'
+RETURNING *;
+
+-- name: CancelCampaign :one
+UPDATE campaigns
+SET
+  status = 'cancelled',
+  updated_at = NOW()
+WHERE
+  id = $1 AND status IN ('draft', 'scheduled', 'sending')
+RETURNING *;
+
+-- name: FinishCampaign :exec
+UPDATE campaigns
+SET
+  status = 'sent',
+  updated_at = NOW()
+WHERE
+  id = $1 AND status = 'sending';
+
+-- name: CountCampaignAudience :one
+SELECT COUNT(*)
+FROM users u
+WHERE
+  (sqlc.arg(include_unconfirmed)::bool OR u.confirmed_account)
+  AND (sqlc.arg(organization)::text = '' OR u.organization ILIKE '%' || sqlc.arg(organization) || '%')
+  AND (sqlc.arg(quality)::text = '' OR u.quality ILIKE '%' || sqlc.arg(quality) || '%')
+  AND (sqlc.arg(phone_prefix)::text = '' OR u.phone LIKE sqlc.arg(phone_prefix) || '%')
+  AND (sqlc.arg(locale)::text = '' OR u.locale = sqlc.arg(locale))
+  AND (SELECT c.granted FROM marketing_consents c WHERE c.user_id = u.id ORDER BY c.id DESC LIMIT 1) IS TRUE
+  AND NOT EXISTS (SELECT 1 FROM marketing_opt_outs o WHERE o.email = LOWER(u.email))
+  AND NOT EXISTS (SELECT 1 FROM email_suppressions s WHERE s.email = LOWER(u.email));
+
+-- name: CreateCampaignRecipients :execrows
+INSERT INTO campaign_recipients(campaign_id, user_id, email, name, locale)
+SELECT sqlc.arg(campaign_id)::bigint, u.id, u.email, u.first_name || ' ' || u.last_name, u.locale
+FROM users u
+WHERE
+  (sqlc.arg(include_unconfirmed)::bool OR u.confirmed_account)
+  AND (sqlc.arg(organization)::text = '' OR u.organization ILIKE '%' || sqlc.arg(organization) || '%')
+  AND (sqlc.arg(quality)::text = '' OR u.quality ILIKE '%' || sqlc.arg(quality) || '%')
+  AND (sqlc.arg(phone_prefix)::text = '' OR u.phone LIKE sqlc.arg(phone_prefix) || '%')
+  AND (sqlc.arg(locale)::text = '' OR u.locale = sqlc.arg(locale))
+  AND (SELECT c.granted FROM marketing_consents c WHERE c.user_id = u.id ORDER BY c.id DESC LIMIT 1) IS TRUE
+  AND NOT EXISTS (SELECT 1 FROM marketing_opt_outs o WHERE o.email = LOWER(u.email))
+  AND NOT EXISTS (SELECT 1 FROM email_suppressions s WHERE s.email = LOWER(u.email))
+ON CONFLICT (campaign_id, user_id) DO NOTHING;
+
+-- name: GetPendingCampaignRecipientsForUpdate :many
+SELECT *
+FROM campaign_recipients
+WHERE campaign_id = $1 AND status = 'pending'
+ORDER BY id
+LIMIT $2
+FOR UPDATE SKIP LOCKED;
+
+-- name: MarkCampaignRecipientQueued :exec
+UPDATE campaign_recipients
+SET status = 'queued'
+WHERE id = $1;
+
+-- name: GetCampaignRecipient :one
+SELECT *
+FROM campaign_recipients
+WHERE id = $1;
+
+-- name: ClaimCampaignRecipient :one
+UPDATE campaign_recipients
+SET
+  status = 'sending',
+  claimed_at = NOW()
+WHERE id = $1 AND status IN ('queued', 'failed')
+RETURNING *;
+
+-- name: ExpireCampaignRecipientClaims :execrows
+UPDATE campaign_recipients
+SET
+  status = 'failed',
+  last_error = 'sending was interrupted, the email may or may not have been sent'
+WHERE
+  campaign_id = $1
+  AND status = 'sending'
+  AND claimed_at < sqlc.arg(claimed_before);
+
+-- name: FinishCampaignRecipient :exec
+UPDATE campaign_recipients
+SET
+  status = $2,
+  last_error = $3,
+  sent_at = CASE WHEN $2 = 'sent' THEN NOW() ELSE sent_at END
+WHERE
+  id = $1;
+
+-- name: CountCampaignRecipients :many
+SELECT status, COUNT(*)
+FROM campaign_recipients
+WHERE campaign_id = $1
+GROUP BY status;
+
+-- name: CreateMarketingOptOut :exec
+INSERT INTO marketing_opt_outs(email, campaign_id)
+VALUES ($1, $2)
+ON CONFLICT (email) DO NOTHING;
+
+-- name: GetMarketingOptOut :one
+SELECT *
+FROM marketing_opt_outs
+WHERE email = $1;
+
+-- name: DeleteMarketingOptOut :exec
+DELETE FROM marketing_opt_outs
+WHERE email = $1;
@@ -5,21 +5,145 @@
 package db
 
 import (
-	"database/sql"
+	"encoding/json"
+	"time"
+
+	"cyberix.fr/frcc/models"
 )
 
+type CalendarSecret struct {
+	UserID    int32     `db:"user_id" json:"user_id"`
+	Secret    string    `db:"secret" json:"secret"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+type Campaign struct {
+	ID        int64                   `db:"id" json:"id"`
+	Name      string                  `db:"name" json:"name"`
+	Template  string                  `db:"template" json:"template"`
+	Subject   string                  `db:"subject" json:"subject"`
+	Body      string                  `db:"body" json:"body"`
+	Audience  models.CampaignAudience `db:"audience" json:"audience"`
+	Status    string                  `db:"status" json:"status"`
+	SendAt    *time.Time              `db:"send_at" json:"send_at"`
+	CreatedAt time.Time               `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time               `db:"updated_at" json:"updated_at"`
+}
+
+type CampaignRecipient struct {
+	ID         int64         `db:"id" json:"id"`
+	CampaignID int64         `db:"campaign_id" json:"campaign_id"`
+	UserID     int32         `db:"user_id" json:"user_id"`
+	Email      string        `db:"email" json:"email"`
+	Name       string        `db:"name" json:"name"`
+	Locale     models.Locale `db:"locale" json:"locale"`
+	Status     string        `db:"status" json:"status"`
+	LastError  *string       `db:"last_error" json:"last_error"`
+	CreatedAt  time.Time     `db:"created_at" json:"created_at"`
+	SentAt     *time.Time    `db:"sent_at" json:"sent_at"`
+	ClaimedAt  *time.Time    `db:"claimed_at" json:"claimed_at"`
+}
+
+type EmailDelivery struct {
+	ID        int64     `db:"id" json:"id"`
+	MessageID string    `db:"message_id" json:"message_id"`
+	Provider  string    `db:"provider" json:"provider"`
+	Recipient string    `db:"recipient" json:"recipient"`
+	Tag       string    `db:"tag" json:"tag"`
+	Status    string    `db:"status" json:"status"`
+	Detail    string    `db:"detail" json:"detail"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+type EmailSuppression struct {
+	Email     string    `db:"email" json:"email"`
+	Reason    string    `db:"reason" json:"reason"`
+	Detail    string    `db:"detail" json:"detail"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+type IdempotencyKey struct {
+	Key          string    `db:"key" json:"key"`
+	Fingerprint  string    `db:"fingerprint" json:"fingerprint"`
+	StatusCode   *int32    `db:"status_code" json:"status_code"`
+	ContentType  *string   `db:"content_type" json:"content_type"`
+	ResponseBody []byte    `db:"response_body" json:"response_body"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+}
+
+type JobRun struct {
+	ID          int64           `db:"id" json:"id"`
+	JobID       string          `db:"job_id" json:"job_id"`
+	Name        string          `db:"name" json:"name"`
+	Payload     json.RawMessage `db:"payload" json:"payload"`
+	PayloadHash string          `db:"payload_hash" json:"payload_hash"`
+	Status      string          `db:"status" json:"status"`
+	Attempts    int32           `db:"attempts" json:"attempts"`
+	DurationMs  *int64          `db:"duration_ms" json:"duration_ms"`
+	LastError   *string         `db:"last_error" json:"last_error"`
+	CreatedAt   time.Time       `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time       `db:"updated_at" json:"updated_at"`
+	FinishedAt  *time.Time      `db:"finished_at" json:"finished_at"`
+}
+
+type MarketingConsent struct {
+	ID          int64     `db:"id" json:"id"`
+	UserID      int32     `db:"user_id" json:"user_id"`
+	Granted     bool      `db:"granted" json:"granted"`
+	Source      string    `db:"source" json:"source"`
+	TextVersion string    `db:"text_version" json:"text_version"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+}
+
+type MarketingOptOut struct {
+	Email      string    `db:"email" json:"email"`
+	CampaignID *int64    `db:"campaign_id" json:"campaign_id"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+}
+
+type Outbox struct {
+	ID          int64           `db:"id" json:"id"`
+	DedupID     string          `db:"dedup_id" json:"dedup_id"`
+	Payload     json.RawMessage `db:"payload" json:"payload"`
+	Attempts    int32           `db:"attempts" json:"attempts"`
+	LastError   *string         `db:"last_error" json:"last_error"`
+	CreatedAt   time.Time       `db:"created_at" json:"created_at"`
+	PublishedAt *time.Time      `db:"published_at" json:"published_at"`
+}
+
+type QueueMessage struct {
+	ID           int64     `db:"id" json:"id"`
+	Queue        string    `db:"queue" json:"queue"`
+	Body         string    `db:"body" json:"body"`
+	ReceiveCount int32     `db:"receive_count" json:"receive_count"`
+	VisibleAt    time.Time `db:"visible_at" json:"visible_at"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+	DedupID      *string   `db:"dedup_id" json:"dedup_id"`
+}
+
+type ScheduledJob struct {
+	ID         int64           `db:"id" json:"id"`
+	Key        *string         `db:"key" json:"key"`
+	Payload    json.RawMessage `db:"payload" json:"payload"`
+	RunAt      time.Time       `db:"run_at" json:"run_at"`
+	CreatedAt  time.Time       `db:"created_at" json:"created_at"`
+	EnqueuedAt *time.Time      `db:"enqueued_at" json:"enqueued_at"`
+}
+
 type User struct {
-	ID                     int32          `db:"id" json:"id"`
-	FirstName              string         `db:"first_name" json:"first_name"`
-	LastName               string         `db:"last_name" json:"last_name"`
-	Email                  string         `db:"email" json:"email"`
-	Quality                string         `db:"quality" json:"quality"`
-	Phone                  string         `db:"phone" json:"phone"`
-	Organization           string         `db:"organization" json:"organization"`
-	CreatedAt              interface{}    `db:"created_at" json:"created_at"`
-	UpdatedAt              interface{}    `db:"updated_at" json:"updated_at"`
-	ConfirmationToken      string         `db:"confirmation_token" json:"confirmation_token"`
-	CurrentOtp             sql.NullString `db:"current_otp" json:"current_otp"`
-	CurrentOtpValidityTime interface{}    `db:"current_otp_validity_time" json:"current_otp_validity_time"`
-	ConfirmedAccount       sql.NullBool   `db:"confirmed_account" json:"confirmed_account"`
+	ID                     int32         `db:"id" json:"id"`
+	FirstName              string        `db:"first_name" json:"first_name"`
+	LastName               string        `db:"last_name" json:"last_name"`
+	Email                  string        `db:"email" json:"email"`
+	Quality                string        `db:"quality" json:"quality"`
+	Phone                  string        `db:"phone" json:"phone"`
+	Organization           string        `db:"organization" json:"organization"`
+	CreatedAt              time.Time     `db:"created_at" json:"created_at"`
+	UpdatedAt              time.Time     `db:"updated_at" json:"updated_at"`
+	ConfirmationToken      string        `db:"confirmation_token" json:"confirmation_token"`
+	CurrentOtp             *string       `db:"current_otp" json:"current_otp"`
+	CurrentOtpValidityTime *time.Time    `db:"current_otp_validity_time" json:"current_otp_validity_time"`
+	ConfirmedAccount       bool          `db:"confirmed_account" json:"confirmed_account"`
+	Locale                 models.Locale `db:"locale" json:"locale"`
 }
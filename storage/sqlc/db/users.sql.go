@@ -7,7 +7,9 @@ package db
 
 import (
 	"context"
-	"database/sql"
+	"time"
+
+	"cyberix.fr/frcc/models"
 )
 
 const confirmRegister = `-- name: ConfirmRegister :one
@@ -16,7 +18,7 @@ SET
   confirmed_account = TRUE
 WHERE
   confirmation_token = $1
-RETURNING id, first_name, last_name, email, quality, phone, organization, created_at, updated_at, confirmation_token, current_otp, current_otp_validity_time, confirmed_account
+RETURNING id, first_name, last_name, email, quality, phone, organization, created_at, updated_at, confirmation_token, current_otp, current_otp_validity_time, confirmed_account, locale
 `
 
 func (q *Queries) ConfirmRegister(ctx context.Context, confirmationToken string) (*User, error) {
@@ -36,24 +38,26 @@ func (q *Queries) ConfirmRegister(ctx context.Context, confirmationToken string)
 		&i.CurrentOtp,
 		&i.CurrentOtpValidityTime,
 		&i.ConfirmedAccount,
+		&i.Locale,
 	)
 	return &i, err
 }
 
 const createUser = `-- name: CreateUser :one
-INSERT INTO users(first_name, last_name, email, quality, phone, organization, confirmation_token)
-VALUES ($1, $2, $3, $4, $5, $6, $7)
-RETURNING id, first_name, last_name, email, quality, phone, organization, created_at, updated_at, confirmation_token, current_otp, current_otp_validity_time, confirmed_account
+INSERT INTO users(first_name, last_name, email, quality, phone, organization, confirmation_token, locale)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING id, first_name, last_name, email, quality, phone, organization, created_at, updated_at, confirmation_token, current_otp, current_otp_validity_time, confirmed_account, locale
 `
 
 type CreateUserParams struct {
-	FirstName         string `db:"first_name" json:"first_name"`
-	LastName          string `db:"last_name" json:"last_name"`
-	Email             string `db:"email" json:"email"`
-	Quality           string `db:"quality" json:"quality"`
-	Phone             string `db:"phone" json:"phone"`
-	Organization      string `db:"organization" json:"organization"`
-	ConfirmationToken string `db:"confirmation_token" json:"confirmation_token"`
+	FirstName         string        `db:"first_name" json:"first_name"`
+	LastName          string        `db:"last_name" json:"last_name"`
+	Email             string        `db:"email" json:"email"`
+	Quality           string        `db:"quality" json:"quality"`
+	Phone             string        `db:"phone" json:"phone"`
+	Organization      string        `db:"organization" json:"organization"`
+	ConfirmationToken string        `db:"confirmation_token" json:"confirmation_token"`
+	Locale            models.Locale `db:"locale" json:"locale"`
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (*User, error) {
@@ -65,6 +69,7 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (*User,
 		arg.Phone,
 		arg.Organization,
 		arg.ConfirmationToken,
+		arg.Locale,
 	)
 	var i User
 	err := row.Scan(
@@ -81,12 +86,58 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (*User,
 		&i.CurrentOtp,
 		&i.CurrentOtpValidityTime,
 		&i.ConfirmedAccount,
+		&i.Locale,
 	)
 	return &i, err
 }
 
+const getConfirmedUsers = `-- name: GetConfirmedUsers :many
+SELECT id, first_name, last_name, email, quality, phone, organization, created_at, updated_at, confirmation_token, current_otp, current_otp_validity_time, confirmed_account, locale
+FROM users
+WHERE confirmed_account = TRUE
+ORDER BY id
+`
+
+func (q *Queries) GetConfirmedUsers(ctx context.Context) ([]*User, error) {
+	rows, err := q.db.QueryContext(ctx, getConfirmedUsers)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []*User{}
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.FirstName,
+			&i.LastName,
+			&i.Email,
+			&i.Quality,
+			&i.Phone,
+			&i.Organization,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.ConfirmationToken,
+			&i.CurrentOtp,
+			&i.CurrentOtpValidityTime,
+			&i.ConfirmedAccount,
+			&i.Locale,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getUserByEmailOrPhone = `-- name: GetUserByEmailOrPhone :one
-SELECT id, first_name, last_name, email, quality, phone, organization, created_at, updated_at, confirmation_token, current_otp, current_otp_validity_time, confirmed_account
+SELECT id, first_name, last_name, email, quality, phone, organization, created_at, updated_at, confirmation_token, current_otp, current_otp_validity_time, confirmed_account, locale
 FROM users
 WHERE email = $1 OR phone = $2
 `
@@ -113,6 +164,7 @@ func (q *Queries) GetUserByEmailOrPhone(ctx context.Context, arg GetUserByEmailO
 		&i.CurrentOtp,
 		&i.CurrentOtpValidityTime,
 		&i.ConfirmedAccount,
+		&i.Locale,
 	)
 	return &i, err
 }
@@ -127,9 +179,9 @@ WHERE
 `
 
 type SetCurrentOtpParams struct {
-	CurrentOtp             sql.NullString `db:"current_otp" json:"current_otp"`
-	CurrentOtpValidityTime sql.NullTime   `db:"current_otp_validity_time" json:"current_otp_validity_time"`
-	Email                  string         `db:"email" json:"email"`
+	CurrentOtp             *string    `db:"current_otp" json:"current_otp"`
+	CurrentOtpValidityTime *time.Time `db:"current_otp_validity_time" json:"current_otp_validity_time"`
+	Email                  string     `db:"email" json:"email"`
 }
 
 func (q *Queries) SetCurrentOtp(ctx context.Context, arg SetCurrentOtpParams) error {
@@ -0,0 +1,45 @@
+-- name: CreateEmailDelivery :exec
+INSERT INTO email_deliveries(message_id, provider, recipient, tag, status)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (message_id) DO NOTHING;
+
+-- name: UpdateEmailDeliveryStatus :one
+UPDATE email_deliveries
+SET
+  status = $2,
+  detail = $3,
+  updated_at = NOW()
+WHERE
+  message_id = $1
+RETURNING *;
+
+-- name: ListEmailDeliveries :many
+SELECT *
+FROM email_deliveries
+WHERE
+  (sqlc.arg(recipient)::text = '' OR recipient = sqlc.arg(recipient))
+  AND (sqlc.arg(status)::text = '' OR status = sqlc.arg(status))
+ORDER BY id DESC
+LIMIT sqlc.arg('limit')
+OFFSET sqlc.arg('offset');
+
+-- name: CreateEmailSuppression :exec
+INSERT INTO email_suppressions(email, reason, detail)
+VALUES ($1, $2, $3)
+ON CONFLICT (email) DO NOTHING;
+
+-- name: GetEmailSuppression :one
+SELECT *
+FROM email_suppressions
+WHERE email = $1;
+
+-- name: ListEmailSuppressions :many
+SELECT *
+FROM email_suppressions
+ORDER BY created_at DESC
+LIMIT $1
+OFFSET $2;
+
+-- name: DeleteEmailSuppression :exec
+DELETE FROM email_suppressions
+WHERE email = $1;
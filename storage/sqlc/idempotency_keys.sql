@@ -0,0 +1,31 @@
+-- name: CreateIdempotencyKey :one
+INSERT INTO idempotency_keys(key, fingerprint)
+VALUES (sqlc.arg(key), sqlc.arg(fingerprint))
+ON CONFLICT (key) DO UPDATE
+SET
+  fingerprint = EXCLUDED.fingerprint,
+  status_code = NULL,
+  content_type = NULL,
+  response_body = NULL,
+  created_at = NOW()
+WHERE idempotency_keys.created_at < NOW() - sqlc.arg(ttl_seconds)::int * INTERVAL '1 second'
+RETURNING *;
+
+-- name: GetIdempotencyKey :one
+SELECT *
+FROM idempotency_keys
+WHERE key = $1;
+
+-- name: SaveIdempotencyKeyResponse :exec
+UPDATE idempotency_keys
+SET
+  status_code = $2,
+  content_type = $3,
+  response_body = $4
+WHERE
+  key = $1
+;
+
+-- name: DeleteIdempotencyKey :exec
+DELETE FROM idempotency_keys
+WHERE key = $1;
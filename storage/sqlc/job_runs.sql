@@ -0,0 +1,47 @@
+-- name: StartJobRun :one
+INSERT INTO job_runs(job_id, name, payload, payload_hash, status, attempts)
+VALUES ($1, $2, $3, $4, 'running', 1)
+ON CONFLICT (job_id) DO UPDATE
+SET
+  attempts = job_runs.attempts + 1,
+  status = 'running',
+  updated_at = NOW()
+WHERE job_runs.status <> 'succeeded'
+RETURNING *;
+
+-- name: FinishJobRun :exec
+UPDATE job_runs
+SET
+  status = $2,
+  duration_ms = $3,
+  last_error = $4,
+  updated_at = NOW(),
+  finished_at = NOW()
+WHERE
+  job_id = $1
+;
+
+-- name: ListJobRuns :many
+SELECT *
+FROM job_runs
+WHERE
+  (sqlc.arg(status)::text = '' OR status = sqlc.arg(status))
+  AND (sqlc.arg(name)::text = '' OR name = sqlc.arg(name))
+ORDER BY id DESC
+LIMIT sqlc.arg('limit')
+OFFSET sqlc.arg('offset');
+
+-- name: GetJobRun :one
+SELECT *
+FROM job_runs
+WHERE id = $1;
+
+-- name: RequeueJobRun :exec
+UPDATE job_runs
+SET
+  status = 'queued',
+  attempts = 0,
+  updated_at = NOW()
+WHERE
+  id = $1
+;
@@ -0,0 +1,11 @@
+-- name: CreateMarketingConsent :one
+INSERT INTO marketing_consents(user_id, granted, source, text_version)
+VALUES ($1, $2, $3, $4)
+RETURNING *;
+
+-- name: GetMarketingConsent :one
+SELECT *
+FROM marketing_consents
+WHERE user_id = $1
+ORDER BY id DESC
+LIMIT 1;
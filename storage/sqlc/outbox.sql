@@ -0,0 +1,31 @@
+-- name: CreateOutboxMessage :one
+INSERT INTO outbox(payload)
+VALUES ($1)
+RETURNING *;
+
+-- name: GetUnpublishedOutboxMessagesForUpdate :many
+SELECT *
+FROM outbox
+WHERE published_at IS NULL
+ORDER BY id
+LIMIT $1
+FOR UPDATE SKIP LOCKED;
+
+-- name: MarkOutboxMessagePublished :exec
+UPDATE outbox
+SET
+  attempts = attempts + 1,
+  last_error = NULL,
+  published_at = NOW()
+WHERE
+  id = $1
+;
+
+-- name: MarkOutboxMessageFailed :exec
+UPDATE outbox
+SET
+  attempts = attempts + 1,
+  last_error = $2
+WHERE
+  id = $1
+;
@@ -0,0 +1,20 @@
+-- name: CreateScheduledJob :exec
+INSERT INTO scheduled_jobs(key, payload, run_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (key) DO NOTHING;
+
+-- name: GetDueScheduledJobsForUpdate :many
+SELECT *
+FROM scheduled_jobs
+WHERE enqueued_at IS NULL AND run_at <= NOW() AT TIME ZONE 'UTC'
+ORDER BY run_at
+LIMIT $1
+FOR UPDATE SKIP LOCKED;
+
+-- name: MarkScheduledJobEnqueued :exec
+UPDATE scheduled_jobs
+SET
+  enqueued_at = NOW()
+WHERE
+  id = $1
+;
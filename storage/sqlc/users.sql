@@ -1,6 +1,6 @@
 -- name: CreateUser :one
-INSERT INTO users(first_name, last_name, email, quality, phone, organization, confirmation_token)
-VALUES ($1, $2, $3, $4, $5, $6, $7)
+INSERT INTO users(first_name, last_name, email, quality, phone, organization, confirmation_token, locale)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 RETURNING *;
 
 -- name: GetUserByEmailOrPhone :one
@@ -24,4 +24,9 @@ SET
 WHERE
   confirmation_token = $1
 RETURNING *
-;
\ No newline at end of file
+;
+-- name: GetConfirmedUsers :many
+SELECT *
+FROM users
+WHERE confirmed_account = TRUE
+ORDER BY id;
@@ -1,6 +1,16 @@
 package storage
 
-import "database/sql"
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"cyberix.fr/frcc/models"
+	"github.com/lib/pq"
+)
 
 type Storage interface {
 	Querier
@@ -10,11 +20,349 @@ type Storage interface {
 type SQLStorage struct {
 	db *sql.DB
 	*Queries
+	txFlows
 }
 
 func NewStorage(db *sql.DB) Storage {
-	return &SQLStorage{
+	s := &SQLStorage{
 		db:      db,
 		Queries: NewQueries(db),
 	}
+	s.txFlows = txFlows{storage: s}
+	return s
+}
+
+// txFlows implements the flows of QuerierTx, each in a single transaction of the storage.
+type txFlows struct {
+	storage interface {
+		ExecTx(ctx context.Context, fn func(Querier) error) error
+		ExecTxWithOptions(ctx context.Context, opts TxOptions, fn func(Querier) error) error
+	}
+}
+
+// TxOptions configures the transactions run by ExecTxWithOptions.
+type TxOptions struct {
+	Isolation sql.IsolationLevel
+	ReadOnly  bool
+	// MaxRetries is how many times the transaction is run again after failing on a serialization
+	// failure or a deadlock, which the database reports when concurrent transactions conflict.
+	MaxRetries int
+}
+
+// DefaultTxOptions are the options of ExecTx.
+var DefaultTxOptions = TxOptions{
+	Isolation:  sql.LevelReadCommitted,
+	MaxRetries: 3,
+}
+
+// ExecTx runs fn inside a database transaction with DefaultTxOptions.
+func (s *SQLStorage) ExecTx(ctx context.Context, fn func(Querier) error) error {
+	return s.ExecTxWithOptions(ctx, DefaultTxOptions, fn)
+}
+
+// ExecTxWithOptions runs fn inside a database transaction, committed only if fn returns no error.
+// The transaction is bound to ctx, and rolled back if ctx is done before it commits.
+// As fn runs again when the transaction is retried, it must have no effect outside of it, unless
+// MaxRetries is zero and the effect is safe to repeat after a rollback.
+func (s *SQLStorage) ExecTxWithOptions(ctx context.Context, opts TxOptions, fn func(Querier) error) error {
+	for attempt := 0; ; attempt++ {
+		err := s.execTx(ctx, opts, fn)
+		if err == nil || attempt >= opts.MaxRetries || !isRetryableTxError(err) {
+			return err
+		}
+
+		// back off for a random time, so that the conflicting transactions do not meet again
+		backoff := time.Duration(attempt+1)*10*time.Millisecond + time.Duration(rand.Int63n(int64(10*time.Millisecond)))
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+func (s *SQLStorage) execTx(ctx context.Context, opts TxOptions, fn func(Querier) error) error {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{
+		Isolation: opts.Isolation,
+		ReadOnly:  opts.ReadOnly,
+	})
+	if err != nil {
+		return err
+	}
+
+	q := s.WithTx(tx)
+	if err := fn(q); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("tx err: %w, rb err: %v", err, rbErr)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// isRetryableTxError tells if the transaction failed on a conflict with a concurrent one,
+// and would succeed if run again.
+func isRetryableTxError(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+
+	switch pqErr.Code {
+	case "40001", // serialization_failure
+		"40P01": // deadlock_detected
+		return true
+	}
+	return false
+}
+
+type SetCurrentOtpTxParams struct {
+	SetCurrentOtpParams
+	Message models.Message
+}
+
+// SetCurrentOtpTx sets the current OTP and stores the message to enqueue in the outbox.
+func (s txFlows) SetCurrentOtpTx(ctx context.Context, arg SetCurrentOtpTxParams) error {
+	return s.storage.ExecTx(ctx, func(q Querier) error {
+		if err := q.SetCurrentOtp(ctx, arg.SetCurrentOtpParams); err != nil {
+			return err
+		}
+
+		_, err := q.CreateOutboxMessage(ctx, arg.Message)
+		return err
+	})
+}
+
+type ConfirmRegisterTxParams struct {
+	ConfirmationToken string
+	Message           models.Message
+}
+
+// ConfirmRegisterTx confirms the account and stores the message to enqueue in the outbox.
+func (s txFlows) ConfirmRegisterTx(ctx context.Context, arg ConfirmRegisterTxParams) (*models.User, error) {
+	var user *models.User
+
+	err := s.storage.ExecTx(ctx, func(q Querier) error {
+		var err error
+
+		user, err = q.ConfirmRegister(ctx, arg.ConfirmationToken)
+		if err != nil {
+			return err
+		}
+
+		_, err = q.CreateOutboxMessage(ctx, arg.Message)
+		return err
+	})
+
+	return user, err
+}
+
+// PublishOutboxTx locks up to limit unpublished outbox messages and hands them to publish in order.
+// Published messages are marked as such, the first failure is recorded and stops the batch.
+// Rows stay locked until the transaction ends, so concurrent relays never publish the same batch.
+// publish sends outside the transaction, which is not retried so as not to send the batch again,
+// but a rollback still leaves the sent messages unpublished: delivery is at least once, the copies
+// being dropped by their deduplication ID.
+func (s txFlows) PublishOutboxTx(ctx context.Context, limit int32, publish func(*models.OutboxMessage) error) (int, error) {
+	var published int
+
+	opts := DefaultTxOptions
+	opts.MaxRetries = 0
+	err := s.storage.ExecTxWithOptions(ctx, opts, func(q Querier) error {
+		published = 0
+
+		messages, err := q.GetUnpublishedOutboxMessagesForUpdate(ctx, limit)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range messages {
+			if err := publish(m); err != nil {
+				return q.MarkOutboxMessageFailed(ctx, MarkOutboxMessageFailedParams{
+					ID:        m.ID,
+					LastError: err.Error(),
+				})
+			}
+
+			if err := q.MarkOutboxMessagePublished(ctx, m.ID); err != nil {
+				return err
+			}
+			published++
+		}
+
+		return nil
+	})
+
+	return published, err
+}
+
+// EnqueueDueScheduledJobsTx moves up to limit due scheduled jobs into the outbox,
+// from where the relay publishes them to the queue.
+func (s txFlows) EnqueueDueScheduledJobsTx(ctx context.Context, limit int32) (int, error) {
+	var enqueued int
+
+	err := s.storage.ExecTx(ctx, func(q Querier) error {
+		// the counter starts over when the transaction is retried
+		enqueued = 0
+
+		jobs, err := q.GetDueScheduledJobsForUpdate(ctx, limit)
+		if err != nil {
+			return err
+		}
+
+		for _, job := range jobs {
+			if _, err := q.CreateOutboxMessage(ctx, job.Payload); err != nil {
+				return err
+			}
+
+			if err := q.MarkScheduledJobEnqueued(ctx, job.ID); err != nil {
+				return err
+			}
+			enqueued++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return enqueued, nil
+}
+
+type ScheduleCampaignTxParams struct {
+	ScheduleCampaignParams
+	// Message is the job starting the campaign, enqueued at SendAt.
+	Message models.Message
+}
+
+// ScheduleCampaignTx schedules the campaign and the job starting it at the same time.
+// Rescheduling leaves the job of the previous date, which finds the campaign not due and stops.
+// It returns nil when the campaign does not exist or already started.
+func (s txFlows) ScheduleCampaignTx(ctx context.Context, arg ScheduleCampaignTxParams) (*models.Campaign, error) {
+	var campaign *models.Campaign
+
+	err := s.storage.ExecTx(ctx, func(q Querier) error {
+		var err error
+
+		campaign, err = q.ScheduleCampaign(ctx, arg.ScheduleCampaignParams)
+		if err != nil || campaign == nil {
+			return err
+		}
+
+		key := fmt.Sprintf("campaign:%v:%v", arg.ID, arg.SendAt.Unix())
+		return q.CreateScheduledJob(ctx, CreateScheduledJobParams{
+			Key:     &key,
+			Payload: arg.Message,
+			RunAt:   arg.SendAt.UTC(),
+		})
+	})
+
+	return campaign, err
+}
+
+// StartCampaignTx marks the scheduled campaign as sending and snapshots its audience, returning
+// the campaign and the number of recipients. It returns a nil campaign when not scheduled anymore.
+func (s txFlows) StartCampaignTx(ctx context.Context, id int64) (*models.Campaign, int64, error) {
+	var (
+		campaign   *models.Campaign
+		recipients int64
+	)
+
+	err := s.storage.ExecTx(ctx, func(q Querier) error {
+		var err error
+
+		campaign, err = q.StartCampaign(ctx, id)
+		if err != nil || campaign == nil {
+			return err
+		}
+
+		recipients, err = q.CreateCampaignRecipients(ctx, CreateCampaignRecipientsParams{
+			CampaignID: campaign.ID,
+			Audience:   campaign.Audience,
+		})
+		return err
+	})
+
+	return campaign, recipients, err
+}
+
+type QueueCampaignBatchTxParams struct {
+	CampaignID int64
+	Limit      int32
+	// Message returns the job sending the campaign to a recipient.
+	Message func(*models.CampaignRecipient) models.Message
+}
+
+// QueueCampaignBatchTx moves up to limit pending recipients of the campaign into the outbox,
+// and returns how many were queued.
+func (s txFlows) QueueCampaignBatchTx(ctx context.Context, arg QueueCampaignBatchTxParams) (int, error) {
+	var queued int
+
+	err := s.storage.ExecTx(ctx, func(q Querier) error {
+		// the counter starts over when the transaction is retried
+		queued = 0
+
+		recipients, err := q.GetPendingCampaignRecipientsForUpdate(ctx, GetPendingCampaignRecipientsForUpdateParams{
+			CampaignID: arg.CampaignID,
+			Limit:      arg.Limit,
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, r := range recipients {
+			if _, err := q.CreateOutboxMessage(ctx, arg.Message(r)); err != nil {
+				return err
+			}
+
+			if err := q.MarkCampaignRecipientQueued(ctx, r.ID); err != nil {
+				return err
+			}
+			queued++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return queued, nil
+}
+
+type UpdateMarketingConsentTxParams struct {
+	CreateMarketingConsentParams
+	Email string
+	// CampaignID is the campaign the user unsubscribed from, if any.
+	CampaignID *int64
+}
+
+// UpdateMarketingConsentTx records the consent decision of the user and opts its address out of
+// campaigns, or back in, so that a withdrawal also stops the campaigns already sending.
+func (s txFlows) UpdateMarketingConsentTx(ctx context.Context, arg UpdateMarketingConsentTxParams) (*models.MarketingConsent, error) {
+	var consent *models.MarketingConsent
+
+	err := s.storage.ExecTx(ctx, func(q Querier) error {
+		var err error
+
+		consent, err = q.CreateMarketingConsent(ctx, arg.CreateMarketingConsentParams)
+		if err != nil {
+			return err
+		}
+
+		if consent.Granted {
+			return q.DeleteMarketingOptOut(ctx, arg.Email)
+		}
+
+		return q.CreateMarketingOptOut(ctx, CreateMarketingOptOutParams{
+			Email:      arg.Email,
+			CampaignID: arg.CampaignID,
+		})
+	})
+
+	return consent, err
 }
@@ -0,0 +1,120 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"cyberix.fr/frcc/models"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "cyberix.fr/frcc"
+
+// Keys of the W3C trace context, as carried in queue messages.
+const (
+	TraceparentKey = "traceparent"
+	TracestateKey  = "tracestate"
+)
+
+// Keys are the message keys holding the trace context.
+var Keys = []string{TraceparentKey, TracestateKey}
+
+type SetupOptions struct {
+	// Exporter is otlp, configured through the standard OTEL_EXPORTER_OTLP_* variables,
+	// stdout, or empty to disable tracing.
+	Exporter string
+	Release  string
+	Service  string
+}
+
+// Setup installs the global tracer provider and the W3C trace context propagator, and returns
+// the function flushing the spans on shutdown.
+func Setup(ctx context.Context, opts SetupOptions) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var (
+		exporter sdktrace.SpanExporter
+		err      error
+	)
+	switch opts.Exporter {
+	case "":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		exporter, err = otlptracehttp.New(ctx)
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %v", opts.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error creating %v exporter: %w", opts.Exporter, err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", opts.Service),
+			attribute.String("service.version", opts.Release),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer of the API, a no-op one until Setup is called.
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// messageCarrier carries the trace context in a queue message.
+type messageCarrier models.Message
+
+func (c messageCarrier) Get(key string) string {
+	return c[key]
+}
+
+func (c messageCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c messageCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// Inject adds the trace context of ctx to m, unless m already carries one.
+func Inject(ctx context.Context, m models.Message) {
+	if _, ok := m[TraceparentKey]; ok {
+		return
+	}
+	otel.GetTextMapPropagator().Inject(ctx, messageCarrier(m))
+}
+
+// Extract returns ctx with the trace context carried by m.
+func Extract(ctx context.Context, m models.Message) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, messageCarrier(m))
+}
+
+// RecordError marks the span as failed with err, if any.
+func RecordError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}